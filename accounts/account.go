@@ -0,0 +1,228 @@
+// Package accounts maps rows of the accounts table to Go types and back, so
+// that callers don't each need their own SQL and char(1) flag handling.
+package accounts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/nosborn/ibgames-1999"
+)
+
+// ErrNotFound is returned when there is no such account.
+var ErrNotFound = errors.New("account not found")
+
+// Account is one row of the accounts table. Zero times and invalid addresses
+// stand for NULL columns. Addresses written by older programs aren't always IP
+// addresses; those are left invalid and kept, as they were stored, in
+// LastLoginIP and LastFailureIP.
+type Account struct {
+	UID             ibgames.AccountID
+	Name            string
+	NameKey         string // Set from Name by Update
+	Encrypt         string // Password hash
+	PasswordChanged time.Time
+	Expire          time.Duration // Zero if the account never expires
+	LastLogin       time.Time
+	LastFailure     time.Time
+	LastLoginAddr   netip.Addr
+	LastLoginIP     string // sucip if it isn't an address
+	Failures        int    // Unsuccessful logins since the last success
+	LastFailureAddr netip.Addr
+	LastFailureIP   string // unsucip if it isn't an address
+	Email           string
+	EmailKey        string // Set from Email by Update
+	Signup          time.Time
+	Status          ibgames.AccountStatus
+	StatusReason    string // Why the account was suspended or cancelled
+	Complimentary   bool
+	Minutes         int               // Not written by Update
+	AdminUID        ibgames.AccountID // Last administrator to change the account
+	AdminDate       time.Time
+	BulkMail        bool
+	BadCheck        bool
+	BuddyUID        ibgames.AccountID
+	BuddyPayment    bool
+}
+
+// NameKey returns the key that name is looked up by: name with ASCII letters
+// folded to lower case and everything but printable ASCII removed, so that
+// names differing only in case or spacing are the same account.
+func NameKey(name string) string {
+	var key []byte
+	for _, ch := range []byte(name) {
+		switch {
+		case ch >= 'A' && ch <= 'Z':
+			key = append(key, ch|32)
+		case ch > ' ' && ch < 0x7f:
+			key = append(key, ch)
+		}
+	}
+	return string(key)
+}
+
+// EmailKey returns the key that email is looked up by.
+func EmailKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+const columns = `
+	uid, name, name_key, encrypt, schange, acct_expire, slogin, ulogin,
+	sucip, nunsuclog, unsucip, email, email_key, signup, status,
+	complimentary, minutes, admin_uid, admin_date, bulk_mail, bad_check,
+	buddy_uid, buddy_payment, status_reason`
+
+// scanner is satisfied by both *db.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scan(row scanner) (*Account, error) {
+	var (
+		a             Account
+		uid           int64
+		nameKey       sql.NullString
+		schange       sql.NullString
+		acctExpire    sql.NullInt64
+		slogin        sql.NullString
+		ulogin        sql.NullString
+		sucip         sql.NullString
+		nunsuclog     sql.NullInt64
+		unsucip       sql.NullString
+		email         sql.NullString
+		emailKey      sql.NullString
+		signup        sql.NullString
+		status        sql.NullString
+		complimentary sql.NullString
+		minutes       sql.NullInt64
+		adminUID      sql.NullInt64
+		adminDate     sql.NullString
+		bulkMail      sql.NullString
+		badCheck      sql.NullString
+		buddyUID      sql.NullInt64
+		buddyPayment  sql.NullString
+		statusReason  sql.NullString
+	)
+	err := row.Scan(&uid, &a.Name, &nameKey, &a.Encrypt, &schange, &acctExpire, &slogin, &ulogin,
+		&sucip, &nunsuclog, &unsucip, &email, &emailKey, &signup, &status,
+		&complimentary, &minutes, &adminUID, &adminDate, &bulkMail, &badCheck,
+		&buddyUID, &buddyPayment, &statusReason)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	a.UID = ibgames.AccountID(uid)
+	a.NameKey = nameKey.String
+	a.Expire = time.Duration(acctExpire.Int64) * time.Minute
+	a.Failures = int(nunsuclog.Int64)
+	a.Email = email.String
+	a.EmailKey = emailKey.String
+	a.Complimentary = complimentary.String == "Y"
+	a.Minutes = int(minutes.Int64)
+	a.AdminUID = ibgames.AccountID(adminUID.Int64)
+	a.BulkMail = bulkMail.String == "Y"
+	a.BadCheck = badCheck.String == "Y"
+	a.BuddyUID = ibgames.AccountID(buddyUID.Int64)
+	a.BuddyPayment = buddyPayment.String == "Y"
+	a.StatusReason = statusReason.String
+
+	if len(status.String) == 1 {
+		a.Status = ibgames.AccountStatus(status.String[0])
+	}
+	switch a.Status {
+	case ibgames.AccountActive, ibgames.AccountSuspended, ibgames.AccountCancelled:
+	default:
+		return nil, fmt.Errorf("account %d: bad status %q", a.UID, status.String)
+	}
+
+	for _, t := range []struct {
+		dest *time.Time
+		src  sql.NullString
+	}{
+		{&a.PasswordChanged, schange},
+		{&a.LastLogin, slogin},
+		{&a.LastFailure, ulogin},
+		{&a.Signup, signup},
+		{&a.AdminDate, adminDate},
+	} {
+		if *t.dest, err = parseTime(t.src); err != nil {
+			return nil, fmt.Errorf("account %d: %w", a.UID, err)
+		}
+	}
+	a.LastLoginAddr, a.LastLoginIP = parseAddr(sucip)
+	a.LastFailureAddr, a.LastFailureIP = parseAddr(unsucip)
+	return &a, nil
+}
+
+// Dates and times are stored as SQLite text. DATETIME YEAR TO MINUTE columns
+// written by older programs have no seconds.
+var timeLayouts = []string{time.DateTime, "2006-01-02 15:04", time.DateOnly}
+
+func parseTime(s sql.NullString) (time.Time, error) {
+	if !s.Valid || s.String == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s.String); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad date %q", s.String)
+}
+
+// formatTime returns t formatted for a column, or nil for NULL.
+func formatTime(t time.Time, layout string) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(layout)
+}
+
+// parseAddr returns the address in s. If s isn't an address it returns the
+// zero Addr and s as it was stored.
+func parseAddr(s sql.NullString) (netip.Addr, string) {
+	if !s.Valid || s.String == "" {
+		return netip.Addr{}, ""
+	}
+	addr, err := netip.ParseAddr(strings.TrimSpace(s.String))
+	if err != nil {
+		return netip.Addr{}, s.String
+	}
+	return addr, ""
+}
+
+// formatAddr returns addr formatted for a column, or stored if addr is
+// invalid, so that values that aren't addresses survive an Update. It returns
+// nil for NULL.
+func formatAddr(addr netip.Addr, stored string) any {
+	if addr.IsValid() {
+		return addr.String()
+	}
+	if stored != "" {
+		return stored
+	}
+	return nil
+}
+
+// nullUID returns uid for a column, or nil for NULL.
+func nullUID(uid ibgames.AccountID) any {
+	if uid == 0 {
+		return nil
+	}
+	return int64(uid)
+}
+
+// flag returns the char(1) value of b.
+func flag(b bool) string {
+	if b {
+		return "Y"
+	}
+	return "N"
+}
@@ -0,0 +1,162 @@
+package accounts
+
+import (
+	"context"
+	"database/sql"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nosborn/ibgames-1999"
+	"github.com/nosborn/ibgames-1999/db"
+	"github.com/nosborn/ibgames-1999/internal/testutil"
+)
+
+func setupAccountsTest(t *testing.T) (*testutil.DatabaseSetup, *db.Handle) {
+	setup := testutil.SetupTestDatabaseWithSchema(t)
+	h, err := db.Open(filepath.Dir(setup.FilePath), false)
+	require.NoError(t, err)
+	t.Cleanup(h.Abandon)
+	return setup, h
+}
+
+func TestScan(t *testing.T) {
+	setup, h := setupAccountsTest(t)
+	setup.CreateTestAccount(t, 666400, "Admin", "Y", 0)
+	setup.CreateTestAccount(t, 666401, "Some Player", "N", 42)
+	_, err := setup.TestDB.Exec(`
+		UPDATE accounts
+		SET schange = '1999-01-02 03:04', acct_expire = 90,
+			slogin = '1999-03-15 14:30:00', sucip = '192.0.2.9', nunsuclog = 2,
+			email = 'Player@Example.COM', email_key = 'player@example.com',
+			signup = '1998-12-25', status = 'S', admin_uid = 666400,
+			admin_date = '1999-03-16', bad_check = 'Y'
+		WHERE uid = 666401`)
+	require.NoError(t, err)
+
+	a, err := Get(context.Background(), h, 666401)
+	require.NoError(t, err)
+	assert.Equal(t, &Account{
+		UID:             666401,
+		Name:            "Some Player",
+		NameKey:         "some player",
+		Encrypt:         "dummy_hash",
+		PasswordChanged: time.Date(1999, 1, 2, 3, 4, 0, 0, time.UTC),
+		Expire:          90 * time.Minute,
+		LastLogin:       time.Date(1999, 3, 15, 14, 30, 0, 0, time.UTC),
+		LastLoginAddr:   netip.MustParseAddr("192.0.2.9"),
+		Failures:        2,
+		Email:           "Player@Example.COM",
+		EmailKey:        "player@example.com",
+		Signup:          time.Date(1998, 12, 25, 0, 0, 0, 0, time.UTC),
+		Status:          ibgames.AccountSuspended,
+		Minutes:         42,
+		AdminUID:        666400,
+		AdminDate:       time.Date(1999, 3, 16, 0, 0, 0, 0, time.UTC),
+		BulkMail:        true,
+		BadCheck:        true,
+	}, a)
+
+	t.Run("keeps addresses that aren't addresses", func(t *testing.T) {
+		_, err := setup.TestDB.Exec("UPDATE accounts SET sucip = 'dialup.example.com', unsucip = '010.000.000.001' WHERE uid = 666400")
+		require.NoError(t, err)
+		require.NoError(t, h.Rollback()) // Move on to a fresh snapshot.
+		a, err := Get(context.Background(), h, 666400)
+		require.NoError(t, err)
+		assert.False(t, a.LastLoginAddr.IsValid())
+		assert.Equal(t, "dialup.example.com", a.LastLoginIP)
+		assert.False(t, a.LastFailureAddr.IsValid())
+		assert.Equal(t, "010.000.000.001", a.LastFailureIP)
+
+		// They're written back as they were.
+		require.NoError(t, Update(context.Background(), h, a))
+		require.NoError(t, h.Commit())
+		var sucip string
+		require.NoError(t, setup.TestDB.QueryRow("SELECT sucip FROM accounts WHERE uid = 666400").Scan(&sucip))
+		assert.Equal(t, "dialup.example.com", sucip)
+	})
+
+	t.Run("rejects bad data", func(t *testing.T) {
+		_, err := setup.TestDB.Exec("UPDATE accounts SET slogin = 'garbage' WHERE uid = 666400")
+		require.NoError(t, err)
+		require.NoError(t, h.Rollback()) // Move on to a fresh snapshot.
+		_, err = Get(context.Background(), h, 666400)
+		assert.ErrorContains(t, err, "account 666400")
+	})
+}
+
+func TestParseTime(t *testing.T) {
+	for _, s := range []string{"1999-03-15 14:30:05", "1999-03-15 14:30", "1999-03-15"} {
+		tm, err := parseTime(sql.NullString{String: s, Valid: true})
+		require.NoError(t, err, s)
+		assert.Equal(t, 1999, tm.Year())
+	}
+
+	tm, err := parseTime(sql.NullString{})
+	require.NoError(t, err)
+	assert.True(t, tm.IsZero())
+
+	_, err = parseTime(sql.NullString{String: "15/03/1999", Valid: true})
+	assert.Error(t, err)
+}
+
+func TestNameKey(t *testing.T) {
+	t.Run("converts uppercase to lowercase", func(t *testing.T) {
+		assert.Equal(t, "hello", NameKey("HELLO"))
+		assert.Equal(t, "world", NameKey("WORLD"))
+		assert.Equal(t, "test", NameKey("TEST"))
+	})
+
+	t.Run("preserves lowercase", func(t *testing.T) {
+		assert.Equal(t, "hello", NameKey("hello"))
+		assert.Equal(t, "world", NameKey("world"))
+	})
+
+	t.Run("handles mixed case", func(t *testing.T) {
+		assert.Equal(t, "helloworld", NameKey("HelloWorld"))
+		assert.Equal(t, "testuser", NameKey("TestUser"))
+		assert.Equal(t, "mixedcase", NameKey("MiXeDcAsE"))
+	})
+
+	t.Run("preserves digits", func(t *testing.T) {
+		assert.Equal(t, "user123", NameKey("User123"))
+		assert.Equal(t, "test456", NameKey("TEST456"))
+	})
+
+	t.Run("preserves symbols", func(t *testing.T) {
+		assert.Equal(t, "user@domain.com", NameKey("User@Domain.Com"))
+		assert.Equal(t, "test_name", NameKey("Test_Name"))
+		assert.Equal(t, "user-123", NameKey("USER-123"))
+	})
+
+	t.Run("removes spaces and control characters", func(t *testing.T) {
+		assert.Equal(t, "hello", NameKey("hello "))
+		assert.Equal(t, "test", NameKey(" test"))
+		assert.Equal(t, "helloworld", NameKey("hello world"))
+		assert.Equal(t, "test", NameKey("test\t"))
+		assert.Equal(t, "test", NameKey("test\n"))
+	})
+
+	t.Run("handles empty string", func(t *testing.T) {
+		assert.Empty(t, NameKey(""))
+	})
+
+	t.Run("handles only spaces", func(t *testing.T) {
+		assert.Empty(t, NameKey("   "))
+		assert.Empty(t, NameKey("\t\n"))
+	})
+
+	t.Run("preserves punctuation within graph range", func(t *testing.T) {
+		assert.Equal(t, "!@#$%^&*()", NameKey("!@#$%^&*()"))
+		assert.Equal(t, "user.name", NameKey("User.Name"))
+		assert.Equal(t, "file.txt", NameKey("File.Txt"))
+	})
+}
+
+func TestEmailKey(t *testing.T) {
+	assert.Equal(t, "player@example.com", EmailKey(" Player@Example.COM "))
+}
@@ -0,0 +1,47 @@
+package accounts
+
+import (
+	"context"
+
+	"github.com/nosborn/ibgames-1999"
+	"github.com/nosborn/ibgames-1999/db"
+)
+
+// Get returns the account uid, or ErrNotFound.
+func Get(ctx context.Context, h *db.Handle, uid ibgames.AccountID) (*Account, error) {
+	query := "SELECT " + columns + " FROM accounts WHERE uid = ?"
+	return scan(h.QueryRowContext(ctx, query, uid))
+}
+
+// GetByName returns the account called name, ignoring case and spacing as
+// NameKey does, or ErrNotFound.
+func GetByName(ctx context.Context, h *db.Handle, name string) (*Account, error) {
+	query := "SELECT " + columns + " FROM accounts WHERE name_key = ?"
+	return scan(h.QueryRowContext(ctx, query, NameKey(name)))
+}
+
+// GetByEmail returns the accounts registered to email, ignoring case, in uid
+// order. An address may be shared by several accounts. The result is empty if
+// there are none.
+func GetByEmail(ctx context.Context, h *db.Handle, email string) ([]*Account, error) {
+	query := "SELECT " + columns + " FROM accounts WHERE email_key = ? ORDER BY uid"
+	return list(ctx, h, query, EmailKey(email))
+}
+
+func list(ctx context.Context, h *db.Handle, query string, args ...any) ([]*Account, error) {
+	rows, err := h.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []*Account
+	for rows.Next() {
+		a, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, rows.Err()
+}
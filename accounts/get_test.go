@@ -0,0 +1,53 @@
+package accounts
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nosborn/ibgames-1999"
+)
+
+func TestGet(t *testing.T) {
+	setup, h := setupAccountsTest(t)
+	ctx := context.Background()
+	setup.CreateTestAccount(t, 666410, "Alice", "N", 10)
+	setup.CreateTestAccount(t, 666411, "Bob", "N", 10)
+	setup.CreateTestAccount(t, 666412, "Carol", "N", 10)
+	_, err := setup.TestDB.Exec(
+		"UPDATE accounts SET email = 'Shared@Example.com', email_key = 'shared@example.com' WHERE uid IN (666410, 666412)")
+	require.NoError(t, err)
+
+	t.Run("by uid", func(t *testing.T) {
+		a, err := Get(ctx, h, 666411)
+		require.NoError(t, err)
+		assert.Equal(t, "Bob", a.Name)
+		assert.Equal(t, ibgames.AccountActive, a.Status)
+
+		_, err = Get(ctx, h, 999999)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("by name", func(t *testing.T) {
+		a, err := GetByName(ctx, h, "ALICE")
+		require.NoError(t, err)
+		assert.Equal(t, ibgames.AccountID(666410), a.UID)
+
+		_, err = GetByName(ctx, h, "nobody")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("by email", func(t *testing.T) {
+		accounts, err := GetByEmail(ctx, h, "shared@EXAMPLE.com")
+		require.NoError(t, err)
+		require.Len(t, accounts, 2)
+		assert.Equal(t, ibgames.AccountID(666410), accounts[0].UID)
+		assert.Equal(t, ibgames.AccountID(666412), accounts[1].UID)
+
+		accounts, err = GetByEmail(ctx, h, "nobody@example.com")
+		require.NoError(t, err)
+		assert.Empty(t, accounts)
+	})
+}
@@ -0,0 +1,69 @@
+package accounts
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nosborn/ibgames-1999"
+	"github.com/nosborn/ibgames-1999/db"
+)
+
+// Filter selects the accounts returned by List. The zero Filter selects every
+// account.
+type Filter struct {
+	Status        []ibgames.AccountStatus // Any of these statuses
+	Complimentary *bool
+	BadCheck      *bool
+	SignupAfter   time.Time         // Signed up on or after this date
+	SignupBefore  time.Time         // Signed up before this date
+	AfterUID      ibgames.AccountID // Only accounts with larger uids, for paging
+	Limit         int               // At most this many accounts
+}
+
+// List returns the accounts matching f in uid order.
+func List(ctx context.Context, h *db.Handle, f Filter) ([]*Account, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if len(f.Status) > 0 {
+		marks := make([]string, len(f.Status))
+		for i, s := range f.Status {
+			marks[i] = "?"
+			args = append(args, string(rune(s)))
+		}
+		where = append(where, "status IN ("+strings.Join(marks, ", ")+")")
+	}
+	if f.Complimentary != nil {
+		where = append(where, "complimentary = ?")
+		args = append(args, flag(*f.Complimentary))
+	}
+	if f.BadCheck != nil {
+		where = append(where, "bad_check = ?")
+		args = append(args, flag(*f.BadCheck))
+	}
+	if !f.SignupAfter.IsZero() {
+		where = append(where, "signup >= ?")
+		args = append(args, f.SignupAfter.UTC().Format(time.DateOnly))
+	}
+	if !f.SignupBefore.IsZero() {
+		where = append(where, "signup < ?")
+		args = append(args, f.SignupBefore.UTC().Format(time.DateOnly))
+	}
+	if f.AfterUID != 0 {
+		where = append(where, "uid > ?")
+		args = append(args, f.AfterUID)
+	}
+
+	query := "SELECT " + columns + " FROM accounts"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY uid"
+	if f.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", f.Limit)
+	}
+	return list(ctx, h, query, args...)
+}
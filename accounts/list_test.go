@@ -0,0 +1,51 @@
+package accounts
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nosborn/ibgames-1999"
+)
+
+func TestList(t *testing.T) {
+	setup, h := setupAccountsTest(t)
+	ctx := context.Background()
+	setup.CreateTestAccount(t, 666430, "One", "Y", 0)
+	setup.CreateTestAccount(t, 666431, "Two", "N", 10)
+	setup.CreateTestAccount(t, 666432, "Three", "N", 10)
+	setup.CreateTestAccount(t, 666433, "Four", "N", 10)
+	_, err := setup.TestDB.Exec(`
+		UPDATE accounts SET status = 'S', bad_check = 'Y' WHERE uid = 666432;
+		UPDATE accounts SET status = 'X' WHERE uid = 666433;
+		UPDATE accounts SET signup = '1999-01-01';
+		UPDATE accounts SET signup = '1998-06-01' WHERE uid = 666430`)
+	require.NoError(t, err)
+
+	uids := func(f Filter) []ibgames.AccountID {
+		accounts, err := List(ctx, h, f)
+		require.NoError(t, err)
+		var uids []ibgames.AccountID
+		for _, a := range accounts {
+			uids = append(uids, a.UID)
+		}
+		return uids
+	}
+	yes, no := true, false
+
+	assert.Equal(t, []ibgames.AccountID{666430, 666431, 666432, 666433}, uids(Filter{}))
+	assert.Equal(t, []ibgames.AccountID{666432, 666433},
+		uids(Filter{Status: []ibgames.AccountStatus{ibgames.AccountSuspended, ibgames.AccountCancelled}}))
+	assert.Equal(t, []ibgames.AccountID{666430}, uids(Filter{Complimentary: &yes}))
+	assert.Equal(t, []ibgames.AccountID{666430, 666431, 666433}, uids(Filter{BadCheck: &no}))
+	assert.Equal(t, []ibgames.AccountID{666430},
+		uids(Filter{SignupBefore: time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC)}))
+	assert.Equal(t, []ibgames.AccountID{666431, 666432, 666433},
+		uids(Filter{SignupAfter: time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC)}))
+	assert.Equal(t, []ibgames.AccountID{666432, 666433}, uids(Filter{AfterUID: 666431, Limit: 5}))
+	assert.Equal(t, []ibgames.AccountID{666430, 666431}, uids(Filter{Limit: 2}))
+	assert.Empty(t, uids(Filter{Status: []ibgames.AccountStatus{ibgames.AccountActive}, BadCheck: &yes}))
+}
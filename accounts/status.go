@@ -0,0 +1,129 @@
+package accounts
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nosborn/ibgames-1999"
+	"github.com/nosborn/ibgames-1999/db"
+)
+
+// Standing is the part of an account that decides whether it may be used.
+type Standing struct {
+	UID       ibgames.AccountID
+	Status    ibgames.AccountStatus // AccountNotFound if there is no such account
+	Reason    string                // Why the account was suspended or cancelled
+	AdminUID  ibgames.AccountID     // Last administrator to change the account
+	AdminDate time.Time
+}
+
+// Usable reports whether the account exists and is active.
+func (s *Standing) Usable() bool {
+	return s.Status == ibgames.AccountActive
+}
+
+// GetStatus returns the standing of account uid. An account that doesn't
+// exist is reported with status AccountNotFound rather than an error.
+func GetStatus(ctx context.Context, h *db.Handle, uid ibgames.AccountID) (*Standing, error) {
+	const query = `
+		SELECT status, status_reason, admin_uid, admin_date
+		FROM accounts
+		WHERE uid = ?`
+
+	var status, reason, adminDate sql.NullString
+	var adminUID sql.NullInt64
+	err := h.QueryRowContext(ctx, query, uid).Scan(&status, &reason, &adminUID, &adminDate)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &Standing{UID: uid, Status: ibgames.AccountNotFound}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Standing{
+		UID:      uid,
+		Reason:   reason.String,
+		AdminUID: ibgames.AccountID(adminUID.Int64),
+	}
+	if len(status.String) == 1 {
+		s.Status = ibgames.AccountStatus(status.String[0])
+	}
+	switch s.Status {
+	case ibgames.AccountActive, ibgames.AccountSuspended, ibgames.AccountCancelled:
+	default:
+		return nil, fmt.Errorf("account %d: bad status %q", uid, status.String)
+	}
+	if s.AdminDate, err = parseTime(adminDate); err != nil {
+		return nil, fmt.Errorf("account %d: %w", uid, err)
+	}
+	return s, nil
+}
+
+// StatusCache remembers the results of GetStatus for a short time, for
+// callers such as game loops that check an account over and over. Nothing
+// notices when an account changes, so whoever changes one should call
+// Invalidate; otherwise the change is seen once the entry expires.
+//
+// A StatusCache is safe for concurrent use. Lookups are serialised, since they
+// share h.
+type StatusCache struct {
+	h   *db.Handle
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[ibgames.AccountID]cachedStanding
+}
+
+type cachedStanding struct {
+	standing Standing
+	expires  time.Time
+}
+
+// NewStatusCache returns a cache that looks accounts up on h and keeps each
+// result for ttl.
+func NewStatusCache(h *db.Handle, ttl time.Duration) *StatusCache {
+	return &StatusCache{
+		h:       h,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[ibgames.AccountID]cachedStanding),
+	}
+}
+
+// Get is like GetStatus but returns a cached result if there is one that
+// hasn't expired. Errors aren't cached.
+func (c *StatusCache) Get(ctx context.Context, uid ibgames.AccountID) (*Standing, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if e, ok := c.entries[uid]; ok && now.Before(e.expires) {
+		s := e.standing
+		return &s, nil
+	}
+	s, err := GetStatus(ctx, c.h, uid)
+	if err != nil {
+		return nil, err
+	}
+	c.entries[uid] = cachedStanding{standing: *s, expires: now.Add(c.ttl)}
+	return s, nil
+}
+
+// Invalidate forgets any cached result for uid.
+func (c *StatusCache) Invalidate(uid ibgames.AccountID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, uid)
+}
+
+// InvalidateAll forgets every cached result.
+func (c *StatusCache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+}
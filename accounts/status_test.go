@@ -0,0 +1,111 @@
+package accounts
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nosborn/ibgames-1999"
+)
+
+func TestGetStatus(t *testing.T) {
+	setup, h := setupAccountsTest(t)
+	ctx := context.Background()
+	setup.CreateTestAccount(t, 666460, "Admin", "Y", 0)
+	setup.CreateTestAccount(t, 666461, "Player", "N", 10)
+	setup.CreateTestAccount(t, 666462, "Cheat", "N", 10)
+	_, err := setup.TestDB.Exec(`
+		UPDATE accounts
+		SET status = 'S', status_reason = 'Chargeback', admin_uid = 666460,
+			admin_date = '1999-06-02'
+		WHERE uid = 666462`)
+	require.NoError(t, err)
+
+	t.Run("active", func(t *testing.T) {
+		s, err := GetStatus(ctx, h, 666461)
+		require.NoError(t, err)
+		assert.Equal(t, &Standing{UID: 666461, Status: ibgames.AccountActive}, s)
+		assert.True(t, s.Usable())
+	})
+
+	t.Run("suspended", func(t *testing.T) {
+		s, err := GetStatus(ctx, h, 666462)
+		require.NoError(t, err)
+		assert.Equal(t, &Standing{
+			UID:       666462,
+			Status:    ibgames.AccountSuspended,
+			Reason:    "Chargeback",
+			AdminUID:  666460,
+			AdminDate: time.Date(1999, 6, 2, 0, 0, 0, 0, time.UTC),
+		}, s)
+		assert.False(t, s.Usable())
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		s, err := GetStatus(ctx, h, 999999)
+		require.NoError(t, err)
+		assert.Equal(t, ibgames.AccountNotFound, s.Status)
+		assert.False(t, s.Usable())
+	})
+}
+
+func TestStatusCache(t *testing.T) {
+	setup, h := setupAccountsTest(t)
+	ctx := context.Background()
+	setup.CreateTestAccount(t, 666465, "Player", "N", 10)
+
+	now := time.Date(1999, 6, 1, 12, 0, 0, 0, time.UTC)
+	c := NewStatusCache(h, time.Minute)
+	c.now = func() time.Time { return now }
+
+	cancel := func() {
+		t.Helper()
+		_, err := setup.TestDB.Exec("UPDATE accounts SET status = 'X' WHERE uid = 666465")
+		require.NoError(t, err)
+		require.NoError(t, h.Rollback()) // Let h see the change
+	}
+	status := func() ibgames.AccountStatus {
+		t.Helper()
+		s, err := c.Get(ctx, 666465)
+		require.NoError(t, err)
+		return s.Status
+	}
+
+	assert.Equal(t, ibgames.AccountActive, status())
+	cancel()
+	assert.Equal(t, ibgames.AccountActive, status()) // Cached
+
+	t.Run("expires", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		assert.Equal(t, ibgames.AccountCancelled, status())
+	})
+
+	t.Run("invalidate", func(t *testing.T) {
+		_, err := setup.TestDB.Exec("UPDATE accounts SET status = 'A' WHERE uid = 666465")
+		require.NoError(t, err)
+		require.NoError(t, h.Rollback())
+		assert.Equal(t, ibgames.AccountCancelled, status())
+
+		c.Invalidate(666465)
+		assert.Equal(t, ibgames.AccountActive, status())
+
+		cancel()
+		c.InvalidateAll()
+		assert.Equal(t, ibgames.AccountCancelled, status())
+	})
+
+	t.Run("caches missing accounts", func(t *testing.T) {
+		s, err := c.Get(ctx, 999999)
+		require.NoError(t, err)
+		assert.Equal(t, ibgames.AccountNotFound, s.Status)
+
+		setup.CreateTestAccount(t, 999999, "Latecomer", "N", 0)
+		require.NoError(t, h.Rollback())
+		s, err = c.Get(ctx, 999999)
+		require.NoError(t, err)
+		assert.Equal(t, ibgames.AccountNotFound, s.Status)
+	})
+}
@@ -0,0 +1,71 @@
+package accounts
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nosborn/ibgames-1999"
+	"github.com/nosborn/ibgames-1999/db"
+)
+
+// Update writes every column of a except minutes back to its row in the
+// accounts table, first setting a.NameKey and a.EmailKey from a.Name and
+// a.Email. The balance is only changed by billing's relative updates, so that
+// a read-modify-write here can't undo charges made since a was read. An invalid
+// LastLoginAddr or LastFailureAddr writes back LastLoginIP or LastFailureIP.
+// It returns ErrNotFound if there is no account a.UID.
+//
+// The change is made in h's auto-transaction and isn't committed.
+func Update(ctx context.Context, h *db.Handle, a *Account) error {
+	switch a.Status {
+	case ibgames.AccountActive, ibgames.AccountSuspended, ibgames.AccountCancelled:
+	default:
+		return fmt.Errorf("account %d: bad status %v", a.UID, a.Status)
+	}
+
+	a.NameKey = NameKey(a.Name)
+	a.EmailKey = EmailKey(a.Email)
+
+	var expire any
+	if a.Expire > 0 {
+		expire = int64(a.Expire / time.Minute)
+	}
+	var email, emailKey any
+	if a.Email != "" {
+		email, emailKey = a.Email, a.EmailKey
+	}
+	var reason any
+	if a.StatusReason != "" {
+		reason = a.StatusReason
+	}
+
+	const stmt = `
+		UPDATE accounts
+		SET name = ?, name_key = ?, encrypt = ?, schange = ?, acct_expire = ?,
+			slogin = ?, ulogin = ?, sucip = ?, nunsuclog = ?, unsucip = ?,
+			email = ?, email_key = ?, signup = ?, status = ?,
+			complimentary = ?, admin_uid = ?, admin_date = ?,
+			bulk_mail = ?, bad_check = ?, buddy_uid = ?, buddy_payment = ?,
+			status_reason = ?
+		WHERE uid = ?`
+	result, err := h.ExecContext(ctx, stmt,
+		a.Name, a.NameKey, a.Encrypt, formatTime(a.PasswordChanged, time.DateTime), expire,
+		formatTime(a.LastLogin, time.DateTime), formatTime(a.LastFailure, time.DateTime),
+		formatAddr(a.LastLoginAddr, a.LastLoginIP), a.Failures, formatAddr(a.LastFailureAddr, a.LastFailureIP),
+		email, emailKey, formatTime(a.Signup, time.DateOnly), string(rune(a.Status)),
+		flag(a.Complimentary), nullUID(a.AdminUID), formatTime(a.AdminDate, time.DateOnly),
+		flag(a.BulkMail), flag(a.BadCheck), nullUID(a.BuddyUID), flag(a.BuddyPayment),
+		reason, a.UID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package accounts
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nosborn/ibgames-1999"
+)
+
+func TestUpdate(t *testing.T) {
+	setup, h := setupAccountsTest(t)
+	ctx := context.Background()
+	setup.CreateTestAccount(t, 666420, "Admin", "Y", 0)
+	setup.CreateTestAccount(t, 666421, "Player", "N", 10)
+
+	a, err := Get(ctx, h, 666421)
+	require.NoError(t, err)
+
+	a.Name = "New Name"
+	a.Email = "New@Example.com"
+	a.Status = ibgames.AccountSuspended
+	a.StatusReason = "Chargeback"
+	a.Complimentary = true
+	a.Minutes = 99 // Not written
+	a.LastLogin = time.Date(1999, 6, 1, 12, 0, 0, 0, time.UTC)
+	a.LastLoginAddr = netip.MustParseAddr("198.51.100.7")
+	a.Expire = 3 * 24 * time.Hour
+	a.AdminUID = 666420
+	a.AdminDate = time.Date(1999, 6, 2, 0, 0, 0, 0, time.UTC)
+	a.BulkMail = false
+	require.NoError(t, Update(ctx, h, a))
+	assert.Equal(t, "newname", a.NameKey)
+	assert.Equal(t, "new@example.com", a.EmailKey)
+	require.NoError(t, h.Commit())
+
+	got, err := Get(ctx, h, 666421)
+	require.NoError(t, err)
+	assert.Equal(t, 10, got.Minutes)
+	a.Minutes = 10
+	assert.Equal(t, a, got)
+
+	// The columns are stored the way the other programs expect.
+	var status, complimentary, slogin, bulkMail string
+	var acctExpire int
+	err = setup.TestDB.QueryRow(
+		"SELECT status, complimentary, slogin, acct_expire, bulk_mail FROM accounts WHERE uid = 666421").
+		Scan(&status, &complimentary, &slogin, &acctExpire, &bulkMail)
+	require.NoError(t, err)
+	assert.Equal(t, "S", status)
+	assert.Equal(t, "Y", complimentary)
+	assert.Equal(t, "1999-06-01 12:00:00", slogin)
+	assert.Equal(t, 3*24*60, acctExpire)
+	assert.Equal(t, "N", bulkMail)
+
+	t.Run("missing account", func(t *testing.T) {
+		err := Update(ctx, h, &Account{UID: 999999, Name: "x", Status: ibgames.AccountActive})
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("bad status", func(t *testing.T) {
+		a := *got
+		a.Status = 'Q'
+		assert.Error(t, Update(ctx, h, &a))
+	})
+}
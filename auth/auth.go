@@ -31,6 +31,17 @@ const (
 	LoginIncorrect                    // Name or password wrong
 	LoginNoCredit                     // Account has no credit
 	LoginSuspended                    // Account has been suspended
+	LoginForbidden                    // Administrator account can't impersonate
+)
+
+type RenameResult int
+
+const (
+	RenameOK       RenameResult = iota // Account renamed
+	RenameError                        // Catch-all internal error
+	RenameInvalid                      // New name is not acceptable
+	RenameNotFound                     // No such account
+	RenameTaken                        // New name is in use or reserved
 )
 
 type Session struct {
@@ -39,4 +50,7 @@ type Session struct {
 	ULogin  string
 	SucIP   string
 	UnsucIP string
+
+	Impersonated bool              // Opened by an administrator with Impersonate
+	AdminUID     ibgames.AccountID // Administrator, if Impersonated
 }
@@ -1,20 +1,38 @@
 package auth
 
 import (
+	"context"
 	"database/sql"
 	"net"
 	"time"
 
 	"github.com/nosborn/ibgames-1999"
+	"github.com/nosborn/ibgames-1999/config"
 	"github.com/nosborn/ibgames-1999/db"
 )
 
-func GetCookie(sid string, _ net.Addr, uidp *ibgames.AccountID) CookieResult {
+func GetCookie(sid string, addr net.Addr, uidp *ibgames.AccountID) CookieResult {
+	return GetCookieWithContext(context.Background(), db.Default(), sid, addr, uidp)
+}
+
+// GetCookieContext is like GetCookie but uses ctx for its database operations.
+func GetCookieContext(ctx context.Context, sid string, addr net.Addr, uidp *ibgames.AccountID) CookieResult {
+	return GetCookieWithContext(ctx, db.Default(), sid, addr, uidp)
+}
+
+// GetCookieWith is like GetCookie but uses the database handle h.
+func GetCookieWith(h *db.Handle, sid string, addr net.Addr, uidp *ibgames.AccountID) CookieResult {
+	return GetCookieWithContext(context.Background(), h, sid, addr, uidp)
+}
+
+// GetCookieWithContext is like GetCookieWith but uses ctx for its database
+// operations.
+func GetCookieWithContext(ctx context.Context, h *db.Handle, sid string, _ net.Addr, uidp *ibgames.AccountID) CookieResult {
 	*uidp = ibgames.AccountID(0)
 
 	var uid ibgames.AccountID
 	var expire int64
-	err := db.QueryRow("SELECT uid, expire FROM cookies WHERE sid = ?", sid).Scan(&uid, &expire)
+	err := h.QueryRowContext(ctx, "SELECT uid, expire FROM cookies WHERE sid = ?", sid).Scan(&uid, &expire)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return CookieNotFound
@@ -25,16 +43,16 @@ func GetCookie(sid string, _ net.Addr, uidp *ibgames.AccountID) CookieResult {
 	now := time.Now().Unix()
 
 	if expire < now {
-		_, err = db.Exec("DELETE FROM cookies WHERE sid = ?", sid)
+		_, err = h.ExecContext(ctx, "DELETE FROM cookies WHERE sid = ?", sid)
 		if err != nil {
 			return CookieError
 		}
 		return CookieNotFound
 	}
 
-	expire = now + (30 * 60)
+	expire = now + int64(config.Get().CookieLifetime/time.Second)
 
-	_, err = db.Exec("UPDATE cookies SET expire = ? WHERE sid = ?", expire, sid)
+	_, err = h.ExecContext(ctx, "UPDATE cookies SET expire = ? WHERE sid = ?", expire, sid)
 	if err != nil {
 		return CookieError
 	}
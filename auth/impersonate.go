@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/nosborn/ibgames-1999"
+	"github.com/nosborn/ibgames-1999/accounts"
+	"github.com/nosborn/ibgames-1999/db"
+)
+
+// Impersonate opens a session on account uid for the administrator adminUID
+// without needing the player's password, so that support staff can see exactly
+// what the player sees. As with admin_uid elsewhere, adminUID is the
+// administrator's own account, and deciding who may act as an administrator is
+// up to the caller. The account must be active and mustn't be uid itself.
+//
+// The result is the one Login would give the player, except that lockouts are
+// ignored and LoginForbidden is returned if adminUID can't be used. Login hooks
+// are told of the outcome with the administrator in AdminUID. The player's
+// slogin and sucip are left alone. When a session is opened, an audit record
+// naming the administrator is written in the auto-transaction; it isn't
+// committed.
+func Impersonate(adminUID, uid ibgames.AccountID, addr string, session *Session) LoginResult {
+	return ImpersonateWithContext(context.Background(), db.Default(), adminUID, uid, addr, session)
+}
+
+// ImpersonateContext is like Impersonate but uses ctx for its database
+// operations.
+func ImpersonateContext(ctx context.Context, adminUID, uid ibgames.AccountID, addr string, session *Session) LoginResult {
+	return ImpersonateWithContext(ctx, db.Default(), adminUID, uid, addr, session)
+}
+
+// ImpersonateWith is like Impersonate but uses the database handle h.
+func ImpersonateWith(h *db.Handle, adminUID, uid ibgames.AccountID, addr string, session *Session) LoginResult {
+	return ImpersonateWithContext(context.Background(), h, adminUID, uid, addr, session)
+}
+
+// ImpersonateWithContext is like ImpersonateWith but uses ctx for its database
+// operations.
+func ImpersonateWithContext(ctx context.Context, h *db.Handle, adminUID, uid ibgames.AccountID, addr string, session *Session) LoginResult {
+	if adminUID == uid {
+		log.Printf("Impersonation of %d refused for %d", uid, adminUID)
+		return notifyImpersonation(OutcomeFailure, LoginForbidden, adminUID, uid, "", addr)
+	}
+
+	admin, err := accounts.GetStatus(ctx, h, adminUID)
+	if err != nil {
+		return LoginError
+	}
+	if !admin.Usable() {
+		log.Printf("Impersonation of %d refused for %d", uid, adminUID)
+		return notifyImpersonation(OutcomeFailure, LoginForbidden, adminUID, uid, "", addr)
+	}
+
+	a, err := accounts.Get(ctx, h, uid)
+	if err != nil {
+		if errors.Is(err, accounts.ErrNotFound) {
+			return notifyImpersonation(OutcomeFailure, LoginIncorrect, adminUID, uid, "", addr)
+		}
+		return LoginError // Includes a status that's something else!?
+	}
+
+	switch a.Status {
+	case ibgames.AccountActive:
+	case ibgames.AccountSuspended:
+		return notifyImpersonation(OutcomeSuspended, LoginSuspended, adminUID, uid, a.Name, addr)
+	case ibgames.AccountCancelled:
+		return notifyImpersonation(OutcomeFailure, LoginIncorrect, adminUID, uid, a.Name, addr)
+	}
+
+	const auditStmt = `
+		INSERT INTO impersonations (admin_uid, uid, ip_address)
+		VALUES (?, ?, ?)`
+	if _, err := h.ExecContext(ctx, auditStmt, adminUID, uid, formatAddr(parseAddr(addr), "")); err != nil {
+		return LoginError
+	}
+	log.Printf("Account %d impersonated by %d", uid, adminUID)
+
+	// Pass back the session details as the player would see them.
+	setSession(session, a)
+	session.Impersonated = true
+	session.AdminUID = adminUID
+
+	if !a.Complimentary && a.Minutes <= 0 {
+		return notifyImpersonation(OutcomeNoCredit, LoginNoCredit, adminUID, uid, a.Name, addr)
+	}
+	return notifyImpersonation(OutcomeSuccess, LoginOK, adminUID, uid, a.Name, addr)
+}
+
+func notifyImpersonation(outcome LoginOutcome, result LoginResult, adminUID, uid ibgames.AccountID, name, addr string) LoginResult {
+	notify(LoginEvent{
+		Outcome:  outcome,
+		Result:   result,
+		UID:      uid,
+		Name:     name,
+		Addr:     addr,
+		AdminUID: adminUID,
+	})
+	return result
+}
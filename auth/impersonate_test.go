@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nosborn/ibgames-1999"
+	"github.com/nosborn/ibgames-1999/db"
+	"github.com/nosborn/ibgames-1999/internal/testutil"
+)
+
+func countImpersonations(t *testing.T, setup *testutil.DatabaseSetup, uid ibgames.AccountID) int {
+	var n int
+	err := setup.TestDB.QueryRow("SELECT COUNT(*) FROM impersonations WHERE uid = ?", uid).Scan(&n)
+	require.NoError(t, err)
+	return n
+}
+
+func TestImpersonate(t *testing.T) {
+	t.Run("admin opens impersonated session", func(t *testing.T) {
+		setup := setupAuthTest(t)
+		adminUID := ibgames.AccountID(666300)
+		uid := ibgames.AccountID(666301)
+		setup.CreateTestAccount(t, adminUID, "support1", "Y", 0)
+		setup.CreateTestAccount(t, uid, "player1", "N", 100)
+		_, err := setup.TestDB.Exec(
+			"UPDATE accounts SET slogin = '1999-03-15 14:30:00', sucip = '192.0.2.9' WHERE uid = ?", uid)
+		require.NoError(t, err)
+
+		var session Session
+		result := Impersonate(adminUID, uid, "198.51.100.1", &session)
+
+		require.Equal(t, LoginOK, result)
+		assert.Equal(t, uid, session.UID)
+		assert.True(t, session.Impersonated)
+		assert.Equal(t, adminUID, session.AdminUID)
+		assert.Equal(t, "1999-03-15 14:30:00", session.SLogin)
+		assert.Equal(t, "NEVER", session.ULogin)
+		assert.Equal(t, "192.0.2.9", session.SucIP)
+
+		// The audit record is left for the caller to commit.
+		assert.Zero(t, countImpersonations(t, setup, uid))
+		require.NoError(t, db.Commit())
+
+		// The player's own login details are untouched.
+		var slogin, sucip string
+		err = setup.TestDB.QueryRow("SELECT slogin, sucip FROM accounts WHERE uid = ?", uid).Scan(&slogin, &sucip)
+		require.NoError(t, err)
+		assert.Equal(t, "1999-03-15 14:30:00", slogin)
+		assert.Equal(t, "192.0.2.9", sucip)
+
+		var auditAdmin ibgames.AccountID
+		var auditIP string
+		err = setup.TestDB.QueryRow(
+			"SELECT admin_uid, ip_address FROM impersonations WHERE uid = ?", uid).Scan(&auditAdmin, &auditIP)
+		require.NoError(t, err)
+		assert.Equal(t, adminUID, auditAdmin)
+		assert.Equal(t, "198.51.100.1", auditIP)
+	})
+
+	t.Run("refuses missing, inactive and same accounts", func(t *testing.T) {
+		setup := setupAuthTest(t)
+		adminUID := ibgames.AccountID(666302)
+		uid := ibgames.AccountID(666303)
+		setup.CreateTestAccount(t, adminUID, "support2", "Y", 0)
+		setup.CreateTestAccount(t, uid, "player2", "N", 100)
+		_, err := setup.TestDB.Exec("UPDATE accounts SET status = 'S' WHERE uid = ?", adminUID)
+		require.NoError(t, err)
+
+		var session Session
+		assert.Equal(t, LoginForbidden, Impersonate(adminUID, uid, "198.51.100.1", &session))
+		assert.Equal(t, LoginForbidden, Impersonate(999999, uid, "198.51.100.1", &session))
+		assert.Equal(t, LoginForbidden, Impersonate(uid, uid, "198.51.100.1", &session))
+		assert.Zero(t, session.UID)
+
+		require.NoError(t, db.Commit())
+		assert.Zero(t, countImpersonations(t, setup, uid))
+	})
+
+	t.Run("reports player's account state", func(t *testing.T) {
+		setup := setupAuthTest(t)
+		adminUID := ibgames.AccountID(666306)
+		setup.CreateTestAccount(t, adminUID, "support3", "Y", 0)
+		setup.CreateTestAccount(t, 666307, "broke", "N", 0)
+		setup.CreateTestAccount(t, 666308, "naughty", "N", 100)
+		setup.CreateTestAccount(t, 666309, "departed", "N", 100)
+		_, err := setup.TestDB.Exec("UPDATE accounts SET status = 'S' WHERE uid = 666308")
+		require.NoError(t, err)
+		_, err = setup.TestDB.Exec("UPDATE accounts SET status = 'X' WHERE uid = 666309")
+		require.NoError(t, err)
+
+		var session Session
+		assert.Equal(t, LoginNoCredit, Impersonate(adminUID, 666307, "198.51.100.1", &session))
+		assert.True(t, session.Impersonated)
+
+		session = Session{}
+		assert.Equal(t, LoginSuspended, Impersonate(adminUID, 666308, "198.51.100.1", &session))
+		assert.Zero(t, session.UID)
+		assert.Equal(t, LoginIncorrect, Impersonate(adminUID, 666309, "198.51.100.1", &session))
+		assert.Equal(t, LoginIncorrect, Impersonate(adminUID, 999999, "198.51.100.1", &session))
+
+		require.NoError(t, db.Commit())
+		assert.Equal(t, 1, countImpersonations(t, setup, 666307))
+		assert.Zero(t, countImpersonations(t, setup, 666308))
+		assert.Zero(t, countImpersonations(t, setup, 666309))
+	})
+}
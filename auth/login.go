@@ -1,17 +1,36 @@
 package auth
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"log"
 	"math"
+	"net/netip"
 	"strings"
+	"time"
 
 	"github.com/nosborn/ibgames-1999"
+	"github.com/nosborn/ibgames-1999/accounts"
 	"github.com/nosborn/ibgames-1999/db"
 	"golang.org/x/crypto/bcrypt"
 )
 
 func Login(name, password, addr string, session *Session) LoginResult {
+	return LoginWithContext(context.Background(), db.Default(), name, password, addr, session)
+}
+
+// LoginContext is like Login but uses ctx for its database operations.
+func LoginContext(ctx context.Context, name, password, addr string, session *Session) LoginResult {
+	return LoginWithContext(ctx, db.Default(), name, password, addr, session)
+}
+
+// LoginWith is like Login but uses the database handle h.
+func LoginWith(h *db.Handle, name, password, addr string, session *Session) LoginResult {
+	return LoginWithContext(context.Background(), h, name, password, addr, session)
+}
+
+// LoginWithContext is like LoginWith but uses ctx for its database operations.
+func LoginWithContext(ctx context.Context, h *db.Handle, name, password, addr string, session *Session) LoginResult {
 	// Basic parameter sanity checking.
 	if name == "" || password == "" {
 		log.Print("Bad parameters to auth.Login")
@@ -36,49 +55,32 @@ func Login(name, password, addr string, session *Session) LoginResult {
 		return LoginError
 	}
 
-	var (
-		uid           ibgames.AccountID
-		encrypt       string
-		slogin        sql.NullString
-		ulogin        sql.NullString
-		sucip         sql.NullString
-		nunsuclog     int
-		unsucip       sql.NullString
-		complimentary string
-		status        string
-		minutes       int
-	)
-
-	const query = `
-		SELECT uid, encrypt, slogin, ulogin, sucip, nunsuclog, unsucip, complimentary, status, minutes
-                FROM accounts
-                WHERE name_key = ?`
-	err := db.QueryRow(query, UniqueName(name)).Scan(
-		&uid, &encrypt, &slogin, &ulogin, &sucip, &nunsuclog, &unsucip, &complimentary, &status, &minutes)
+	a, err := accounts.GetByName(ctx, h, name)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return LoginIncorrect
+		if errors.Is(err, accounts.ErrNotFound) {
+			return notifyLogin(OutcomeFailure, LoginIncorrect, 0, name, addr)
 		}
-		return LoginError
+		return LoginError // Includes a status that's something else!?
 	}
+	uid := a.UID
 
-	switch status {
-	case "A": // Active
-	case "S": // Suspended - reject it later
-	case "X": // Canceled
-		return LoginIncorrect
-	default: /* Something else!? */
-		return LoginError
+	switch a.Status {
+	case ibgames.AccountActive:
+	case ibgames.AccountSuspended: // Reject it later
+	case ibgames.AccountCancelled:
+		return notifyLogin(OutcomeFailure, LoginIncorrect, uid, name, addr)
 	}
 
 	//
 	// dtcurrent(&now);
 	// ip_address = inet_ntoa(addr);
+	ip := parseAddr(addr)
 
 	//
-	if bcrypt.CompareHashAndPassword([]byte(encrypt), []byte(password)) != nil {
+	if bcrypt.CompareHashAndPassword([]byte(a.Encrypt), []byte(password)) != nil {
 		log.Printf("Wrong password for %s", name)
 
+		nunsuclog := a.Failures
 		if nunsuclog < math.MaxInt16 {
 			nunsuclog++
 		}
@@ -87,7 +89,7 @@ func Login(name, password, addr string, session *Session) LoginResult {
 			UPDATE accounts
 			SET ulogin = CURRENT_TIMESTAMP, nunsuclog = ?, unsucip = ?
 			WHERE uid = ?`
-		result, err := db.Exec(query, nunsuclog, addr, uid)
+		result, err := h.ExecContext(ctx, query, nunsuclog, nullAddr(ip), uid)
 		if err != nil {
 			return LoginError
 		}
@@ -95,22 +97,22 @@ func Login(name, password, addr string, session *Session) LoginResult {
 			return LoginError
 		}
 
-		return LoginIncorrect
+		return notifyLogin(OutcomeFailure, LoginIncorrect, uid, name, addr)
 	}
 
 	// Now we can reject suspended accounts. This could be (== 'S') but (!=
 	// 'A') is safer; anything other than Active or Suspended should have
 	// been dealt with before here.
-	if status != "A" {
-		return LoginSuspended
+	if a.Status != ibgames.AccountActive {
+		return notifyLogin(OutcomeSuspended, LoginSuspended, uid, name, addr)
 	}
 
 	// If there have been too many unsuccessful password attempts then
 	// we're not letting them in even though they got it right this time.
 	// There's no need to update anything on the account record for this.
-	if nunsuclog >= maxPasswordTries {
+	if a.Failures >= maxPasswordTries {
 		log.Printf("Too many password failures for %s", name)
-		return LoginIncorrect
+		return notifyLogin(OutcomeLockout, LoginIncorrect, uid, name, addr)
 	}
 
 	// Update the account to reflect a successful login.
@@ -118,7 +120,7 @@ func Login(name, password, addr string, session *Session) LoginResult {
 		UPDATE accounts
 		SET slogin = CURRENT_TIMESTAMP, sucip = ?, nunsuclog = 0
 		WHERE uid = ?`
-	result, err := db.Exec(updateStmt, addr, uid)
+	result, err := h.ExecContext(ctx, updateStmt, nullAddr(ip), uid)
 	if err != nil {
 		return LoginError
 	}
@@ -127,30 +129,57 @@ func Login(name, password, addr string, session *Session) LoginResult {
 	}
 
 	// Pass back the session details.
-	session.UID = uid
+	setSession(session, a)
 
-	session.SucIP = sucip.String
-	session.UnsucIP = unsucip.String
+	if !a.Complimentary && a.Minutes <= 0 {
+		return notifyLogin(OutcomeNoCredit, LoginNoCredit, uid, name, addr)
+	}
+	return notifyLogin(OutcomeSuccess, LoginOK, uid, name, addr)
+}
+
+// setSession passes back the details of account a as its player would see
+// them, before this login changed them.
+func setSession(session *Session, a *accounts.Account) {
+	session.UID = a.UID
+	session.SucIP = formatAddr(a.LastLoginAddr, a.LastLoginIP)
+	session.UnsucIP = formatAddr(a.LastFailureAddr, a.LastFailureIP)
+	session.SLogin = formatLogin(a.LastLogin)
+	session.ULogin = formatLogin(a.LastFailure)
+}
 
-	if slogin.Valid {
-		session.SLogin = slogin.String
-	} else {
-		session.SLogin = "NEVER"
+func formatLogin(t time.Time) string {
+	if t.IsZero() {
+		return "NEVER"
 	}
-	// else {
-	//	-- reformat
-	// }
-	if ulogin.Valid {
-		session.ULogin = ulogin.String
-	} else {
-		session.ULogin = "NEVER"
+	return t.Format(time.DateTime)
+}
+
+// formatAddr returns addr as a string, or stored if addr is invalid.
+func formatAddr(addr netip.Addr, stored string) string {
+	if !addr.IsValid() {
+		return stored
 	}
-	// else {
-	//	-- reformat
-	// }
+	return addr.String()
+}
+
+// parseAddr returns the IP address in addr, which may have a port, or the
+// zero Addr if it isn't one. Callers pass whatever their listener reported.
+func parseAddr(addr string) netip.Addr {
+	addr = strings.TrimSpace(addr)
+	if ip, err := netip.ParseAddr(addr); err == nil {
+		return ip.Unmap()
+	}
+	if ap, err := netip.ParseAddrPort(addr); err == nil {
+		return ap.Addr().Unmap()
+	}
+	log.Printf("Bad address %q", addr)
+	return netip.Addr{}
+}
 
-	if complimentary != "Y" && minutes <= 0 {
-		return LoginNoCredit
+// nullAddr returns addr for a column, or nil for NULL if it isn't valid.
+func nullAddr(addr netip.Addr) any {
+	if !addr.IsValid() {
+		return nil
 	}
-	return LoginOK
+	return addr.String()
 }
@@ -1,6 +1,9 @@
 package auth
 
 import (
+	"context"
+	"database/sql"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -55,6 +58,39 @@ func TestLogin(t *testing.T) {
 		assert.Equal(t, "NEVER", session.ULogin)
 	})
 
+	t.Run("addresses that aren't IP addresses", func(t *testing.T) {
+		setup := setupAuthTest(t)
+		uid := ibgames.AccountID(666008)
+		password := "testpass123"
+		hash, err := PasswordHash(password)
+		require.NoError(t, err)
+		_, err = setup.TestDB.Exec(`
+			INSERT INTO accounts (uid, name, name_key, encrypt, status, complimentary, minutes, sucip)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, uid, "legacy", "legacy", hash, "A", "N", 100, "dialup.example.com")
+		require.NoError(t, err)
+
+		// A legacy value is shown as it was stored.
+		var session Session
+		require.Equal(t, LoginOK, Login("legacy", password, "198.51.100.2:4000", &session))
+		assert.Equal(t, "dialup.example.com", session.SucIP)
+		require.NoError(t, db.Commit())
+
+		var sucip sql.NullString
+		require.NoError(t, setup.TestDB.QueryRow("SELECT sucip FROM accounts WHERE uid = ?", uid).Scan(&sucip))
+		assert.Equal(t, "198.51.100.2", sucip.String)
+
+		// Anything else isn't stored, and doesn't stop the next login.
+		require.Equal(t, LoginIncorrect, Login("legacy", "wrong", "not an address", &session))
+		require.Equal(t, LoginOK, Login("legacy", password, "010.000.000.001", &session))
+		require.NoError(t, db.Commit())
+		require.NoError(t, setup.TestDB.QueryRow("SELECT sucip FROM accounts WHERE uid = ?", uid).Scan(&sucip))
+		assert.False(t, sucip.Valid)
+		require.Equal(t, LoginOK, Login("legacy", password, "192.0.2.1", &session))
+		assert.Empty(t, session.SucIP)
+		assert.Empty(t, session.UnsucIP)
+	})
+
 	t.Run("login fails for non-existent user", func(t *testing.T) {
 		setup := setupAuthTest(t)
 		_ = setup // Keep linter happy
@@ -299,3 +335,58 @@ func TestLoginParameterValidation(t *testing.T) {
 		}
 	})
 }
+
+func TestLoginWith(t *testing.T) {
+	// A private database, independent of the one used by the other tests.
+	setup := testutil.SetupTestDatabaseWithSchema(t)
+	h, err := db.Open(filepath.Dir(setup.FilePath), false)
+	require.NoError(t, err)
+	t.Cleanup(h.Abandon)
+
+	uid := ibgames.AccountID(666009)
+	password := "testpass123"
+	hash, err := PasswordHash(password)
+	require.NoError(t, err)
+
+	_, err = setup.TestDB.Exec(`
+		INSERT INTO accounts (uid, name, name_key, encrypt, status, complimentary, minutes)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, uid, "handleuser", "handleuser", hash, "A", "N", 100)
+	require.NoError(t, err)
+
+	var session Session
+	result := LoginWith(h, "handleuser", password, "192.0.2.1", &session)
+
+	assert.Equal(t, LoginOK, result)
+	assert.Equal(t, uid, session.UID)
+}
+
+func TestLoginContext(t *testing.T) {
+	setup := setupAuthTest(t)
+	uid := ibgames.AccountID(666010)
+	password := "testpass123"
+	hash, err := PasswordHash(password)
+	require.NoError(t, err)
+
+	_, err = setup.TestDB.Exec(`
+		INSERT INTO accounts (uid, name, name_key, encrypt, status, complimentary, minutes)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, uid, "contextuser", "contextuser", hash, "A", "N", 100)
+	require.NoError(t, err)
+
+	t.Run("succeeds with live context", func(t *testing.T) {
+		var session Session
+		result := LoginContext(context.Background(), "contextuser", password, "192.0.2.1", &session)
+		assert.Equal(t, LoginOK, result)
+		assert.Equal(t, uid, session.UID)
+	})
+
+	t.Run("fails with canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		var session Session
+		result := LoginContext(ctx, "contextuser", password, "192.0.2.1", &session)
+		assert.Equal(t, LoginError, result)
+	})
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nosborn/ibgames-1999"
+)
+
+type LoginOutcome int
+
+const (
+	OutcomeSuccess   LoginOutcome = iota // Password accepted, session created
+	OutcomeFailure                       // Unknown name, wrong password, canceled account or impersonation refused
+	OutcomeLockout                       // Correct password after too many failures
+	OutcomeSuspended                     // Correct password for a suspended account
+	OutcomeNoCredit                      // Session created but account has no credit
+)
+
+// LoginEvent describes the outcome of a call to Login or Impersonate. UID is
+// zero if the name didn't match any account.
+type LoginEvent struct {
+	Outcome  LoginOutcome
+	Result   LoginResult
+	UID      ibgames.AccountID
+	Name     string
+	Addr     string
+	AdminUID ibgames.AccountID // Administrator, for Impersonate
+}
+
+// LoginHook observes login attempts. Each hook has a goroutine of its own
+// that it is called on after the outcome is known, so a slow or panicking
+// hook can't delay or break authentication, or hold up the other hooks. A
+// hook sees events in the order they happened. If it falls more than
+// loginHookQueue events behind, further events are dropped for it and
+// counted by DroppedLoginEvents.
+type LoginHook func(LoginEvent)
+
+const loginHookQueue = 100
+
+type loginHook struct {
+	fn     LoginHook
+	events chan LoginEvent
+}
+
+var (
+	loginHooks   []*loginHook // In the order they were added
+	loginHooksMu sync.RWMutex
+	droppedLogin atomic.Int64
+)
+
+// AddLoginHook registers hook to be called for every login outcome. The
+// returned function unregisters it. Events already queued for the hook are
+// still delivered.
+func AddLoginHook(hook LoginHook) (remove func()) {
+	h := &loginHook{fn: hook, events: make(chan LoginEvent, loginHookQueue)}
+	go h.run()
+
+	loginHooksMu.Lock()
+	defer loginHooksMu.Unlock()
+	loginHooks = append(loginHooks, h)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			loginHooksMu.Lock()
+			defer loginHooksMu.Unlock()
+			loginHooks = slices.DeleteFunc(loginHooks, func(other *loginHook) bool { return other == h })
+			close(h.events)
+		})
+	}
+}
+
+// DroppedLoginEvents returns the number of events that have been dropped
+// because a hook's queue was full.
+func DroppedLoginEvents() int64 {
+	return droppedLogin.Load()
+}
+
+func notifyLogin(outcome LoginOutcome, result LoginResult, uid ibgames.AccountID, name, addr string) LoginResult {
+	notify(LoginEvent{
+		Outcome: outcome,
+		Result:  result,
+		UID:     uid,
+		Name:    name,
+		Addr:    addr,
+	})
+	return result
+}
+
+// notify queues ev for every hook.
+func notify(ev LoginEvent) {
+	loginHooksMu.RLock()
+	defer loginHooksMu.RUnlock()
+
+	for _, h := range loginHooks {
+		select {
+		case h.events <- ev:
+		default:
+			droppedLogin.Add(1)
+		}
+	}
+}
+
+func (h *loginHook) run() {
+	for ev := range h.events {
+		runLoginHook(h.fn, ev)
+	}
+}
+
+func runLoginHook(hook LoginHook, ev LoginEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Login hook panicked: %v", r)
+		}
+	}()
+	hook(ev)
+}
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nosborn/ibgames-1999"
+	"github.com/nosborn/ibgames-1999/db"
+)
+
+func collectLoginEvents(t *testing.T) <-chan LoginEvent {
+	events := make(chan LoginEvent, 10)
+	remove := AddLoginHook(func(ev LoginEvent) {
+		events <- ev
+	})
+	t.Cleanup(remove)
+	return events
+}
+
+func nextLoginEvent(t *testing.T, events <-chan LoginEvent) LoginEvent {
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for login hook")
+		return LoginEvent{}
+	}
+}
+
+func TestLoginHooks(t *testing.T) {
+	t.Run("reports successful login", func(t *testing.T) {
+		setup := setupAuthTest(t)
+		events := collectLoginEvents(t)
+
+		uid := ibgames.AccountID(666200)
+		hash, err := PasswordHash("hookpass")
+		require.NoError(t, err)
+		_, err = setup.TestDB.Exec(`
+			INSERT INTO accounts (uid, name, name_key, encrypt, status, complimentary, minutes)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, uid, "hookuser", "hookuser", hash, "A", "N", 100)
+		require.NoError(t, err)
+
+		var session Session
+		require.Equal(t, LoginOK, Login("HookUser", "hookpass", "192.0.2.1", &session))
+
+		ev := nextLoginEvent(t, events)
+		assert.Equal(t, OutcomeSuccess, ev.Outcome)
+		assert.Equal(t, LoginOK, ev.Result)
+		assert.Equal(t, uid, ev.UID)
+		assert.Equal(t, "HookUser", ev.Name)
+		assert.Equal(t, "192.0.2.1", ev.Addr)
+	})
+
+	t.Run("reports unknown name as failure", func(t *testing.T) {
+		setupAuthTest(t)
+		events := collectLoginEvents(t)
+
+		var session Session
+		require.Equal(t, LoginIncorrect, Login("nosuchhookuser", "password", "192.0.2.2", &session))
+
+		ev := nextLoginEvent(t, events)
+		assert.Equal(t, OutcomeFailure, ev.Outcome)
+		assert.Equal(t, ibgames.AccountID(0), ev.UID)
+	})
+
+	t.Run("reports lockout, suspension and no credit", func(t *testing.T) {
+		setup := setupAuthTest(t)
+		events := collectLoginEvents(t)
+
+		hash, err := PasswordHash("hookpass")
+		require.NoError(t, err)
+		_, err = setup.TestDB.Exec(`
+			INSERT INTO accounts (uid, name, name_key, encrypt, status, complimentary, minutes, nunsuclog)
+			VALUES (666201, 'hooklocked', 'hooklocked', ?1, 'A', 'N', 100, ?2),
+			       (666202, 'hooksuspended', 'hooksuspended', ?1, 'S', 'N', 100, 0),
+			       (666203, 'hookbroke', 'hookbroke', ?1, 'A', 'N', 0, 0)
+		`, hash, maxPasswordTries)
+		require.NoError(t, err)
+
+		var session Session
+		require.Equal(t, LoginIncorrect, Login("hooklocked", "hookpass", "192.0.2.3", &session))
+		assert.Equal(t, OutcomeLockout, nextLoginEvent(t, events).Outcome)
+
+		require.Equal(t, LoginSuspended, Login("hooksuspended", "hookpass", "192.0.2.3", &session))
+		assert.Equal(t, OutcomeSuspended, nextLoginEvent(t, events).Outcome)
+
+		require.Equal(t, LoginNoCredit, Login("hookbroke", "hookpass", "192.0.2.3", &session))
+		assert.Equal(t, OutcomeNoCredit, nextLoginEvent(t, events).Outcome)
+	})
+
+	t.Run("slow and panicking hooks don't block login", func(t *testing.T) {
+		setupAuthTest(t)
+
+		release := make(chan struct{})
+		defer close(release)
+		removeSlow := AddLoginHook(func(LoginEvent) { <-release })
+		defer removeSlow()
+		removePanic := AddLoginHook(func(LoginEvent) { panic("hook failure") })
+		defer removePanic()
+
+		done := make(chan LoginResult)
+		go func() {
+			var session Session
+			done <- Login("nosuchhookuser", "password", "192.0.2.4", &session)
+		}()
+
+		select {
+		case result := <-done:
+			assert.Equal(t, LoginIncorrect, result)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "login blocked by hook")
+		}
+	})
+
+	t.Run("removed hooks are not called", func(t *testing.T) {
+		setupAuthTest(t)
+
+		called := make(chan struct{}, 1)
+		remove := AddLoginHook(func(LoginEvent) { called <- struct{}{} })
+		remove()
+
+		var session Session
+		Login("nosuchhookuser", "password", "192.0.2.5", &session)
+
+		select {
+		case <-called:
+			assert.Fail(t, "removed hook was called")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+	t.Run("reports impersonation", func(t *testing.T) {
+		setup := setupAuthTest(t)
+		events := collectLoginEvents(t)
+
+		adminUID := ibgames.AccountID(666204)
+		uid := ibgames.AccountID(666205)
+		setup.CreateTestAccount(t, adminUID, "hookadmin", "Y", 0)
+		setup.CreateTestAccount(t, uid, "hookplayer", "N", 100)
+
+		var session Session
+		require.Equal(t, LoginOK, Impersonate(adminUID, uid, "198.51.100.4", &session))
+		require.NoError(t, db.Commit())
+
+		ev := nextLoginEvent(t, events)
+		assert.Equal(t, OutcomeSuccess, ev.Outcome)
+		assert.Equal(t, uid, ev.UID)
+		assert.Equal(t, "hookplayer", ev.Name)
+		assert.Equal(t, adminUID, ev.AdminUID)
+
+		require.Equal(t, LoginForbidden, Impersonate(999999, uid, "198.51.100.4", &session))
+		ev = nextLoginEvent(t, events)
+		assert.Equal(t, OutcomeFailure, ev.Outcome)
+		assert.Equal(t, LoginForbidden, ev.Result)
+	})
+
+	t.Run("slow hook gets events in order and drops the overflow", func(t *testing.T) {
+		setupAuthTest(t)
+
+		release := make(chan struct{})
+		events := make(chan LoginEvent, 2*loginHookQueue)
+		remove := AddLoginHook(func(ev LoginEvent) {
+			<-release
+			events <- ev
+		})
+		defer remove()
+
+		before := DroppedLoginEvents()
+		const logins = loginHookQueue + 10
+		for i := range logins {
+			var session Session
+			Login(fmt.Sprintf("nosuchhookuser%d", i), "password", "192.0.2.6", &session)
+		}
+		dropped := DroppedLoginEvents() - before
+		assert.GreaterOrEqual(t, dropped, int64(logins-loginHookQueue-1))
+		assert.LessOrEqual(t, dropped, int64(logins-loginHookQueue))
+
+		close(release)
+		last := -1
+		for range logins - int(dropped) {
+			var i int
+			_, err := fmt.Sscanf(nextLoginEvent(t, events).Name, "nosuchhookuser%d", &i)
+			require.NoError(t, err)
+			assert.Greater(t, i, last)
+			last = i
+		}
+	})
+}
@@ -1,9 +1,13 @@
 package auth
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/nosborn/ibgames-1999/config"
+)
 
 func PasswordHash(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), config.Get().BcryptCost)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nosborn/ibgames-1999"
+	"github.com/nosborn/ibgames-1999/accounts"
+	"github.com/nosborn/ibgames-1999/db"
+)
+
+// errRenameRefused unwinds the rename savepoint when rename returns anything
+// other than RenameOK.
+var errRenameRefused = errors.New("rename refused")
+
+// Rename changes the name of an account, recording the old name in
+// name_history. adminUID identifies the administrator making the change, or
+// is zero if the player is renaming themselves. If reserve is positive the old
+// name can't be taken by any other account until that much time has passed.
+//
+// The change is made in the auto-transaction and isn't committed. A rename
+// that fails leaves the transaction as it was.
+func Rename(uid ibgames.AccountID, newName string, adminUID ibgames.AccountID, reserve time.Duration) RenameResult {
+	return RenameWithContext(context.Background(), db.Default(), uid, newName, adminUID, reserve)
+}
+
+// RenameContext is like Rename but uses ctx for its database operations.
+func RenameContext(ctx context.Context, uid ibgames.AccountID, newName string, adminUID ibgames.AccountID, reserve time.Duration) RenameResult {
+	return RenameWithContext(ctx, db.Default(), uid, newName, adminUID, reserve)
+}
+
+// RenameWith is like Rename but uses the database handle h.
+func RenameWith(h *db.Handle, uid ibgames.AccountID, newName string, adminUID ibgames.AccountID, reserve time.Duration) RenameResult {
+	return RenameWithContext(context.Background(), h, uid, newName, adminUID, reserve)
+}
+
+// RenameWithContext is like RenameWith but uses ctx for its database
+// operations.
+func RenameWithContext(ctx context.Context, h *db.Handle, uid ibgames.AccountID, newName string, adminUID ibgames.AccountID, reserve time.Duration) RenameResult {
+	var result RenameResult
+	err := h.WithSavepointContext(ctx, "rename", func() error {
+		result = rename(ctx, h, uid, newName, adminUID, reserve)
+		if result != RenameOK {
+			return errRenameRefused
+		}
+		return nil
+	})
+	switch {
+	case err == nil:
+		return RenameOK
+	case errors.Is(err, errRenameRefused):
+		return result
+	default:
+		log.Printf("auth.Rename: %v", err)
+		return RenameError
+	}
+}
+
+func rename(ctx context.Context, h *db.Handle, uid ibgames.AccountID, newName string, adminUID ibgames.AccountID, reserve time.Duration) RenameResult {
+	newName = strings.TrimSpace(newName)
+	if !ValidName(newName) {
+		return RenameInvalid
+	}
+	newKey := accounts.NameKey(newName)
+
+	a, err := accounts.Get(ctx, h, uid)
+	if err != nil {
+		if errors.Is(err, accounts.ErrNotFound) {
+			return RenameNotFound
+		}
+		return RenameError
+	}
+	if a.Status == ibgames.AccountCancelled {
+		return RenameNotFound
+	}
+	oldName, oldKey := a.Name, a.NameKey
+	if newName == oldName {
+		return RenameOK // Nothing to do
+	}
+
+	// The new name must not clash with any other account, or with a name
+	// that another account gave up recently. A player can always go back to
+	// one of their own old names.
+	if newKey != oldKey {
+		var n int
+		const collisionQuery = `
+			SELECT COUNT(*)
+			FROM accounts
+			WHERE name_key = ? AND uid != ?`
+		if err := h.QueryRowContext(ctx, collisionQuery, newKey, uid).Scan(&n); err != nil {
+			return RenameError
+		}
+		if n > 0 {
+			return RenameTaken
+		}
+
+		const reservedQuery = `
+			SELECT COUNT(*)
+			FROM name_history
+			WHERE name_key = ? AND uid != ? AND reserved_until > CURRENT_TIMESTAMP`
+		if err := h.QueryRowContext(ctx, reservedQuery, newKey, uid).Scan(&n); err != nil {
+			return RenameError
+		}
+		if n > 0 {
+			return RenameTaken
+		}
+	}
+
+	var reservedUntil any
+	if reserve > 0 {
+		reservedUntil = time.Now().UTC().Add(reserve).Format(time.DateTime)
+	}
+
+	const insertStmt = `
+		INSERT INTO name_history (uid, name, name_key, admin_uid, reserved_until)
+		VALUES (?, ?, ?, ?, ?)`
+	if _, err := h.ExecContext(ctx, insertStmt, uid, oldName, oldKey, nullUID(adminUID), reservedUntil); err != nil {
+		return RenameError
+	}
+
+	var updateResult sql.Result
+	if adminUID != 0 {
+		const updateStmt = `
+			UPDATE accounts
+			SET name = ?, name_key = ?, admin_uid = ?, admin_date = CURRENT_DATE
+			WHERE uid = ?`
+		updateResult, err = h.ExecContext(ctx, updateStmt, newName, newKey, adminUID, uid)
+	} else {
+		const updateStmt = `
+			UPDATE accounts
+			SET name = ?, name_key = ?
+			WHERE uid = ?`
+		updateResult, err = h.ExecContext(ctx, updateStmt, newName, newKey, uid)
+	}
+	if err != nil {
+		return RenameError
+	}
+	if rows, err := updateResult.RowsAffected(); err != nil || rows != 1 {
+		return RenameError
+	}
+
+	log.Printf("Renamed %s to %s", oldName, newName)
+	return RenameOK
+}
+
+// nullUID maps the zero AccountID to NULL for nullable uid columns.
+func nullUID(uid ibgames.AccountID) any {
+	if uid == 0 {
+		return nil
+	}
+	return uid
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nosborn/ibgames-1999"
+	"github.com/nosborn/ibgames-1999/db"
+)
+
+// renameCommitted calls Rename and commits, so that TestDB sees the result.
+func renameCommitted(t *testing.T, uid ibgames.AccountID, newName string, adminUID ibgames.AccountID, reserve time.Duration) RenameResult {
+	t.Helper()
+	result := Rename(uid, newName, adminUID, reserve)
+	require.NoError(t, db.Commit())
+	return result
+}
+
+func TestRename(t *testing.T) {
+	t.Run("renames account and records history", func(t *testing.T) {
+		setup := setupAuthTest(t)
+		uid := ibgames.AccountID(666100)
+		setup.CreateTestAccount(t, uid, "OldName", "N", 100)
+
+		result := renameCommitted(t, uid, "  NewName  ", 0, 0)
+		require.Equal(t, RenameOK, result)
+
+		var name, nameKey string
+		err := setup.TestDB.QueryRow("SELECT name, name_key FROM accounts WHERE uid = ?", uid).Scan(&name, &nameKey)
+		require.NoError(t, err)
+		assert.Equal(t, "NewName", name)
+		assert.Equal(t, "newname", nameKey)
+
+		var oldName, oldKey string
+		var adminUID, reservedUntil any
+		err = setup.TestDB.QueryRow(
+			"SELECT name, name_key, admin_uid, reserved_until FROM name_history WHERE uid = ?", uid,
+		).Scan(&oldName, &oldKey, &adminUID, &reservedUntil)
+		require.NoError(t, err)
+		assert.Equal(t, "OldName", oldName)
+		assert.Equal(t, "oldname", oldKey)
+		assert.Nil(t, adminUID)
+		assert.Nil(t, reservedUntil)
+	})
+
+	t.Run("records admin on account and history", func(t *testing.T) {
+		setup := setupAuthTest(t)
+		adminUID := ibgames.AccountID(666101)
+		uid := ibgames.AccountID(666102)
+		setup.CreateTestAccount(t, adminUID, "renameadmin", "Y", 0)
+		setup.CreateTestAccount(t, uid, "adminrenamed", "N", 100)
+
+		result := renameCommitted(t, uid, "adminrenamed2", adminUID, 0)
+		require.Equal(t, RenameOK, result)
+
+		var accountAdmin ibgames.AccountID
+		var adminDate string
+		err := setup.TestDB.QueryRow("SELECT admin_uid, admin_date FROM accounts WHERE uid = ?", uid).Scan(&accountAdmin, &adminDate)
+		require.NoError(t, err)
+		assert.Equal(t, adminUID, accountAdmin)
+		assert.NotEmpty(t, adminDate)
+
+		var historyAdmin ibgames.AccountID
+		err = setup.TestDB.QueryRow("SELECT admin_uid FROM name_history WHERE uid = ?", uid).Scan(&historyAdmin)
+		require.NoError(t, err)
+		assert.Equal(t, adminUID, historyAdmin)
+	})
+
+	t.Run("rejects name used by another account", func(t *testing.T) {
+		setup := setupAuthTest(t)
+		uid := ibgames.AccountID(666103)
+		setup.CreateTestAccount(t, uid, "collider", "N", 100)
+		setup.CreateTestAccount(t, uid+1, "victim", "N", 100)
+
+		assert.Equal(t, RenameTaken, renameCommitted(t, uid, "VICTIM", 0, 0))
+
+		var n int
+		err := setup.TestDB.QueryRow("SELECT COUNT(*) FROM name_history WHERE uid = ?", uid).Scan(&n)
+		require.NoError(t, err)
+		assert.Zero(t, n)
+	})
+
+	t.Run("allows change of case only", func(t *testing.T) {
+		setup := setupAuthTest(t)
+		uid := ibgames.AccountID(666105)
+		setup.CreateTestAccount(t, uid, "casechange", "N", 100)
+
+		assert.Equal(t, RenameOK, renameCommitted(t, uid, "CaseChange", 0, 0))
+	})
+
+	t.Run("reserves old name for other accounts", func(t *testing.T) {
+		setup := setupAuthTest(t)
+		uid := ibgames.AccountID(666106)
+		other := ibgames.AccountID(666107)
+		setup.CreateTestAccount(t, uid, "famous", "N", 100)
+		setup.CreateTestAccount(t, other, "impostor", "N", 100)
+
+		require.Equal(t, RenameOK, renameCommitted(t, uid, "retired", 0, 24*time.Hour))
+
+		assert.Equal(t, RenameTaken, renameCommitted(t, other, "Famous", 0, 0))
+
+		// The previous holder can take it back.
+		assert.Equal(t, RenameOK, renameCommitted(t, uid, "famous", 0, 0))
+	})
+
+	t.Run("expired reservation releases name", func(t *testing.T) {
+		setup := setupAuthTest(t)
+		uid := ibgames.AccountID(666108)
+		other := ibgames.AccountID(666109)
+		setup.CreateTestAccount(t, uid, "shortlived", "N", 100)
+		setup.CreateTestAccount(t, other, "claimant", "N", 100)
+
+		require.Equal(t, RenameOK, renameCommitted(t, uid, "longlived", 0, 24*time.Hour))
+		_, err := setup.TestDB.Exec(
+			"UPDATE name_history SET reserved_until = datetime('now', '-1 minute') WHERE uid = ?", uid)
+		require.NoError(t, err)
+
+		assert.Equal(t, RenameOK, renameCommitted(t, other, "shortlived", 0, 0))
+	})
+
+	t.Run("rejects invalid names", func(t *testing.T) {
+		setup := setupAuthTest(t)
+		uid := ibgames.AccountID(666110)
+		setup.CreateTestAccount(t, uid, "invalidtarget", "N", 100)
+
+		assert.Equal(t, RenameInvalid, renameCommitted(t, uid, "", 0, 0))
+		assert.Equal(t, RenameInvalid, renameCommitted(t, uid, "   ", 0, 0))
+		assert.Equal(t, RenameInvalid, renameCommitted(t, uid, "login:", 0, 0))
+		assert.Equal(t, RenameInvalid, renameCommitted(t, uid, "tab\tname", 0, 0))
+	})
+
+	t.Run("fails for missing and canceled accounts", func(t *testing.T) {
+		setup := setupAuthTest(t)
+		uid := ibgames.AccountID(666111)
+		setup.CreateTestAccount(t, uid, "gone", "N", 100)
+		_, err := setup.TestDB.Exec("UPDATE accounts SET status = 'X' WHERE uid = ?", uid)
+		require.NoError(t, err)
+
+		assert.Equal(t, RenameNotFound, renameCommitted(t, uid, "stillgone", 0, 0))
+		assert.Equal(t, RenameNotFound, renameCommitted(t, 999999, "nobody", 0, 0))
+	})
+	t.Run("leaves the transaction to the caller", func(t *testing.T) {
+		setup := setupAuthTest(t)
+		uid := ibgames.AccountID(666112)
+		setup.CreateTestAccount(t, uid, "caller", "N", 100)
+		setup.CreateTestAccount(t, uid+1, "bystander", "N", 100)
+
+		// Work of the caller's own in the same transaction.
+		_, err := db.Exec("UPDATE accounts SET minutes = 50 WHERE uid = ?", uid)
+		require.NoError(t, err)
+
+		// A failed rename leaves it alone.
+		assert.Equal(t, RenameTaken, Rename(uid, "bystander", 0, 0))
+
+		// A successful one doesn't commit it.
+		require.Equal(t, RenameOK, Rename(uid, "callee", 0, 0))
+		var name string
+		require.NoError(t, setup.TestDB.QueryRow("SELECT name FROM accounts WHERE uid = ?", uid).Scan(&name))
+		assert.Equal(t, "caller", name)
+
+		require.NoError(t, db.Commit())
+		var minutes int
+		err = setup.TestDB.QueryRow("SELECT name, minutes FROM accounts WHERE uid = ?", uid).Scan(&name, &minutes)
+		require.NoError(t, err)
+		assert.Equal(t, "callee", name)
+		assert.Equal(t, 50, minutes)
+	})
+}
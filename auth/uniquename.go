@@ -1,28 +1,14 @@
 package auth
 
-func UniqueName(name string) string {
-	var unique []byte
-	for _, ch := range []byte(name) {
-		if isUpper(ch) {
-			unique = append(unique, toLower(ch))
-		} else if isGraph(ch) {
-			unique = append(unique, ch)
-		}
-	}
-	return string(unique)
-}
+import "github.com/nosborn/ibgames-1999/accounts"
 
-func isUpper(b byte) bool {
-	return b-'A' < 26
+// UniqueName returns the key that name is looked up by.
+//
+// Deprecated: Use accounts.NameKey.
+func UniqueName(name string) string {
+	return accounts.NameKey(name)
 }
 
 func isGraph(b byte) bool {
 	return b-0x21 < 0x5e
 }
-
-func toLower(b byte) byte {
-	if isUpper(b) {
-		return b | 32
-	}
-	return b
-}
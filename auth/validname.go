@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"github.com/nosborn/ibgames-1999/accounts"
+	"github.com/nosborn/ibgames-1999/goodies"
+)
+
+// ValidName reports whether name is acceptable as an account name: at most
+// NameSize printable ASCII characters and spaces, at least one of them not a
+// space, and nothing that looks like a login prompt. The name must already
+// have had leading and trailing whitespace removed.
+func ValidName(name string) bool {
+	if name == "" || len(name) > NameSize {
+		return false
+	}
+	for _, ch := range []byte(name) {
+		if ch != ' ' && !isGraph(ch) {
+			return false
+		}
+	}
+	if accounts.NameKey(name) == "" {
+		return false
+	}
+
+	// Don't let anyone pretend to be the login sequence.
+	return !goodies.ContainsPrompt(name)
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidName(t *testing.T) {
+	t.Run("accepts ordinary names", func(t *testing.T) {
+		assert.True(t, ValidName("Hazed"))
+		assert.True(t, ValidName("Captain Kirk"))
+		assert.True(t, ValidName("user_123"))
+	})
+
+	t.Run("rejects empty and over-length names", func(t *testing.T) {
+		assert.False(t, ValidName(""))
+
+		longName := make([]byte, NameSize+1)
+		for i := range longName {
+			longName[i] = 'a'
+		}
+		assert.False(t, ValidName(string(longName)))
+		assert.True(t, ValidName(string(longName[:NameSize])))
+	})
+
+	t.Run("rejects control and non-ASCII characters", func(t *testing.T) {
+		assert.False(t, ValidName("bad\tname"))
+		assert.False(t, ValidName("bad\nname"))
+		assert.False(t, ValidName("caf\xc3\xa9"))
+	})
+
+	t.Run("rejects prompts", func(t *testing.T) {
+		assert.False(t, ValidName("login:"))
+		assert.False(t, ValidName("Password:"))
+	})
+}
@@ -1,12 +1,13 @@
 package billing
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
 	"log"
 	"time"
 
 	"github.com/nosborn/ibgames-1999"
+	"github.com/nosborn/ibgames-1999/config"
 	"github.com/nosborn/ibgames-1999/db"
 )
 
@@ -18,10 +19,6 @@ const (
 	AgeOfAdventure
 )
 
-const (
-	minimumCharge = 1
-)
-
 type Session struct {
 	uid           ibgames.AccountID // Account being billed
 	complimentary bool              // Is account complimentary?
@@ -52,63 +49,103 @@ const (
 )
 
 var (
-	insertStmt  *sql.Stmt
-	selectStmt  *sql.Stmt
-	update1Stmt *sql.Stmt
-	update2Stmt *sql.Stmt
+	insertStmt  *db.Stmt
+	selectStmt  *db.Stmt
+	update1Stmt *db.Stmt
+	update2Stmt *db.Stmt
 )
 
 var (
-	autoCommit bool
-	freePeriod bool
-	prepared   bool
+	autoCommit    bool
+	freePeriod    bool
+	freePeriodSet bool       // FreePeriod overrides the configuration
+	handle        *db.Handle // Database used by all sessions
+	prepared      bool
 )
 
 func Init(product Product) error {
+	return InitWithContext(context.Background(), db.Default(), product)
+}
+
+// InitContext is like Init but uses ctx while preparing statements.
+func InitContext(ctx context.Context, product Product) error {
+	return InitWithContext(ctx, db.Default(), product)
+}
+
+// InitWith is like Init but bills sessions through the database handle h
+// rather than the default one.
+func InitWith(h *db.Handle, product Product) error {
+	return InitWithContext(context.Background(), h, product)
+}
+
+// InitWithContext is like InitWith but uses ctx while preparing statements.
+func InitWithContext(ctx context.Context, h *db.Handle, product Product) error {
 	if prepared {
 		return nil
 	}
 
 	var err error
 	query := fmt.Sprintf(insertQuery, product)
-	insertStmt, err = db.Prepare(query)
+	insertStmt, err = h.PrepareContext(ctx, query)
 	if err != nil {
 		return err
 	}
-	selectStmt, err = db.Prepare(selectQuery)
+	selectStmt, err = h.PrepareContext(ctx, selectQuery)
 	if err != nil {
 		return err
 	}
-	update1Stmt, err = db.Prepare(update1Query)
+	update1Stmt, err = h.PrepareContext(ctx, update1Query)
 	if err != nil {
 		return err
 	}
-	update2Stmt, err = db.Prepare(update2Query)
+	update2Stmt, err = h.PrepareContext(ctx, update2Query)
 	if err != nil {
 		return err
 	}
 
+	handle = h
+	if !freePeriodSet {
+		freePeriod = config.Get().BillingFreePeriod
+	}
 	prepared = true
 	return nil
 }
 
+// minimumCharge returns the configured number of minutes charged when a
+// session begins.
+func minimumCharge() int {
+	return config.Get().BillingMinimumCharge
+}
+
+// writeInterval returns the configured longest time between writes of a
+// session record, in seconds.
+func writeInterval() int64 {
+	return int64(config.Get().BillingWriteInterval / time.Second)
+}
+
 func AutoCommit(on bool) {
 	autoCommit = on
 	_ = autoCommit // keep linter happy
 }
 
 func FreePeriod(on bool) {
-	freePeriod = on
+	freePeriod, freePeriodSet = on, true
 }
 
 func BeginSession(uid ibgames.AccountID, addr string) (*Session, error) { // FIXME: struct in_addr addr
+	return BeginSessionContext(context.Background(), uid, addr)
+}
+
+// BeginSessionContext is like BeginSession but uses ctx for its database
+// operations.
+func BeginSessionContext(ctx context.Context, uid ibgames.AccountID, addr string) (*Session, error) {
 	// Initialize the session record.
 	s := &Session{
 		uid: uid,
 	}
 
 	var complimentary string
-	err := selectStmt.QueryRow(uid).Scan(&complimentary)
+	err := selectStmt.QueryRowContext(ctx, uid).Scan(&complimentary)
 	if err != nil {
 		return nil, err
 	}
@@ -118,38 +155,46 @@ func BeginSession(uid ibgames.AccountID, addr string) (*Session, error) { // FIX
 	if s.complimentary || freePeriod {
 		minutes = 0
 	} else {
-		s.lastCharge = minimumCharge
+		s.lastCharge = minimumCharge()
 		minutes = s.lastCharge
 	}
 
-	result, err := insertStmt.Exec(uid, addr, minutes)
-	if err != nil {
-		return nil, err
-	}
-
-	sid, err := result.LastInsertId()
-	if err != nil {
-		return nil, err
-	}
-	s.sid = int32(sid)
+	// If charging the account fails, take the session record back out again
+	// without disturbing anything else in the transaction.
+	err = handle.WithSavepointContext(ctx, "begin_session", func() error {
+		result, err := insertStmt.ExecContext(ctx, uid, addr, minutes)
+		if err != nil {
+			return err
+		}
 
-	if minutes > 0 {
-		result, err := update1Stmt.Exec(minutes, uid)
+		sid, err := result.LastInsertId()
 		if err != nil {
-			return nil, err
+			return err
 		}
-		rows, err := result.RowsAffected()
-		if err != nil || rows != 1 {
-			return nil, fmt.Errorf("expected to update 1 row, updated %d rows", rows)
+		s.sid = int32(sid)
+
+		if minutes > 0 {
+			result, err := update1Stmt.ExecContext(ctx, minutes, uid)
+			if err != nil {
+				return err
+			}
+			rows, err := result.RowsAffected()
+			if err != nil || rows != 1 {
+				return fmt.Errorf("expected to update 1 row, updated %d rows", rows)
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if err := db.Commit(); err != nil {
+	if err := handle.CommitContext(ctx); err != nil {
 		log.Print("billing.BeginSession: db.Commit() failed")
 		return nil, err
 	}
 
-	s.nextWrite = time.Now().Unix() + 60
+	s.nextWrite = time.Now().Unix() + writeInterval()
 
 	// Start the clock.
 	s.StartClock()
@@ -176,6 +221,12 @@ func (s *Session) StopClock() {
 }
 
 func (s *Session) Tick() int {
+	return s.TickContext(context.Background())
+}
+
+// TickContext is like Tick but uses ctx for any database writes. If ctx is
+// done the charge is written on a later tick.
+func (s *Session) TickContext(ctx context.Context) int {
 	// assert(session != NULL);
 
 	now := time.Now().Unix()
@@ -188,36 +239,58 @@ func (s *Session) Tick() int {
 	charge := int(s.seconds / 60) // Convert seconds to minutes
 
 	if charge > s.lastCharge || now >= s.nextWrite {
-		result, err := update2Stmt.Exec(charge, s.sid)
-		if err != nil {
-			log.Printf("UPDATE: %v", err)
-			return 0
-		}
-		rows, err := result.RowsAffected()
-		if err != nil || rows != 1 {
-			log.Printf("expected to update 1 row, updated %d rows", rows)
-			return 0
+		// Any failure undoes only this tick's updates.
+		update := func() error {
+			return handle.WithSavepointContext(ctx, "tick", func() error {
+				result, err := update2Stmt.ExecContext(ctx, charge, s.sid)
+				if err != nil {
+					return fmt.Errorf("UPDATE: %w", err)
+				}
+				rows, err := result.RowsAffected()
+				if err != nil || rows != 1 {
+					return fmt.Errorf("expected to update 1 row, updated %d rows", rows)
+				}
+
+				if charge > s.lastCharge {
+					result, err := update1Stmt.ExecContext(ctx, charge, s.uid)
+					if err != nil {
+						return fmt.Errorf("UPDATE: %w", err)
+					}
+					rows, err := result.RowsAffected()
+					if err != nil || rows != 1 {
+						return fmt.Errorf("expected to update 1 row, updated %d rows", rows)
+					}
+				}
+				return nil
+			})
 		}
 
-		if charge > s.lastCharge {
-			result, err := update1Stmt.Exec(charge, s.uid)
-			if err != nil {
-				log.Printf("UPDATE: %v", err)
+		if handle.Uncommitted() {
+			// The caller has work of its own in the transaction, which
+			// a retry would throw away, so commit once. The charge is
+			// in the transaction even if the commit fails, and is
+			// written when the caller's work is.
+			if err := update(); err != nil {
+				log.Print(err)
 				return 0
 			}
-			rows, err := result.RowsAffected()
-			if err != nil || rows != 1 {
-				log.Printf("expected to update 1 row, updated %d rows", rows)
+			s.nextWrite = now + writeInterval()
+			s.lastCharge = charge
+			if err := handle.CommitContext(ctx); err != nil {
+				log.Print(err)
 				return 0
 			}
+			return 1
 		}
 
-		if err := db.Commit(); err != nil {
-			log.Printf("COMMIT: %v", err)
+		// Another process may hold the write lock, so retry the whole
+		// transaction rather than lose the charge.
+		if _, err := handle.RunInTxContext(ctx, update); err != nil {
+			log.Print(err)
 			return 0
 		}
 
-		s.nextWrite = now + 60
+		s.nextWrite = now + writeInterval()
 		s.lastCharge = charge
 	}
 
@@ -40,8 +40,8 @@ func TestRealTimeBilling(t *testing.T) {
 
 		// Verify initial state
 		minutes := getAccountMinutes(t, setup, uid)
-		assert.Equal(t, initialMinutes-minimumCharge, minutes)
-		assert.Equal(t, minimumCharge, session.lastCharge)
+		assert.Equal(t, initialMinutes-minimumCharge(), minutes)
+		assert.Equal(t, minimumCharge(), session.lastCharge)
 		assert.True(t, session.ticking)
 
 		t.Logf("Sleeping for 130 seconds to cross 2+ minute boundaries...")
@@ -2,6 +2,7 @@ package billing
 
 import (
 	"fmt"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/nosborn/ibgames-1999"
+	"github.com/nosborn/ibgames-1999/config"
 	"github.com/nosborn/ibgames-1999/db"
 	"github.com/nosborn/ibgames-1999/internal/testutil"
 )
@@ -37,6 +39,8 @@ func setupTestDB(t *testing.T) *testutil.DatabaseSetup {
 func resetBillingState() {
 	// Reset prepared statement state for next test
 	prepared = false
+	handle = nil
+	freePeriodSet = false
 	insertStmt = nil
 	selectStmt = nil
 	update1Stmt = nil
@@ -52,7 +56,6 @@ func getAccountMinutes(t *testing.T, setup *testutil.DatabaseSetup, uid ibgames.
 
 func TestInit(t *testing.T) {
 	setup := setupTestDB(t)
-	_ = setup // Keep linter happy
 	t.Cleanup(resetBillingState)
 
 	t.Run("init with Federation product", func(t *testing.T) {
@@ -76,6 +79,19 @@ func TestInit(t *testing.T) {
 		require.NoError(t, err)
 		assert.True(t, prepared)
 	})
+
+	t.Run("init with explicit handle", func(t *testing.T) {
+		resetBillingState()
+
+		h, err := db.Open(filepath.Dir(setup.FilePath), false)
+		require.NoError(t, err)
+		defer h.Abandon()
+
+		err = InitWith(h, Federation)
+		require.NoError(t, err)
+		assert.True(t, prepared)
+		assert.Same(t, h, handle)
+	})
 }
 
 func TestAutoCommitAndFreePeriod(t *testing.T) {
@@ -94,6 +110,24 @@ func TestAutoCommitAndFreePeriod(t *testing.T) {
 		FreePeriod(false)
 		assert.False(t, freePeriod)
 	})
+
+	t.Run("FreePeriod overrides the configuration", func(t *testing.T) {
+		setupTestDB(t)
+		t.Cleanup(resetBillingState)
+		c := config.Default()
+		c.BillingFreePeriod = false
+		config.Set(c)
+		t.Cleanup(func() { config.Set(nil) })
+
+		FreePeriod(true)
+		require.NoError(t, Init(Federation))
+		assert.True(t, freePeriod)
+
+		resetBillingState()
+		c.BillingFreePeriod = true
+		require.NoError(t, Init(Federation))
+		assert.True(t, freePeriod)
+	})
 }
 
 func TestBeginSession(t *testing.T) {
@@ -131,12 +165,12 @@ func TestBeginSession(t *testing.T) {
 
 		assert.Equal(t, uid, session.uid)
 		assert.False(t, session.complimentary)
-		assert.Equal(t, minimumCharge, session.lastCharge)
+		assert.Equal(t, minimumCharge(), session.lastCharge)
 		assert.True(t, session.ticking)
 
 		// Check that minutes were deducted from account using direct DB connection
 		minutes := getAccountMinutes(t, setup, uid)
-		assert.Equal(t, 1000-minimumCharge, minutes)
+		assert.Equal(t, 1000-minimumCharge(), minutes)
 	})
 
 	t.Run("begin session during free period", func(t *testing.T) {
@@ -159,6 +193,43 @@ func TestBeginSession(t *testing.T) {
 		assert.Equal(t, 1000, minutes)
 	})
 
+	t.Run("failed charge leaves no session record", func(t *testing.T) {
+		FreePeriod(false)
+
+		uid := ibgames.AccountID(666003)
+		setup.CreateTestAccount(t, uid, fmt.Sprintf("user%d", uid), "N", 1000)
+		_, err := setup.TestDB.Exec(fmt.Sprintf(`
+			CREATE TRIGGER refuse_charge BEFORE UPDATE OF minutes ON accounts
+			WHEN OLD.uid = %d
+			BEGIN
+				SELECT RAISE(FAIL, 'charge refused');
+			END`, uid))
+		require.NoError(t, err)
+		defer setup.TestDB.Exec("DROP TRIGGER refuse_charge")
+
+		// Unrelated work already in the transaction must survive.
+		other := ibgames.AccountID(666004)
+		setup.CreateTestAccount(t, other, fmt.Sprintf("user%d", other), "N", 1000)
+		_, err = db.Exec("UPDATE accounts SET bulk_mail = 'N' WHERE uid = ?", other)
+		require.NoError(t, err)
+
+		session, err := BeginSession(uid, "192.0.2.5")
+		require.Error(t, err)
+		assert.Nil(t, session)
+
+		var n int
+		err = db.QueryRow("SELECT COUNT(*) FROM sessions WHERE uid = ?", uid).Scan(&n)
+		require.NoError(t, err)
+		assert.Zero(t, n)
+
+		var bulkMail string
+		err = db.QueryRow("SELECT bulk_mail FROM accounts WHERE uid = ?", other).Scan(&bulkMail)
+		require.NoError(t, err)
+		assert.Equal(t, "N", bulkMail)
+
+		require.NoError(t, db.Rollback())
+	})
+
 	t.Run("begin session for non-existent account", func(t *testing.T) {
 		uid := ibgames.AccountID(999999)
 
@@ -266,7 +337,7 @@ func TestSessionBillingLogic(t *testing.T) {
 
 		// Should have deducted minimum charge at start
 		minutes := getAccountMinutes(t, setup, uid)
-		assert.Equal(t, 1000-minimumCharge, minutes)
+		assert.Equal(t, 1000-minimumCharge(), minutes)
 
 		// Simulate time passage when ticking=true
 		session.lastTick = time.Now().Unix() - 120
@@ -277,6 +348,76 @@ func TestSessionBillingLogic(t *testing.T) {
 		assert.GreaterOrEqual(t, session.seconds, int64(120))
 	})
 
+	t.Run("failed tick leaves the rest of the transaction alone", func(t *testing.T) {
+		FreePeriod(false)
+
+		uid := ibgames.AccountID(666104)
+		setup.CreateTestAccount(t, uid, fmt.Sprintf("user%d", uid), "N", 1000)
+		session, err := BeginSession(uid, "192.0.2.1")
+		require.NoError(t, err)
+		require.NoError(t, db.Commit())
+
+		_, err = setup.TestDB.Exec(fmt.Sprintf(`
+			CREATE TRIGGER refuse_charge BEFORE UPDATE OF minutes ON accounts
+			WHEN OLD.uid = %d
+			BEGIN
+				SELECT RAISE(FAIL, 'charge refused');
+			END`, uid))
+		require.NoError(t, err)
+		defer setup.TestDB.Exec("DROP TRIGGER refuse_charge")
+
+		// Unrelated work already in the transaction must survive.
+		other := ibgames.AccountID(666105)
+		setup.CreateTestAccount(t, other, fmt.Sprintf("user%d", other), "N", 1000)
+		_, err = db.Exec("UPDATE accounts SET bulk_mail = 'N' WHERE uid = ?", other)
+		require.NoError(t, err)
+
+		session.lastTick = time.Now().Unix() - 120
+		session.ticking = true
+		assert.Equal(t, 0, session.Tick())
+
+		var sessionMinutes int
+		err = db.QueryRow("SELECT minutes FROM sessions WHERE sid = ?", session.sid).Scan(&sessionMinutes)
+		require.NoError(t, err)
+		assert.Equal(t, minimumCharge(), sessionMinutes)
+
+		var bulkMail string
+		err = db.QueryRow("SELECT bulk_mail FROM accounts WHERE uid = ?", other).Scan(&bulkMail)
+		require.NoError(t, err)
+		assert.Equal(t, "N", bulkMail)
+
+		require.NoError(t, db.Rollback())
+	})
+
+	t.Run("tick commits other pending work once", func(t *testing.T) {
+		FreePeriod(false)
+
+		uid := ibgames.AccountID(666106)
+		setup.CreateTestAccount(t, uid, fmt.Sprintf("user%d", uid), "N", 1000)
+		session, err := BeginSession(uid, "192.0.2.1")
+		require.NoError(t, err)
+		require.NoError(t, db.Commit())
+
+		other := ibgames.AccountID(666107)
+		setup.CreateTestAccount(t, other, fmt.Sprintf("user%d", other), "N", 1000)
+		_, err = db.Exec("UPDATE accounts SET bulk_mail = 'N' WHERE uid = ?", other)
+		require.NoError(t, err)
+
+		session.lastTick = time.Now().Unix() - 120
+		session.ticking = true
+		assert.Equal(t, 1, session.Tick())
+		assert.False(t, db.Default().Uncommitted())
+
+		var bulkMail string
+		err = setup.TestDB.QueryRow("SELECT bulk_mail FROM accounts WHERE uid = ?", other).Scan(&bulkMail)
+		require.NoError(t, err)
+		assert.Equal(t, "N", bulkMail)
+		var sessionMinutes int
+		err = setup.TestDB.QueryRow("SELECT minutes FROM sessions WHERE sid = ?", session.sid).Scan(&sessionMinutes)
+		require.NoError(t, err)
+		assert.Equal(t, session.lastCharge, sessionMinutes)
+	})
+
 	t.Run("paying account does not accumulate when ticking=false", func(t *testing.T) {
 		FreePeriod(false)
 
@@ -0,0 +1,251 @@
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nosborn/ibgames-1999"
+	"github.com/nosborn/ibgames-1999/db"
+)
+
+// PaymentMethod is how a credit was paid for. The values are the characters
+// stored in credits.method.
+type PaymentMethod byte
+
+const (
+	PaidByAdmin PaymentMethod = 'A' // Granted by an administrator
+	PaidByCard  PaymentMethod = 'C'
+	PaidByCheck PaymentMethod = 'K'
+)
+
+func (m PaymentMethod) String() string {
+	switch m {
+	case PaidByAdmin:
+		return "admin"
+	case PaidByCard:
+		return "card"
+	case PaidByCheck:
+		return "check"
+	default:
+		return "PaymentMethod(" + strconv.Quote(string(rune(m))) + ")"
+	}
+}
+
+// Credit is one purchase of minutes, a row of the credits table.
+type Credit struct {
+	ID        int64
+	UID       ibgames.AccountID // Account credited
+	Time      time.Time         // Set by Purchase
+	Minutes   int
+	Price     int64  // In minor units of Currency, such as cents
+	Currency  string // ISO 4217 code, such as USD
+	BasePrice int64  // Price in minor units of the base currency; set by Purchase
+	Method    PaymentMethod
+	Reference string            // Payment reference, such as a transaction or check number
+	AdminUID  ibgames.AccountID // Administrator who entered the credit, if any
+	Reversed  time.Time         // When the credit was reversed, if it has been
+}
+
+// ErrNoSuchAccount is returned by Purchase when the account to be credited
+// doesn't exist.
+var ErrNoSuchAccount = errors.New("no such account")
+
+// ErrNoSuchCredit is returned by Reverse when there is no credit with the ID
+// given.
+var ErrNoSuchCredit = errors.New("no such credit")
+
+// ErrReversed is returned by Reverse when the credit has already been
+// reversed.
+var ErrReversed = errors.New("credit already reversed")
+
+// Purchase records c in the credits table and adds c.Minutes to the account,
+// both or neither. It sets c.ID and c.Time, and converts c.Price into
+// c.BasePrice at the day's exchange rate.
+//
+// The change is made in h's auto-transaction and isn't committed.
+func Purchase(ctx context.Context, h *db.Handle, c *Credit) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	basePrice, err := ToBase(ctx, h, c.Price, c.Currency, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	var reference, adminUID any
+	if c.Reference != "" {
+		reference = c.Reference
+	}
+	if c.AdminUID != 0 {
+		adminUID = int64(c.AdminUID)
+	}
+
+	return h.WithSavepointContext(ctx, "purchase", func() error {
+		result, err := h.ExecContext(ctx, `
+			UPDATE accounts
+			SET minutes = minutes + ?
+			WHERE uid = ?`, c.Minutes, c.UID)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows != 1 {
+			return fmt.Errorf("account %d: %w", c.UID, ErrNoSuchAccount)
+		}
+
+		result, err = h.ExecContext(ctx, `
+			INSERT INTO credits (uid, minutes, price, currency, method, reference, admin_uid, base_price)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			c.UID, c.Minutes, c.Price, c.Currency, string(rune(c.Method)), reference, adminUID, basePrice)
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		var credited string
+		err = h.QueryRowContext(ctx, "SELECT credited FROM credits WHERE cid = ?", id).Scan(&credited)
+		if err != nil {
+			return err
+		}
+		t, err := parseCredited(credited)
+		if err != nil {
+			return err
+		}
+		c.ID, c.Time, c.BasePrice = id, t, basePrice
+		return nil
+	})
+}
+
+// Reverse takes back the minutes of credit id, such as when the payment for
+// it bounced, and marks the credit reversed. Minutes that have already been
+// used can't be taken back, so the account isn't taken below zero; Reverse
+// returns the number of minutes it was short.
+//
+// The change is made in h's auto-transaction and isn't committed.
+func Reverse(ctx context.Context, h *db.Handle, id int64) (int, error) {
+	var shortfall int
+	err := h.WithSavepointContext(ctx, "reverse", func() error {
+		var (
+			uid      ibgames.AccountID
+			minutes  int
+			balance  int
+			reversed sql.NullString
+		)
+		err := h.QueryRowContext(ctx, `
+			SELECT c.uid, c.minutes, a.minutes, c.reversed
+			FROM credits c
+			JOIN accounts a ON a.uid = c.uid
+			WHERE c.cid = ?`, id).Scan(&uid, &minutes, &balance, &reversed)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("credit %d: %w", id, ErrNoSuchCredit)
+		}
+		if err != nil {
+			return err
+		}
+		if reversed.Valid {
+			return fmt.Errorf("credit %d: %w", id, ErrReversed)
+		}
+
+		take := min(minutes, max(balance, 0))
+		shortfall = minutes - take
+		if _, err := h.ExecContext(ctx, `
+			UPDATE accounts
+			SET minutes = minutes - ?
+			WHERE uid = ?`, take, uid); err != nil {
+			return err
+		}
+		_, err = h.ExecContext(ctx, `
+			UPDATE credits
+			SET reversed = CURRENT_TIMESTAMP
+			WHERE cid = ?`, id)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return shortfall, nil
+}
+
+func (c *Credit) validate() error {
+	if c.Minutes <= 0 {
+		return fmt.Errorf("credit of %d minutes", c.Minutes)
+	}
+	if c.Price < 0 {
+		return fmt.Errorf("negative price %d", c.Price)
+	}
+	if !ValidCurrency(c.Currency) {
+		return fmt.Errorf("bad currency %q", c.Currency)
+	}
+	switch c.Method {
+	case PaidByAdmin, PaidByCard, PaidByCheck:
+	default:
+		return fmt.Errorf("bad payment method %v", c.Method)
+	}
+	return nil
+}
+
+// CreditHistory returns the credits of account uid, oldest first. The result
+// is empty if there are none.
+func CreditHistory(ctx context.Context, h *db.Handle, uid ibgames.AccountID) ([]*Credit, error) {
+	rows, err := h.QueryContext(ctx, `
+		SELECT cid, uid, credited, minutes, price, currency, method,
+			COALESCE(reference, ''), COALESCE(admin_uid, 0), COALESCE(base_price, 0),
+			reversed
+		FROM credits
+		WHERE uid = ?
+		ORDER BY credited, cid`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var credits []*Credit
+	for rows.Next() {
+		var (
+			c        Credit
+			credited string
+			method   string
+			reversed sql.NullString
+		)
+		err := rows.Scan(&c.ID, &c.UID, &credited, &c.Minutes, &c.Price, &c.Currency, &method,
+			&c.Reference, &c.AdminUID, &c.BasePrice, &reversed)
+		if err != nil {
+			return nil, err
+		}
+		if c.Time, err = parseCredited(credited); err != nil {
+			return nil, fmt.Errorf("credit %d: %w", c.ID, err)
+		}
+		if reversed.Valid {
+			if c.Reversed, err = parseCredited(reversed.String); err != nil {
+				return nil, fmt.Errorf("credit %d: %w", c.ID, err)
+			}
+		}
+		if len(method) == 1 {
+			c.Method = PaymentMethod(method[0])
+		}
+		credits = append(credits, &c)
+	}
+	return credits, rows.Err()
+}
+
+// parseCredited parses credits.credited or credits.reversed. Rows loaded
+// from Informix have no seconds.
+func parseCredited(s string) (time.Time, error) {
+	for _, layout := range []string{time.DateTime, "2006-01-02 15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad date %q", s)
+}
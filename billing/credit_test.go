@@ -0,0 +1,168 @@
+package billing
+
+import (
+	"context"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nosborn/ibgames-1999/db"
+	"github.com/nosborn/ibgames-1999/internal/testutil"
+)
+
+func setupCreditTest(t *testing.T) (*testutil.DatabaseSetup, *db.Handle) {
+	setup := testutil.SetupTestDatabaseWithSchema(t)
+	h, err := db.Open(filepath.Dir(setup.FilePath), false)
+	require.NoError(t, err)
+	t.Cleanup(h.Abandon)
+	return setup, h
+}
+
+func TestPurchase(t *testing.T) {
+	setup, h := setupCreditTest(t)
+	ctx := context.Background()
+	setup.CreateTestAccount(t, 666470, "Admin", "Y", 0)
+	setup.CreateTestAccount(t, 666471, "Player", "N", 10)
+
+	c := &Credit{
+		UID:       666471,
+		Minutes:   600,
+		Price:     1995,
+		Currency:  "USD",
+		Method:    PaidByCard,
+		Reference: "TX1234",
+	}
+	require.NoError(t, Purchase(ctx, h, c))
+	assert.Positive(t, c.ID)
+	assert.False(t, c.Time.IsZero())
+	assert.Equal(t, int64(1995), c.BasePrice)
+	require.NoError(t, h.Commit())
+	assert.Equal(t, 610, getAccountMinutes(t, setup, 666471))
+
+	t.Run("admin grant", func(t *testing.T) {
+		c := &Credit{UID: 666471, Minutes: 30, Currency: "USD", Method: PaidByAdmin, AdminUID: 666470}
+		require.NoError(t, Purchase(ctx, h, c))
+		require.NoError(t, h.Commit())
+		assert.Equal(t, 640, getAccountMinutes(t, setup, 666471))
+	})
+
+	t.Run("missing account", func(t *testing.T) {
+		c := &Credit{UID: 999999, Minutes: 60, Price: 100, Currency: "USD", Method: PaidByCard}
+		require.ErrorIs(t, Purchase(ctx, h, c), ErrNoSuchAccount)
+
+		var n int
+		require.NoError(t, h.QueryRow("SELECT COUNT(*) FROM credits WHERE uid = 999999").Scan(&n))
+		assert.Zero(t, n)
+	})
+
+	t.Run("failure leaves nothing behind", func(t *testing.T) {
+		// admin_uid must be an account, so the insert fails after the
+		// minutes have been added.
+		c := &Credit{UID: 666471, Minutes: 60, Currency: "USD", Method: PaidByAdmin, AdminUID: 999999}
+		require.Error(t, Purchase(ctx, h, c))
+		require.NoError(t, h.Commit())
+		assert.Equal(t, 640, getAccountMinutes(t, setup, 666471))
+	})
+
+	t.Run("no exchange rate", func(t *testing.T) {
+		c := &Credit{UID: 666471, Minutes: 60, Price: 500, Currency: "CAD", Method: PaidByCard}
+		require.ErrorIs(t, Purchase(ctx, h, c), ErrNoRate)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, c := range []Credit{
+			{UID: 666471, Minutes: 0, Currency: "USD", Method: PaidByCard},
+			{UID: 666471, Minutes: 60, Price: -1, Currency: "USD", Method: PaidByCard},
+			{UID: 666471, Minutes: 60, Currency: "usd", Method: PaidByCard},
+			{UID: 666471, Minutes: 60, Currency: "USD", Method: 'Z'},
+		} {
+			require.Error(t, Purchase(ctx, h, &c), "%+v", c)
+		}
+	})
+}
+
+func TestCreditHistory(t *testing.T) {
+	setup, h := setupCreditTest(t)
+	ctx := context.Background()
+	setup.CreateTestAccount(t, 666475, "Player", "N", 0)
+	setup.CreateTestAccount(t, 666476, "Other", "N", 0)
+
+	_, err := setup.TestDB.Exec(`
+		INSERT INTO credits (uid, credited, minutes, price, currency, method, reference)
+		VALUES (666475, '1999-03-01 10:00', 300, 995, 'USD', 'K', '1001'),
+			(666476, '1999-03-02 10:00:00', 300, 995, 'USD', 'C', NULL)`)
+	require.NoError(t, err)
+
+	require.NoError(t, SetExchangeRate(ctx, h, "GBP", time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC), big.NewRat(16125, 10000)))
+	c := &Credit{UID: 666475, Minutes: 600, Price: 1195, Currency: "GBP", Method: PaidByCard}
+	require.NoError(t, Purchase(ctx, h, c))
+	assert.Equal(t, int64(1927), c.BasePrice) // 19.269375 rounds to 19.27
+
+	credits, err := CreditHistory(ctx, h, 666475)
+	require.NoError(t, err)
+	require.Len(t, credits, 2)
+	assert.Equal(t, "1999-03-01 10:00:00", credits[0].Time.Format("2006-01-02 15:04:05"))
+	assert.Equal(t, PaidByCheck, credits[0].Method)
+	assert.Equal(t, "1001", credits[0].Reference)
+	assert.Equal(t, c, credits[1])
+
+	credits, err = CreditHistory(ctx, h, 999999)
+	require.NoError(t, err)
+	assert.Empty(t, credits)
+}
+
+func TestPaymentMethodString(t *testing.T) {
+	assert.Equal(t, "card", PaidByCard.String())
+	assert.Equal(t, `PaymentMethod("Z")`, PaymentMethod('Z').String())
+}
+
+func TestReverse(t *testing.T) {
+	setup, h := setupCreditTest(t)
+	ctx := context.Background()
+	setup.CreateTestAccount(t, 666478, "Player", "N", 10)
+
+	purchase := func(minutes int) *Credit {
+		t.Helper()
+		c := &Credit{UID: 666478, Minutes: minutes, Price: 995, Currency: "USD", Method: PaidByCheck}
+		require.NoError(t, Purchase(ctx, h, c))
+		return c
+	}
+
+	c := purchase(300)
+	shortfall, err := Reverse(ctx, h, c.ID)
+	require.NoError(t, err)
+	assert.Zero(t, shortfall)
+	require.NoError(t, h.Commit())
+	assert.Equal(t, 10, getAccountMinutes(t, setup, 666478))
+
+	credits, err := CreditHistory(ctx, h, 666478)
+	require.NoError(t, err)
+	require.Len(t, credits, 1)
+	assert.False(t, credits[0].Reversed.IsZero())
+
+	t.Run("twice", func(t *testing.T) {
+		_, err := Reverse(ctx, h, c.ID)
+		require.ErrorIs(t, err, ErrReversed)
+	})
+
+	t.Run("minutes already used", func(t *testing.T) {
+		c := purchase(300)
+		_, err := h.Exec("UPDATE accounts SET minutes = 100 WHERE uid = 666478")
+		require.NoError(t, err)
+
+		shortfall, err := Reverse(ctx, h, c.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 200, shortfall)
+		require.NoError(t, h.Commit())
+		assert.Zero(t, getAccountMinutes(t, setup, 666478))
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := Reverse(ctx, h, 999999)
+		require.ErrorIs(t, err, ErrNoSuchCredit)
+	})
+}
@@ -0,0 +1,173 @@
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/nosborn/ibgames-1999/config"
+	"github.com/nosborn/ibgames-1999/db"
+)
+
+// ErrNoRate is returned when there is no exchange rate for a currency on the
+// date wanted.
+var ErrNoRate = errors.New("no exchange rate")
+
+// rateDigits is the most decimal places an exchange rate may have, as for
+// DECIMAL(20,12).
+const rateDigits = 12
+
+// minorUnitDigits lists the currencies whose minor unit isn't a hundredth.
+var minorUnitDigits = map[string]int{
+	"BEF": 0,
+	"BHD": 3,
+	"ESP": 0,
+	"ITL": 0,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+}
+
+// MinorUnits returns the number of decimal places in currency's minor unit,
+// such as 2 for USD and 0 for JPY.
+func MinorUnits(currency string) int {
+	if n, ok := minorUnitDigits[currency]; ok {
+		return n
+	}
+	return 2
+}
+
+// BaseCurrency returns the currency that accounts are kept in.
+func BaseCurrency() string {
+	return config.Get().BillingBaseCurrency
+}
+
+// Convert converts amount, in minor units of from, into minor units of to.
+// rate is the number of units of to that one unit of from is worth. The
+// arithmetic is exact, and the result is rounded to the nearest minor unit
+// with halves rounded away from zero.
+func Convert(amount int64, from, to string, rate *big.Rat) (int64, error) {
+	x := new(big.Rat).SetInt64(amount)
+	x.Mul(x, rate)
+	shift := MinorUnits(to) - MinorUnits(from)
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(shift))), nil))
+	if shift >= 0 {
+		x.Mul(x, scale)
+	} else {
+		x.Quo(x, scale)
+	}
+
+	q, r := new(big.Int).QuoRem(x.Num(), x.Denom(), new(big.Int))
+	if r.Sign() != 0 && new(big.Int).Abs(new(big.Int).Lsh(r, 1)).Cmp(x.Denom()) >= 0 {
+		q.Add(q, big.NewInt(int64(x.Sign())))
+	}
+	if !q.IsInt64() {
+		return 0, fmt.Errorf("%d %s is too much to convert to %s", amount, from, to)
+	}
+	return q.Int64(), nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// ParseRate parses an exchange rate written as a decimal, such as "1.6125".
+func ParseRate(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || r.Sign() <= 0 {
+		return nil, fmt.Errorf("bad exchange rate %q", s)
+	}
+	return r, nil
+}
+
+// FormatRate formats an exchange rate as a decimal without trailing zeros.
+// It fails if rate isn't positive or has more than 12 decimal places.
+func FormatRate(rate *big.Rat) (string, error) {
+	if rate.Sign() <= 0 {
+		return "", fmt.Errorf("exchange rate %s isn't positive", rate.RatString())
+	}
+	s := rate.FloatString(rateDigits)
+	if exact, _ := new(big.Rat).SetString(s); exact.Cmp(rate) != 0 {
+		return "", fmt.Errorf("exchange rate %s has more than %d decimal places", rate.RatString(), rateDigits)
+	}
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), "."), nil
+}
+
+// SetExchangeRate records that, from the date effective onwards, one unit of
+// currency is worth rate units of the base currency. A rate already recorded
+// for that date is replaced.
+//
+// The change is made in h's auto-transaction and isn't committed.
+func SetExchangeRate(ctx context.Context, h *db.Handle, currency string, effective time.Time, rate *big.Rat) error {
+	if !ValidCurrency(currency) {
+		return fmt.Errorf("bad currency %q", currency)
+	}
+	s, err := FormatRate(rate)
+	if err != nil {
+		return err
+	}
+	_, err = h.ExecContext(ctx, `
+		INSERT INTO exchange_rate (currency, effective, rate)
+		VALUES (?, ?, ?)
+		ON CONFLICT (currency, effective) DO UPDATE SET rate = excluded.rate`,
+		currency, effective.Format(time.DateOnly), s)
+	return err
+}
+
+// ExchangeRate returns the number of units of the base currency that one
+// unit of currency is worth on the date of t. The base currency is always
+// worth 1. It returns ErrNoRate if no rate had taken effect by then.
+func ExchangeRate(ctx context.Context, h *db.Handle, currency string, t time.Time) (*big.Rat, error) {
+	if currency == BaseCurrency() {
+		return big.NewRat(1, 1), nil
+	}
+
+	var s string
+	err := h.QueryRowContext(ctx, `
+		SELECT rate
+		FROM exchange_rate
+		WHERE currency = ? AND effective <= ?
+		ORDER BY effective DESC
+		LIMIT 1`, currency, t.Format(time.DateOnly)).Scan(&s)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%s on %s: %w", currency, t.Format(time.DateOnly), ErrNoRate)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rate, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("%s on %s: bad exchange rate %q", currency, t.Format(time.DateOnly), s)
+	}
+	return rate, nil
+}
+
+// ToBase converts amount, in minor units of currency, into minor units of the
+// base currency at the exchange rate in force on the date of t.
+func ToBase(ctx context.Context, h *db.Handle, amount int64, currency string, t time.Time) (int64, error) {
+	rate, err := ExchangeRate(ctx, h, currency, t)
+	if err != nil {
+		return 0, err
+	}
+	return Convert(amount, currency, BaseCurrency(), rate)
+}
+
+// ValidCurrency reports whether code looks like an ISO 4217 code.
+func ValidCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package billing
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvert(t *testing.T) {
+	for _, tc := range []struct {
+		amount   int64
+		from, to string
+		rate     string
+		want     int64
+	}{
+		{1000, "GBP", "USD", "1.6125", 1613}, // 16.125 rounds up
+		{-1000, "GBP", "USD", "1.6125", -1613},
+		{1000, "GBP", "USD", "1.6124", 1612},
+		{1995, "USD", "USD", "1", 1995},
+		{1000, "JPY", "USD", "0.0083", 830},     // ¥1000 is $8.30
+		{1995, "USD", "JPY", "120.5", 2404},     // $19.95 is ¥2403.975
+		{1000, "KWD", "USD", "3.3", 330},        // 1.000 KWD is $3.30
+		{1, "USD", "ITL", "1700.123456789", 17}, // 1 cent is 17.00123 lire
+		{3, "USD", "GBP", "0.5", 2},             // 1.5 pence rounds away from zero
+	} {
+		rate, err := ParseRate(tc.rate)
+		require.NoError(t, err)
+		got, err := Convert(tc.amount, tc.from, tc.to, rate)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, got, "%d %s to %s at %s", tc.amount, tc.from, tc.to, tc.rate)
+	}
+
+	_, err := Convert(1<<62, "USD", "ITL", big.NewRat(2000, 1))
+	assert.ErrorContains(t, err, "too much")
+}
+
+func TestFormatRate(t *testing.T) {
+	s, err := FormatRate(big.NewRat(16125, 10000))
+	require.NoError(t, err)
+	assert.Equal(t, "1.6125", s)
+
+	s, err = FormatRate(big.NewRat(120, 1))
+	require.NoError(t, err)
+	assert.Equal(t, "120", s)
+
+	_, err = FormatRate(big.NewRat(1, 3))
+	require.ErrorContains(t, err, "decimal places")
+	_, err = FormatRate(big.NewRat(0, 1))
+	require.Error(t, err)
+
+	_, err = ParseRate("-1")
+	require.Error(t, err)
+	_, err = ParseRate("one")
+	require.Error(t, err)
+}
+
+func TestExchangeRate(t *testing.T) {
+	_, h := setupCreditTest(t)
+	ctx := context.Background()
+	day := func(d int) time.Time { return time.Date(1999, 3, d, 12, 0, 0, 0, time.UTC) }
+
+	require.NoError(t, SetExchangeRate(ctx, h, "GBP", day(1), big.NewRat(16, 10)))
+	require.NoError(t, SetExchangeRate(ctx, h, "GBP", day(10), big.NewRat(161, 100)))
+	require.NoError(t, SetExchangeRate(ctx, h, "GBP", day(10), big.NewRat(162, 100))) // Replaces
+
+	rate, err := ExchangeRate(ctx, h, "GBP", day(9))
+	require.NoError(t, err)
+	assert.Equal(t, "8/5", rate.RatString())
+
+	rate, err = ExchangeRate(ctx, h, "GBP", day(10))
+	require.NoError(t, err)
+	assert.Equal(t, "81/50", rate.RatString())
+
+	_, err = ExchangeRate(ctx, h, "GBP", day(0))
+	require.ErrorIs(t, err, ErrNoRate)
+	_, err = ExchangeRate(ctx, h, "DEM", day(10))
+	require.ErrorIs(t, err, ErrNoRate)
+
+	rate, err = ExchangeRate(ctx, h, BaseCurrency(), day(0))
+	require.NoError(t, err)
+	assert.Equal(t, "1", rate.RatString())
+
+	base, err := ToBase(ctx, h, 1000, "GBP", day(20))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1620), base)
+
+	require.Error(t, SetExchangeRate(ctx, h, "gbp", day(1), big.NewRat(1, 1)))
+	require.Error(t, SetExchangeRate(ctx, h, "GBP", day(1), big.NewRat(1, 3)))
+}
@@ -0,0 +1,95 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nosborn/ibgames-1999/db"
+)
+
+// ErrNoPrice is returned when a bundle of minutes isn't on the price list.
+var ErrNoPrice = errors.New("not on the price list")
+
+// Price is an entry in the price list: what a bundle of minutes of a product
+// costs in a currency from a date onwards.
+type Price struct {
+	Product   Product
+	Currency  string // ISO 4217 code, such as USD
+	Minutes   int
+	Effective time.Time
+	Price     int64 // In minor units of Currency
+}
+
+// SetPrice adds p to the price list, replacing any price for the same bundle
+// that takes effect on the same date.
+//
+// The change is made in h's auto-transaction and isn't committed.
+func SetPrice(ctx context.Context, h *db.Handle, p *Price) error {
+	if !ValidCurrency(p.Currency) {
+		return fmt.Errorf("bad currency %q", p.Currency)
+	}
+	if p.Minutes <= 0 || p.Price < 0 {
+		return fmt.Errorf("bad price %d for %d minutes", p.Price, p.Minutes)
+	}
+	_, err := h.ExecContext(ctx, `
+		INSERT INTO price_list (product, currency, minutes, effective, price)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (product, currency, minutes, effective) DO UPDATE SET price = excluded.price`,
+		int(p.Product), p.Currency, p.Minutes, p.Effective.Format(time.DateOnly), p.Price)
+	return err
+}
+
+// PriceList returns the prices of product in currency in force on the date of
+// t, smallest bundle first. The result is empty if there are none.
+func PriceList(ctx context.Context, h *db.Handle, product Product, currency string, t time.Time) ([]*Price, error) {
+	return prices(ctx, h, product, currency, 0, t)
+}
+
+// PriceOf returns the price of a bundle of minutes of product in currency in
+// force on the date of t, or ErrNoPrice.
+func PriceOf(ctx context.Context, h *db.Handle, product Product, currency string, minutes int, t time.Time) (*Price, error) {
+	list, err := prices(ctx, h, product, currency, minutes, t)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("%d minutes in %s: %w", minutes, currency, ErrNoPrice)
+	}
+	return list[0], nil
+}
+
+// prices returns the bundles of the given size, or every size if minutes is
+// zero.
+func prices(ctx context.Context, h *db.Handle, product Product, currency string, minutes int, t time.Time) ([]*Price, error) {
+	rows, err := h.QueryContext(ctx, `
+		SELECT p.minutes, p.effective, p.price
+		FROM price_list p
+		WHERE p.product = ? AND p.currency = ? AND (? = 0 OR p.minutes = ?)
+			AND p.effective = (
+				SELECT MAX(q.effective)
+				FROM price_list q
+				WHERE q.product = p.product AND q.currency = p.currency
+					AND q.minutes = p.minutes AND q.effective <= ?)
+		ORDER BY p.minutes`,
+		int(product), currency, minutes, minutes, t.Format(time.DateOnly))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*Price
+	for rows.Next() {
+		p := Price{Product: product, Currency: currency}
+		var effective string
+		if err := rows.Scan(&p.Minutes, &effective, &p.Price); err != nil {
+			return nil, err
+		}
+		if p.Effective, err = time.Parse(time.DateOnly, effective); err != nil {
+			return nil, err
+		}
+		list = append(list, &p)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,50 @@
+package billing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPriceList(t *testing.T) {
+	_, h := setupCreditTest(t)
+	ctx := context.Background()
+	day := func(d int) time.Time { return time.Date(1999, 3, d, 0, 0, 0, 0, time.UTC) }
+
+	for _, p := range []*Price{
+		{Federation, "USD", 600, day(1), 1995},
+		{Federation, "USD", 120, day(1), 495},
+		{Federation, "USD", 600, day(15), 1795},
+		{Federation, "GBP", 600, day(1), 1195},
+		{AgeOfAdventure, "USD", 600, day(1), 2495},
+	} {
+		require.NoError(t, SetPrice(ctx, h, p))
+	}
+
+	list, err := PriceList(ctx, h, Federation, "USD", day(10))
+	require.NoError(t, err)
+	assert.Equal(t, []*Price{
+		{Federation, "USD", 120, day(1), 495},
+		{Federation, "USD", 600, day(1), 1995},
+	}, list)
+
+	p, err := PriceOf(ctx, h, Federation, "USD", 600, day(20))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1795), p.Price)
+	assert.Equal(t, day(15), p.Effective)
+
+	_, err = PriceOf(ctx, h, Federation, "USD", 300, day(20))
+	require.ErrorIs(t, err, ErrNoPrice)
+	_, err = PriceOf(ctx, h, Federation, "USD", 600, time.Date(1998, 12, 31, 0, 0, 0, 0, time.UTC))
+	require.ErrorIs(t, err, ErrNoPrice)
+
+	list, err = PriceList(ctx, h, Federation, "JPY", day(10))
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	require.Error(t, SetPrice(ctx, h, &Price{Federation, "USD", 0, day(1), 100}))
+	require.Error(t, SetPrice(ctx, h, &Price{Federation, "US", 60, day(1), 100}))
+}
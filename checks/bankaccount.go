@@ -0,0 +1,111 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nosborn/ibgames-1999"
+	"github.com/nosborn/ibgames-1999/db"
+)
+
+// BankAccount is an account that a player's checks are drawn on, a row of
+// the bank_accounts table.
+type BankAccount struct {
+	ID      int64
+	UID     ibgames.AccountID
+	Routing string // ABA routing number
+	Account string
+	Holder  string
+	Added   time.Time // Set by AddBankAccount
+}
+
+// AddBankAccount records b for account b.UID and sets b.ID and b.Added. If
+// the player already has the bank account, the existing record is used.
+//
+// The change is made in h's auto-transaction and isn't committed.
+func AddBankAccount(ctx context.Context, h *db.Handle, b *BankAccount) error {
+	if !validRouting(b.Routing) {
+		return fmt.Errorf("bad routing number %q", b.Routing)
+	}
+	if len(b.Account) == 0 || len(b.Account) > 17 || !digits(b.Account) {
+		return fmt.Errorf("bad bank account number %q", b.Account)
+	}
+
+	var holder any
+	if b.Holder != "" {
+		holder = b.Holder
+	}
+	_, err := h.ExecContext(ctx, `
+		INSERT INTO bank_accounts (uid, routing, account, holder)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (uid, routing, account) DO NOTHING`,
+		b.UID, b.Routing, b.Account, holder)
+	if err != nil {
+		return err
+	}
+
+	var added string
+	err = h.QueryRowContext(ctx, `
+		SELECT bid, added
+		FROM bank_accounts
+		WHERE uid = ? AND routing = ? AND account = ?`,
+		b.UID, b.Routing, b.Account).Scan(&b.ID, &added)
+	if err != nil {
+		return err
+	}
+	b.Added, err = time.Parse(time.DateOnly, added)
+	return err
+}
+
+// BankAccounts returns the bank accounts of account uid in the order they
+// were added. The result is empty if there are none.
+func BankAccounts(ctx context.Context, h *db.Handle, uid ibgames.AccountID) ([]*BankAccount, error) {
+	rows, err := h.QueryContext(ctx, `
+		SELECT bid, uid, routing, account, COALESCE(holder, ''), added
+		FROM bank_accounts
+		WHERE uid = ?
+		ORDER BY bid`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*BankAccount
+	for rows.Next() {
+		var (
+			b     BankAccount
+			added string
+		)
+		if err := rows.Scan(&b.ID, &b.UID, &b.Routing, &b.Account, &b.Holder, &added); err != nil {
+			return nil, err
+		}
+		if b.Added, err = time.Parse(time.DateOnly, added); err != nil {
+			return nil, fmt.Errorf("bank account %d: %w", b.ID, err)
+		}
+		list = append(list, &b)
+	}
+	return list, rows.Err()
+}
+
+// validRouting reports whether s is a nine digit ABA routing number with a
+// good check digit.
+func validRouting(s string) bool {
+	if len(s) != 9 || !digits(s) {
+		return false
+	}
+	sum := 0
+	for i := range len(s) {
+		sum += int(s[i]-'0') * [3]int{3, 7, 1}[i%3]
+	}
+	return sum%10 == 0
+}
+
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package checks
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nosborn/ibgames-1999/db"
+	"github.com/nosborn/ibgames-1999/internal/testutil"
+)
+
+func setupChecksTest(t *testing.T) (*testutil.DatabaseSetup, *db.Handle) {
+	setup := testutil.SetupTestDatabaseWithSchema(t)
+	h, err := db.Open(filepath.Dir(setup.FilePath), false)
+	require.NoError(t, err)
+	t.Cleanup(h.Abandon)
+	return setup, h
+}
+
+func TestAddBankAccount(t *testing.T) {
+	setup, h := setupChecksTest(t)
+	ctx := context.Background()
+	setup.CreateTestAccount(t, 666500, "Player", "N", 0)
+	setup.CreateTestAccount(t, 666501, "Spouse", "N", 0)
+
+	b := &BankAccount{UID: 666500, Routing: "011000015", Account: "123456789", Holder: "A Player"}
+	require.NoError(t, AddBankAccount(ctx, h, b))
+	assert.Positive(t, b.ID)
+	assert.False(t, b.Added.IsZero())
+
+	// The same bank account again is the same record, but another player's
+	// use of it isn't.
+	again := &BankAccount{UID: 666500, Routing: "011000015", Account: "123456789"}
+	require.NoError(t, AddBankAccount(ctx, h, again))
+	assert.Equal(t, b.ID, again.ID)
+	shared := &BankAccount{UID: 666501, Routing: "011000015", Account: "123456789"}
+	require.NoError(t, AddBankAccount(ctx, h, shared))
+	assert.NotEqual(t, b.ID, shared.ID)
+
+	list, err := BankAccounts(ctx, h, 666500)
+	require.NoError(t, err)
+	assert.Equal(t, []*BankAccount{b}, list)
+
+	for _, bad := range []BankAccount{
+		{UID: 666500, Routing: "011000016", Account: "1"},  // Check digit
+		{UID: 666500, Routing: "01100001", Account: "1"},   // Too short
+		{UID: 666500, Routing: "011000015", Account: ""},   // No account
+		{UID: 666500, Routing: "011000015", Account: "1x"}, // Not digits
+	} {
+		require.Error(t, AddBankAccount(ctx, h, &bad), "%+v", bad)
+	}
+}
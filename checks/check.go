@@ -0,0 +1,318 @@
+// Package checks records payments made by check. A check is received, then
+// either clears, when its minutes are credited, or bounces. A bounce reverses
+// any credit and marks the account bad_check, and such accounts may not pay by
+// check again.
+package checks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nosborn/ibgames-1999"
+	"github.com/nosborn/ibgames-1999/billing"
+	"github.com/nosborn/ibgames-1999/db"
+)
+
+// ErrNotFound is returned when there is no check with the ID given.
+var ErrNotFound = errors.New("check not found")
+
+// ErrBadCheck is returned by Receive for an account that has bounced a check
+// before.
+var ErrBadCheck = errors.New("account has bounced a check")
+
+// ErrSettled is returned when a check has already cleared or bounced.
+var ErrSettled = errors.New("check already settled")
+
+// ErrDuplicateCheck is returned by Receive for a check number that has
+// already been received on the same bank account, or from the same player if
+// no bank account is given.
+var ErrDuplicateCheck = errors.New("check already received")
+
+// Status is where a check has got to. The values are the characters stored
+// in checks.status.
+type Status byte
+
+const (
+	Received Status = 'R'
+	Cleared  Status = 'C'
+	Bounced  Status = 'B'
+)
+
+func (s Status) String() string {
+	switch s {
+	case Received:
+		return "received"
+	case Cleared:
+		return "cleared"
+	case Bounced:
+		return "bounced"
+	default:
+		return "Status(" + strconv.Quote(string(rune(s))) + ")"
+	}
+}
+
+// Check is a check received from a player, a row of the checks table. Zero
+// times and IDs stand for NULL columns.
+type Check struct {
+	ID            int64
+	UID           ibgames.AccountID // Account to be credited
+	BankAccountID int64             // Bank account the check is drawn on
+	Number        string            // Check number
+	Amount        int64             // In minor units of Currency
+	Currency      string            // ISO 4217 code, such as USD
+	Minutes       int               // Credited when the check clears
+	Received      time.Time         // Today if not set
+	Status        Status
+	Settled       time.Time         // When the check cleared or bounced
+	CreditID      int64             // Credit made when the check cleared
+	AdminUID      ibgames.AccountID // Administrator who entered the check
+}
+
+const columns = `
+	chid, uid, COALESCE(bid, 0), COALESCE(check_number, ''), amount, currency,
+	minutes, received, status, settled, COALESCE(cid, 0), COALESCE(admin_uid, 0)`
+
+// scanner is satisfied by both *db.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scan(row scanner) (*Check, error) {
+	var (
+		c                Check
+		received, status string
+		settled          sql.NullString
+	)
+	err := row.Scan(&c.ID, &c.UID, &c.BankAccountID, &c.Number, &c.Amount, &c.Currency,
+		&c.Minutes, &received, &status, &settled, &c.CreditID, &c.AdminUID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(status) == 1 {
+		c.Status = Status(status[0])
+	}
+	if c.Received, err = time.Parse(time.DateOnly, received); err != nil {
+		return nil, fmt.Errorf("check %d: %w", c.ID, err)
+	}
+	if settled.Valid {
+		if c.Settled, err = time.Parse(time.DateOnly, settled.String); err != nil {
+			return nil, fmt.Errorf("check %d: %w", c.ID, err)
+		}
+	}
+	return &c, nil
+}
+
+// Get returns check id, or ErrNotFound.
+func Get(ctx context.Context, h *db.Handle, id int64) (*Check, error) {
+	return scan(h.QueryRowContext(ctx, "SELECT "+columns+" FROM checks WHERE chid = ?", id))
+}
+
+// Pending returns the checks that have neither cleared nor bounced, oldest
+// first.
+func Pending(ctx context.Context, h *db.Handle) ([]*Check, error) {
+	return list(ctx, h, "SELECT "+columns+" FROM checks WHERE status = 'R' ORDER BY received, chid")
+}
+
+// ForAccount returns the checks of account uid, oldest first.
+func ForAccount(ctx context.Context, h *db.Handle, uid ibgames.AccountID) ([]*Check, error) {
+	return list(ctx, h, "SELECT "+columns+" FROM checks WHERE uid = ? ORDER BY received, chid", uid)
+}
+
+func list(ctx context.Context, h *db.Handle, query string, args ...any) ([]*Check, error) {
+	rows, err := h.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checks []*Check
+	for rows.Next() {
+		c, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, c)
+	}
+	return checks, rows.Err()
+}
+
+// Receive records check c, which must be drawn on one of the player's own
+// bank accounts if c.BankAccountID is set. It sets c.ID, c.Received and
+// c.Status. Nothing is credited until the check clears. It returns
+// ErrBadCheck if the account has bounced a check before, and
+// ErrDuplicateCheck if the check has been received already.
+//
+// The change is made in h's auto-transaction and isn't committed.
+func Receive(ctx context.Context, h *db.Handle, c *Check) error {
+	if c.Amount <= 0 || c.Minutes <= 0 {
+		return fmt.Errorf("check for %d of %d minutes", c.Amount, c.Minutes)
+	}
+	if !billing.ValidCurrency(c.Currency) {
+		return fmt.Errorf("bad currency %q", c.Currency)
+	}
+
+	var badCheck string
+	err := h.QueryRowContext(ctx, "SELECT bad_check FROM accounts WHERE uid = ?", c.UID).Scan(&badCheck)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("account %d: %w", c.UID, billing.ErrNoSuchAccount)
+	}
+	if err != nil {
+		return err
+	}
+	if badCheck == "Y" {
+		return fmt.Errorf("account %d: %w", c.UID, ErrBadCheck)
+	}
+
+	var bid any
+	if c.BankAccountID != 0 {
+		var owner ibgames.AccountID
+		err := h.QueryRowContext(ctx, "SELECT uid FROM bank_accounts WHERE bid = ?", c.BankAccountID).Scan(&owner)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if owner != c.UID {
+			return fmt.Errorf("bank account %d doesn't belong to account %d", c.BankAccountID, c.UID)
+		}
+		bid = c.BankAccountID
+	}
+	var number, received, adminUID any
+	if c.Number != "" {
+		number = c.Number
+	}
+	if !c.Received.IsZero() {
+		received = c.Received.Format(time.DateOnly)
+	}
+	if c.AdminUID != 0 {
+		adminUID = int64(c.AdminUID)
+	}
+
+	result, err := h.ExecContext(ctx, `
+		INSERT INTO checks (uid, bid, check_number, amount, currency, minutes, received, admin_uid)
+		VALUES (?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_DATE), ?)`,
+		c.UID, bid, number, c.Amount, c.Currency, c.Minutes, received, adminUID)
+	if db.IsUniqueViolation(err) {
+		return fmt.Errorf("check %s from account %d: %w", c.Number, c.UID, ErrDuplicateCheck)
+	}
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	saved, err := Get(ctx, h, id)
+	if err != nil {
+		return err
+	}
+	*c = *saved
+	return nil
+}
+
+// Clear records that check id has cleared and credits its minutes to the
+// account, both or neither. adminUID is recorded against the credit if it
+// isn't zero.
+//
+// The change is made in h's auto-transaction and isn't committed.
+func Clear(ctx context.Context, h *db.Handle, id int64, adminUID ibgames.AccountID) (*Check, error) {
+	c, err := Get(ctx, h, id)
+	if err != nil {
+		return nil, err
+	}
+	if c.Status != Received {
+		return nil, fmt.Errorf("check %d %v: %w", id, c.Status, ErrSettled)
+	}
+
+	err = h.WithSavepointContext(ctx, "clear_check", func() error {
+		credit := &billing.Credit{
+			UID:       c.UID,
+			Minutes:   c.Minutes,
+			Price:     c.Amount,
+			Currency:  c.Currency,
+			Method:    billing.PaidByCheck,
+			Reference: c.Number,
+			AdminUID:  adminUID,
+		}
+		if err := billing.Purchase(ctx, h, credit); err != nil {
+			return err
+		}
+		_, err := h.ExecContext(ctx, `
+			UPDATE checks
+			SET status = 'C', settled = CURRENT_DATE, cid = ?
+			WHERE chid = ?`, credit.ID, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return Get(ctx, h, id)
+}
+
+// Bounce records that check id has bounced. If it had cleared, its credit is
+// reversed, and the number of minutes that had already been used and
+// couldn't be taken back is returned. The account is marked bad_check and,
+// if suspend is true and the account is active, suspended. adminUID is
+// recorded as the last administrator to change the account if it isn't
+// zero. Callers holding an accounts.StatusCache should invalidate the
+// account.
+//
+// The change is made in h's auto-transaction and isn't committed.
+func Bounce(ctx context.Context, h *db.Handle, id int64, adminUID ibgames.AccountID, suspend bool) (int, error) {
+	c, err := Get(ctx, h, id)
+	if err != nil {
+		return 0, err
+	}
+	if c.Status == Bounced {
+		return 0, fmt.Errorf("check %d: %w", id, ErrSettled)
+	}
+
+	var admin any
+	if adminUID != 0 {
+		admin = int64(adminUID)
+	}
+	newStatus := string(rune(ibgames.AccountActive))
+	if suspend {
+		newStatus = string(rune(ibgames.AccountSuspended))
+	}
+	reason := "Bounced check"
+	if c.Number != "" {
+		reason += " " + c.Number
+	}
+
+	var shortfall int
+	err = h.WithSavepointContext(ctx, "bounce_check", func() error {
+		if c.Status == Cleared {
+			var err error
+			if shortfall, err = billing.Reverse(ctx, h, c.CreditID); err != nil {
+				return err
+			}
+		}
+		_, err := h.ExecContext(ctx, `
+			UPDATE checks
+			SET status = 'B', settled = CURRENT_DATE
+			WHERE chid = ?`, id)
+		if err != nil {
+			return err
+		}
+		_, err = h.ExecContext(ctx, `
+			UPDATE accounts
+			SET bad_check = 'Y',
+				status_reason = CASE WHEN status = 'A' AND ? = 'S' THEN ? ELSE status_reason END,
+				status = CASE WHEN status = 'A' THEN ? ELSE status END,
+				admin_uid = COALESCE(?, admin_uid),
+				admin_date = CASE WHEN ? IS NULL THEN admin_date ELSE CURRENT_DATE END
+			WHERE uid = ?`,
+			newStatus, reason, newStatus, admin, admin, c.UID)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return shortfall, nil
+}
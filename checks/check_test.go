@@ -0,0 +1,247 @@
+package checks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nosborn/ibgames-1999"
+	"github.com/nosborn/ibgames-1999/accounts"
+	"github.com/nosborn/ibgames-1999/billing"
+	"github.com/nosborn/ibgames-1999/internal/testutil"
+)
+
+func minutes(t *testing.T, setup *testutil.DatabaseSetup, uid ibgames.AccountID) int {
+	var n int
+	require.NoError(t, setup.TestDB.QueryRow("SELECT minutes FROM accounts WHERE uid = ?", uid).Scan(&n))
+	return n
+}
+
+func TestReceive(t *testing.T) {
+	setup, h := setupChecksTest(t)
+	ctx := context.Background()
+	setup.CreateTestAccount(t, 666510, "Admin", "Y", 0)
+	setup.CreateTestAccount(t, 666511, "Player", "N", 10)
+	setup.CreateTestAccount(t, 666512, "Other", "N", 10)
+
+	b := &BankAccount{UID: 666511, Routing: "011000015", Account: "123456789"}
+	require.NoError(t, AddBankAccount(ctx, h, b))
+
+	c := &Check{
+		UID:           666511,
+		BankAccountID: b.ID,
+		Number:        "1001",
+		Amount:        1995,
+		Currency:      "USD",
+		Minutes:       600,
+		Received:      time.Date(1999, 3, 1, 0, 0, 0, 0, time.UTC),
+		AdminUID:      666510,
+	}
+	require.NoError(t, Receive(ctx, h, c))
+	assert.Positive(t, c.ID)
+	assert.Equal(t, Received, c.Status)
+	assert.Equal(t, 10, minutes(t, setup, 666511)) // Nothing until it clears
+
+	got, err := Get(ctx, h, c.ID)
+	require.NoError(t, err)
+	assert.Equal(t, c, got)
+
+	today := &Check{UID: 666511, Amount: 995, Currency: "USD", Minutes: 300}
+	require.NoError(t, Receive(ctx, h, today))
+	assert.Equal(t, time.Now().UTC().Format(time.DateOnly), today.Received.Format(time.DateOnly))
+
+	pending, err := Pending(ctx, h)
+	require.NoError(t, err)
+	assert.Equal(t, []*Check{c, today}, pending)
+
+	t.Run("someone else's bank account", func(t *testing.T) {
+		c := &Check{UID: 666512, BankAccountID: b.ID, Amount: 995, Currency: "USD", Minutes: 300}
+		require.Error(t, Receive(ctx, h, c))
+	})
+
+	t.Run("missing account", func(t *testing.T) {
+		c := &Check{UID: 999999, Amount: 995, Currency: "USD", Minutes: 300}
+		require.ErrorIs(t, Receive(ctx, h, c), billing.ErrNoSuchAccount)
+	})
+
+	t.Run("bad check account", func(t *testing.T) {
+		require.NoError(t, h.Commit())
+		_, err := setup.TestDB.Exec("UPDATE accounts SET bad_check = 'Y' WHERE uid = 666512")
+		require.NoError(t, err)
+		require.NoError(t, h.Rollback())
+
+		c := &Check{UID: 666512, Amount: 995, Currency: "USD", Minutes: 300}
+		require.ErrorIs(t, Receive(ctx, h, c), ErrBadCheck)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		require.Error(t, Receive(ctx, h, &Check{UID: 666511, Currency: "USD", Minutes: 300}))
+		require.Error(t, Receive(ctx, h, &Check{UID: 666511, Amount: 995, Currency: "USD"}))
+		require.Error(t, Receive(ctx, h, &Check{UID: 666511, Amount: 995, Currency: "usd", Minutes: 300}))
+		require.Error(t, Receive(ctx, h, &Check{UID: 666511, Amount: 995, Minutes: 300}))
+	})
+
+	t.Run("invalid currency refused by the database", func(t *testing.T) {
+		require.NoError(t, h.Commit())
+		_, err := setup.TestDB.Exec(`
+			INSERT INTO checks (uid, amount, currency, minutes)
+			VALUES (666511, 995, 'US$', 300)`)
+		require.ErrorContains(t, err, "CHECK constraint failed")
+	})
+
+	t.Run("duplicate check number", func(t *testing.T) {
+		again := &Check{UID: 666511, BankAccountID: b.ID, Number: "1001", Amount: 995, Currency: "USD", Minutes: 300}
+		require.ErrorIs(t, Receive(ctx, h, again), ErrDuplicateCheck)
+		require.NoError(t, h.Rollback())
+
+		// The same number on another account is a different check, and
+		// checks without a number are never duplicates.
+		other := &BankAccount{UID: 666511, Routing: "011000015", Account: "987654321"}
+		require.NoError(t, AddBankAccount(ctx, h, other))
+		again.BankAccountID = other.ID
+		require.NoError(t, Receive(ctx, h, again))
+		require.NoError(t, Receive(ctx, h, &Check{UID: 666511, Amount: 995, Currency: "USD", Minutes: 300}))
+		require.NoError(t, h.Rollback())
+	})
+
+	t.Run("duplicate check number without a bank account", func(t *testing.T) {
+		c := &Check{UID: 666511, Number: "2001", Amount: 995, Currency: "USD", Minutes: 300}
+		require.NoError(t, Receive(ctx, h, c))
+		again := *c
+		require.ErrorIs(t, Receive(ctx, h, &again), ErrDuplicateCheck)
+
+		// Another player's check may have the same number.
+		require.NoError(t, Receive(ctx, h, &Check{UID: 666510, Number: "2001", Amount: 995, Currency: "USD", Minutes: 300}))
+		require.NoError(t, h.Rollback())
+	})
+}
+
+func TestClear(t *testing.T) {
+	setup, h := setupChecksTest(t)
+	ctx := context.Background()
+	setup.CreateTestAccount(t, 666515, "Admin", "Y", 0)
+	setup.CreateTestAccount(t, 666516, "Player", "N", 10)
+
+	c := &Check{UID: 666516, Number: "1002", Amount: 1995, Currency: "USD", Minutes: 600}
+	require.NoError(t, Receive(ctx, h, c))
+
+	cleared, err := Clear(ctx, h, c.ID, 666515)
+	require.NoError(t, err)
+	require.NoError(t, h.Commit())
+	assert.Equal(t, Cleared, cleared.Status)
+	assert.False(t, cleared.Settled.IsZero())
+	assert.Equal(t, 610, minutes(t, setup, 666516))
+
+	credits, err := billing.CreditHistory(ctx, h, 666516)
+	require.NoError(t, err)
+	require.Len(t, credits, 1)
+	assert.Equal(t, cleared.CreditID, credits[0].ID)
+	assert.Equal(t, billing.PaidByCheck, credits[0].Method)
+	assert.Equal(t, "1002", credits[0].Reference)
+	assert.Equal(t, ibgames.AccountID(666515), credits[0].AdminUID)
+
+	_, err = Clear(ctx, h, c.ID, 666515)
+	require.ErrorIs(t, err, ErrSettled)
+	_, err = Clear(ctx, h, 999999, 666515)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	pending, err := Pending(ctx, h)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestBounce(t *testing.T) {
+	setup, h := setupChecksTest(t)
+	ctx := context.Background()
+	setup.CreateTestAccount(t, 666520, "Admin", "Y", 0)
+	setup.CreateTestAccount(t, 666521, "Player", "N", 10)
+	setup.CreateTestAccount(t, 666522, "Spender", "N", 10)
+	setup.CreateTestAccount(t, 666523, "Careless", "N", 10)
+
+	receive := func(uid ibgames.AccountID) *Check {
+		t.Helper()
+		c := &Check{UID: uid, Number: "1003", Amount: 1995, Currency: "USD", Minutes: 600}
+		require.NoError(t, Receive(ctx, h, c))
+		return c
+	}
+
+	t.Run("after clearing", func(t *testing.T) {
+		c := receive(666521)
+		_, err := Clear(ctx, h, c.ID, 666520)
+		require.NoError(t, err)
+
+		shortfall, err := Bounce(ctx, h, c.ID, 666520, true)
+		require.NoError(t, err)
+		assert.Zero(t, shortfall)
+		require.NoError(t, h.Commit())
+		assert.Equal(t, 10, minutes(t, setup, 666521))
+
+		got, err := Get(ctx, h, c.ID)
+		require.NoError(t, err)
+		assert.Equal(t, Bounced, got.Status)
+
+		a, err := accounts.Get(ctx, h, 666521)
+		require.NoError(t, err)
+		assert.True(t, a.BadCheck)
+		assert.Equal(t, ibgames.AccountSuspended, a.Status)
+		assert.Equal(t, "Bounced check 1003", a.StatusReason)
+		assert.Equal(t, ibgames.AccountID(666520), a.AdminUID)
+
+		credits, err := billing.CreditHistory(ctx, h, 666521)
+		require.NoError(t, err)
+		require.Len(t, credits, 1)
+		assert.False(t, credits[0].Reversed.IsZero())
+
+		// No more checks from this account.
+		require.ErrorIs(t, Receive(ctx, h, &Check{UID: 666521, Amount: 1, Currency: "USD", Minutes: 1}), ErrBadCheck)
+
+		_, err = Bounce(ctx, h, c.ID, 666520, true)
+		require.ErrorIs(t, err, ErrSettled)
+	})
+
+	t.Run("minutes already used", func(t *testing.T) {
+		c := receive(666522)
+		_, err := Clear(ctx, h, c.ID, 0)
+		require.NoError(t, err)
+		_, err = h.Exec("UPDATE accounts SET minutes = 400 WHERE uid = 666522")
+		require.NoError(t, err)
+
+		shortfall, err := Bounce(ctx, h, c.ID, 0, false)
+		require.NoError(t, err)
+		assert.Equal(t, 200, shortfall)
+		require.NoError(t, h.Commit())
+		assert.Zero(t, minutes(t, setup, 666522))
+
+		a, err := accounts.Get(ctx, h, 666522)
+		require.NoError(t, err)
+		assert.True(t, a.BadCheck)
+		assert.Equal(t, ibgames.AccountActive, a.Status) // Not suspended
+		assert.Empty(t, a.StatusReason)
+	})
+
+	t.Run("before clearing", func(t *testing.T) {
+		c := receive(666523)
+		shortfall, err := Bounce(ctx, h, c.ID, 666520, false)
+		require.NoError(t, err)
+		assert.Zero(t, shortfall)
+		require.NoError(t, h.Commit())
+		assert.Equal(t, 10, minutes(t, setup, 666523))
+
+		_, err = Clear(ctx, h, c.ID, 666520)
+		require.ErrorIs(t, err, ErrSettled)
+
+		checks, err := ForAccount(ctx, h, 666523)
+		require.NoError(t, err)
+		require.Len(t, checks, 1)
+		assert.Equal(t, Bounced, checks[0].Status)
+		assert.Zero(t, checks[0].CreditID)
+	})
+}
+
+func TestStatusString(t *testing.T) {
+	assert.Equal(t, "bounced", Bounced.String())
+	assert.Equal(t, `Status("Z")`, Status('Z').String())
+}
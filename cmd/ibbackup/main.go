@@ -0,0 +1,90 @@
+// Command ibbackup backs up and restores the accounts database.
+//
+// Usage:
+//
+//	ibbackup backup FILE
+//	ibbackup snapshot [-keep N] DIR
+//	ibbackup restore FILE
+//
+// The database is found through DBPATH. Backups can be taken while the game
+// servers are running, and so can a restore: the servers move over to the
+// restored database at their next transaction boundary. A restore fails if
+// another program is writing to the database at the time, and programs that
+// don't use the db package must be stopped first.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/nosborn/ibgames-1999/config"
+	"github.com/nosborn/ibgames-1999/db"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: ibbackup backup FILE\n")
+	fmt.Fprintf(os.Stderr, "       ibbackup snapshot [-keep N] DIR\n")
+	fmt.Fprintf(os.Stderr, "       ibbackup restore FILE\n")
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("ibbackup: ")
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+	ctx := context.Background()
+
+	switch os.Args[1] {
+	case "backup":
+		if len(os.Args) != 3 {
+			usage()
+		}
+		connect()
+		err := db.Backup(ctx, os.Args[2])
+		_ = db.Exit()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+	case "snapshot":
+		fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+		keep := fs.Int("keep", 0, "number of snapshots to keep (0 keeps all)")
+		_ = fs.Parse(os.Args[2:])
+		if fs.NArg() != 1 {
+			usage()
+		}
+		connect()
+		name, err := db.Snapshot(ctx, fs.Arg(0), *keep)
+		_ = db.Exit()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(name)
+
+	case "restore":
+		if len(os.Args) != 3 {
+			usage()
+		}
+		if err := config.Init(); err != nil {
+			log.Fatal(err)
+		}
+		if err := db.Restore(ctx, os.Args[2], config.Get().DBPath); err != nil {
+			log.Fatal(err)
+		}
+
+	default:
+		usage()
+	}
+}
+
+func connect() {
+	if err := db.Connect(true); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/nosborn/ibgames-1999/accounts"
+	"github.com/nosborn/ibgames-1999/db"
+)
+
+// Report is the machine-readable result of a run.
+type Report struct {
+	Database string   `json:"database"`
+	OK       bool     `json:"ok"`
+	Checks   []Result `json:"checks"`
+}
+
+// Result is the outcome of one check. Error is set if the check itself
+// couldn't be run, which counts as a failure.
+type Result struct {
+	Name     string   `json:"name"`
+	OK       bool     `json:"ok"`
+	Problems []string `json:"problems,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+type check struct {
+	name string
+	run  func(ctx context.Context, h *db.Handle) ([]string, error)
+}
+
+// checks returns every check in the order they are run. headroom is the
+// number of values that must remain in each SERIAL column before the overflow
+// triggers fire.
+func checks(headroom int64) []check {
+	return []check{
+		{"integrity_check", func(ctx context.Context, h *db.Handle) ([]string, error) {
+			return h.IntegrityCheck(ctx)
+		}},
+		{"foreign_key_check", foreignKeyCheck},
+		{"name_key", nameKeyCheck},
+		{"negative_minutes", queryCheck(`
+			SELECT 'account ' || uid || ' has ' || minutes || ' minutes'
+			FROM accounts
+			WHERE complimentary <> 'Y' AND minutes < 0
+			ORDER BY uid`)},
+		{"session_times", queryCheck(`
+			SELECT 'session ' || sid || ' ends at ' || end || ', before it begins at ' || begin
+			FROM sessions
+			WHERE end < begin
+			ORDER BY sid`)},
+		{"cancelled_buddy", queryCheck(`
+			SELECT 'account ' || a.uid || ' has cancelled buddy ' || a.buddy_uid
+			FROM accounts a
+			JOIN accounts b ON b.uid = a.buddy_uid
+			WHERE b.status = 'X'
+			ORDER BY a.uid`)},
+		{"serial_headroom", func(ctx context.Context, h *db.Handle) ([]string, error) {
+			return headroomCheck(ctx, h, headroom)
+		}},
+	}
+}
+
+// connectFailed returns the report for a database that couldn't be opened,
+// so that the failure reaches whatever reads the JSON.
+func connectFailed(err error) Report {
+	return Report{Checks: []Result{{Name: "connect", Error: err.Error()}}}
+}
+
+// runChecks runs every check against h.
+func runChecks(ctx context.Context, h *db.Handle, headroom int64) Report {
+	report := Report{OK: true}
+	for _, c := range checks(headroom) {
+		problems, err := c.run(ctx, h)
+		result := Result{Name: c.name, Problems: problems}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		result.OK = err == nil && len(problems) == 0
+		report.OK = report.OK && result.OK
+		report.Checks = append(report.Checks, result)
+	}
+	return report
+}
+
+// queryCheck returns a check that reports each row of query, which must
+// return a single text column, as a problem.
+func queryCheck(query string) func(ctx context.Context, h *db.Handle) ([]string, error) {
+	return func(ctx context.Context, h *db.Handle) ([]string, error) {
+		rows, err := h.QueryContext(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var problems []string
+		for rows.Next() {
+			var msg string
+			if err := rows.Scan(&msg); err != nil {
+				return nil, err
+			}
+			problems = append(problems, msg)
+		}
+		return problems, rows.Err()
+	}
+}
+
+func foreignKeyCheck(ctx context.Context, h *db.Handle) ([]string, error) {
+	rows, err := h.QueryContext(ctx, "PRAGMA foreign_key_check")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var (
+			table, parent string
+			rowid         *int64
+			fkid          int
+		)
+		if err := rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			return nil, err
+		}
+		if rowid != nil {
+			problems = append(problems, fmt.Sprintf("%s row %d has no parent in %s", table, *rowid, parent))
+		} else {
+			problems = append(problems, fmt.Sprintf("%s row has no parent in %s", table, parent))
+		}
+	}
+	return problems, rows.Err()
+}
+
+func nameKeyCheck(ctx context.Context, h *db.Handle) ([]string, error) {
+	rows, err := h.QueryContext(ctx, "SELECT uid, name, name_key FROM accounts ORDER BY uid")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var (
+			uid     int64
+			name    string
+			nameKey *string
+		)
+		if err := rows.Scan(&uid, &name, &nameKey); err != nil {
+			return nil, err
+		}
+		want := accounts.NameKey(name)
+		switch {
+		case nameKey == nil:
+			problems = append(problems, fmt.Sprintf("account %d has no name_key, expected %q", uid, want))
+		case *nameKey != want:
+			problems = append(problems, fmt.Sprintf("account %d has name_key %q, expected %q", uid, *nameKey, want))
+		}
+	}
+	return problems, rows.Err()
+}
+
+// headroomCheck reports tables whose SERIAL column is within headroom of the
+// int32 limit enforced by the overflow triggers. Every table with a sequence
+// is checked, so new SERIAL columns are covered without changing ibcheck.
+func headroomCheck(ctx context.Context, h *db.Handle, headroom int64) ([]string, error) {
+	rows, err := h.QueryContext(ctx, `
+		SELECT name, seq
+		FROM sqlite_sequence
+		ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var (
+			table string
+			seq   int64
+		)
+		if err := rows.Scan(&table, &seq); err != nil {
+			return nil, err
+		}
+		if left := math.MaxInt32 - seq; left < headroom {
+			problems = append(problems, fmt.Sprintf("%s sequence is at %d, only %d left", table, seq, left))
+		}
+	}
+	return problems, rows.Err()
+}
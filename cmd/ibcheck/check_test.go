@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nosborn/ibgames-1999/db"
+	"github.com/nosborn/ibgames-1999/internal/testutil"
+)
+
+func setupCheckTest(t *testing.T) (*testutil.DatabaseSetup, func() Report) {
+	setup := testutil.SetupTestDatabaseWithSchema(t)
+	setup.CreateTestAccount(t, 666500, "Healthy", "N", 10)
+	setup.CreateTestAccount(t, 666501, "Free", "Y", -5)
+
+	run := func() Report {
+		h, err := db.Open(filepath.Dir(setup.FilePath), true)
+		require.NoError(t, err)
+		defer h.Abandon()
+		return runChecks(context.Background(), h, 1000)
+	}
+	return setup, run
+}
+
+func problems(report Report, name string) []string {
+	for _, r := range report.Checks {
+		if r.Name == name {
+			return r.Problems
+		}
+	}
+	return nil
+}
+
+func TestRunChecks(t *testing.T) {
+	t.Run("healthy database", func(t *testing.T) {
+		setup, run := setupCheckTest(t)
+		_, err := setup.TestDB.Exec(`
+			INSERT INTO sessions (product, uid, ip_address, begin, end, minutes)
+			VALUES (1, 666500, '192.0.2.1', '1999-01-01 10:00', '1999-01-01 11:00', 60)`)
+		require.NoError(t, err)
+
+		report := run()
+		assert.True(t, report.OK)
+		require.Len(t, report.Checks, 7)
+		for _, r := range report.Checks {
+			assert.True(t, r.OK, r.Name)
+			assert.Empty(t, r.Error, r.Name)
+		}
+	})
+
+	t.Run("finds problems", func(t *testing.T) {
+		setup, run := setupCheckTest(t)
+		setup.CreateTestAccount(t, 666502, "Broke", "N", -3)
+		setup.CreateTestAccount(t, 666503, "Gone", "N", 0)
+		_, err := setup.TestDB.Exec(`
+			UPDATE accounts SET name_key = 'wrong' WHERE uid = 666500;
+			UPDATE accounts SET status = 'X' WHERE uid = 666503;
+			UPDATE accounts SET buddy_uid = 666503 WHERE uid = 666502;
+			INSERT INTO sessions (product, uid, ip_address, begin, end, minutes)
+			VALUES (1, 666500, '192.0.2.1', '1999-01-01 10:00', '1999-01-01 09:00', 0);
+			INSERT INTO sessions (product, uid, ip_address, minutes)
+			VALUES (1, 999999, '192.0.2.1', 0);
+			UPDATE sqlite_sequence SET seq = 2147483000 WHERE name = 'sessions';
+			INSERT INTO sqlite_sequence (name, seq) VALUES ('netbanx', 2147483640)`)
+		require.NoError(t, err)
+
+		report := run()
+		assert.False(t, report.OK)
+		assert.Equal(t, []string{`account 666500 has name_key "wrong", expected "healthy"`}, problems(report, "name_key"))
+		assert.Equal(t, []string{"account 666502 has -3 minutes"}, problems(report, "negative_minutes"))
+		assert.Equal(t, []string{"account 666502 has cancelled buddy 666503"}, problems(report, "cancelled_buddy"))
+		assert.Len(t, problems(report, "session_times"), 1)
+		assert.Equal(t, []string{"sessions row 2 has no parent in accounts"}, problems(report, "foreign_key_check"))
+		assert.Equal(t, []string{
+			"netbanx sequence is at 2147483640, only 7 left",
+			"sessions sequence is at 2147483000, only 647 left",
+		}, problems(report, "serial_headroom"))
+		assert.Empty(t, problems(report, "integrity_check"))
+	})
+}
+
+func TestConnectFailed(t *testing.T) {
+	_, err := db.Open(t.TempDir(), true) // Read-only handles don't create the file.
+	require.Error(t, err)
+
+	report := connectFailed(err)
+	assert.False(t, report.OK)
+	require.Len(t, report.Checks, 1)
+	assert.Equal(t, "connect", report.Checks[0].Name)
+	assert.False(t, report.Checks[0].OK)
+	assert.Equal(t, err.Error(), report.Checks[0].Error)
+}
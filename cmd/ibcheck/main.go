@@ -0,0 +1,55 @@
+// Command ibcheck checks that the accounts database is healthy.
+//
+// Usage:
+//
+//	ibcheck [-headroom N]
+//
+// The database is found through DBPATH and opened read-only, so ibcheck can be
+// run while the game servers are up. It runs SQLite's integrity and foreign key
+// checks and then checks the data for things the schema can't enforce. A JSON
+// report is written to standard output, and the exit status is 1 if any check
+// failed. A database that can't be opened is reported as a failed "connect"
+// check.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/nosborn/ibgames-1999/config"
+	"github.com/nosborn/ibgames-1999/db"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("ibcheck: ")
+
+	headroom := flag.Int64("headroom", 1000000, "fail if fewer than `N` values are left in any SERIAL column")
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var report Report
+	if err := db.Connect(true); err != nil {
+		report = connectFailed(err)
+	} else {
+		report = runChecks(context.Background(), db.Default(), *headroom)
+		_ = db.Exit()
+	}
+	report.Database = filepath.Join(config.Get().DBPath, "ibgames.sqlite")
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Fatal(err)
+	}
+	if !report.OK {
+		os.Exit(1)
+	}
+}
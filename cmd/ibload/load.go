@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/nosborn/ibgames-1999/db"
+	"github.com/nosborn/ibgames-1999/unload"
+)
+
+// Rejection records a row that couldn't be loaded.
+type Rejection struct {
+	Line   int
+	Reason string
+}
+
+// load inserts every record from r into table in h's auto-transaction and
+// returns the number of rows loaded and the rows rejected. Nothing is
+// committed.
+//
+// Each row is inserted in a savepoint, so a row that breaks a STRICT type or
+// CHECK constraint is rejected on its own. Foreign keys are checked once all
+// the rows are in, because accounts can refer to accounts later in the file;
+// rows whose parents are still missing are then taken back out.
+func load(ctx context.Context, h *db.Handle, table string, r *unload.Reader) (int, []Rejection, error) {
+	columns, ok := unload.Tables[table]
+	if !ok {
+		return 0, nil, fmt.Errorf("unknown table %q", table)
+	}
+	names := make([]string, len(columns))
+	marks := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.Name
+		marks[i] = "?"
+	}
+	// Every table has a SERIAL key, which is its rowid.
+	var key int
+	for i, c := range columns {
+		if c.Type == unload.Serial {
+			key = i
+		}
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		table, strings.Join(names, ", "), strings.Join(marks, ", "))
+
+	if _, err := h.ExecContext(ctx, "PRAGMA defer_foreign_keys = ON"); err != nil {
+		return 0, nil, err
+	}
+
+	var rejects []Rejection
+	lines := map[int64]int{} // Line each loaded row came from, by rowid
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		line := r.Line()
+
+		if len(record) != len(columns) {
+			rejects = append(rejects, Rejection{line, fmt.Sprintf("expected %d fields, found %d", len(columns), len(record))})
+			continue
+		}
+		values := make([]any, len(columns))
+		for i, c := range columns {
+			if values[i], err = c.Value(record[i]); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			rejects = append(rejects, Rejection{line, err.Error()})
+			continue
+		}
+
+		err = h.WithSavepointContext(ctx, "ibload_row", func() error {
+			_, err := h.ExecContext(ctx, insert, values...)
+			return err
+		})
+		if err != nil {
+			rejects = append(rejects, Rejection{line, err.Error()})
+			continue
+		}
+		if rowid, ok := values[key].(int64); ok {
+			lines[rowid] = line
+		}
+	}
+
+	// Removing a row can orphan others, so keep going until nothing changes.
+	for {
+		orphans, err := orphans(ctx, h, table)
+		if err != nil {
+			return 0, nil, err
+		}
+		removed := false
+		for _, o := range orphans {
+			line, ok := lines[o.rowid]
+			if !ok {
+				continue // Not ours
+			}
+			if _, err := h.ExecContext(ctx, "DELETE FROM "+table+" WHERE rowid = ?", o.rowid); err != nil {
+				return 0, nil, err
+			}
+			delete(lines, o.rowid)
+			rejects = append(rejects, Rejection{line, "no matching row in " + o.parent})
+			removed = true
+		}
+		if !removed {
+			break
+		}
+	}
+
+	sort.Slice(rejects, func(i, j int) bool {
+		return rejects[i].Line < rejects[j].Line
+	})
+	return len(lines), rejects, nil
+}
+
+type orphan struct {
+	rowid  int64
+	parent string
+}
+
+func orphans(ctx context.Context, h *db.Handle, table string) ([]orphan, error) {
+	rows, err := h.QueryContext(ctx, "PRAGMA foreign_key_check("+table+")")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orphans []orphan
+	for rows.Next() {
+		var (
+			o     orphan
+			child string
+			fkid  int
+		)
+		if err := rows.Scan(&child, &o.rowid, &o.parent, &fkid); err != nil {
+			return nil, err
+		}
+		orphans = append(orphans, o)
+	}
+	return orphans, rows.Err()
+}
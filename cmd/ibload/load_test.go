@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nosborn/ibgames-1999/db"
+	"github.com/nosborn/ibgames-1999/internal/testutil"
+	"github.com/nosborn/ibgames-1999/unload"
+)
+
+func setupLoadTest(t *testing.T) (*testutil.DatabaseSetup, *db.Handle) {
+	setup := testutil.SetupTestDatabaseWithSchema(t)
+	h, err := db.Open(filepath.Dir(setup.FilePath), false)
+	require.NoError(t, err)
+	t.Cleanup(h.Abandon)
+	return setup, h
+}
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("accounts", func(t *testing.T) {
+		setup, h := setupLoadTest(t)
+		data := strings.Join([]string{
+			// Refers to a buddy further down the file.
+			`Fred|fred|100001|hash|1999-01-02 03:04|  1 00:00|1999-03-15 14:30||192.0.2.1|0||fred@example.com|fred@example.com|12/25/1998|A|N|42|||Y|N|100002|N|`,
+			`Jim|jim|100002|hash||||||0||\ |\ |12/26/1998|A|Y|0|||N|N||N|`,
+			`Bad|bad|100003|hash||||||0||||12/26/1998|Q|N|0|||Y|N||N|`,
+			`Short|short|100004|`,
+			`Orphan|orphan|100005|hash||||||0||||01/01/1999|A|N|0|||Y|N|999999|N|`,
+			`Typo|typo|100006|hash||||||0||||31/01/1999|A|N|0|||Y|N||N|`,
+		}, "\n") + "\n"
+
+		loaded, rejects, err := load(ctx, h, "accounts", unload.NewReader(strings.NewReader(data)))
+		require.NoError(t, err)
+		assert.Equal(t, 2, loaded)
+		require.Len(t, rejects, 4)
+		assert.Equal(t, 3, rejects[0].Line)
+		assert.Contains(t, rejects[0].Reason, "CHECK constraint")
+		assert.Equal(t, Rejection{4, "expected 23 fields, found 3"}, rejects[1])
+		assert.Equal(t, Rejection{5, "no matching row in accounts"}, rejects[2])
+		assert.Equal(t, 6, rejects[3].Line)
+		assert.Contains(t, rejects[3].Reason, "signup")
+		require.NoError(t, h.Commit())
+
+		var (
+			slogin, signup, email string
+			acctExpire, minutes   int
+		)
+		err = setup.TestDB.QueryRow(
+			"SELECT slogin, signup, acct_expire, minutes FROM accounts WHERE uid = 100001").
+			Scan(&slogin, &signup, &acctExpire, &minutes)
+		require.NoError(t, err)
+		assert.Equal(t, "1999-03-15 14:30:00", slogin)
+		assert.Equal(t, "1998-12-25", signup)
+		assert.Equal(t, 24*60, acctExpire)
+		assert.Equal(t, 42, minutes)
+
+		err = setup.TestDB.QueryRow("SELECT email FROM accounts WHERE uid = 100002").Scan(&email)
+		require.NoError(t, err)
+		assert.Equal(t, "", email)
+
+		// The SERIAL sequence carries on after the loaded keys.
+		var seq int
+		err = setup.TestDB.QueryRow("SELECT seq FROM sqlite_sequence WHERE name = 'accounts'").Scan(&seq)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, seq, 100002)
+	})
+
+	t.Run("sessions", func(t *testing.T) {
+		setup, h := setupLoadTest(t)
+		setup.CreateTestAccount(t, 100001, "Fred", "N", 0)
+		data := "7|1|100001|192.0.2.1|1999-03-15 14:30|1999-03-15 15:00|30|\n" +
+			"8|1|100001|192.0.2.1|1999-03-15 14:30|1999-03-15 15:00|thirty|\n" +
+			"9|1|100009|192.0.2.1|1999-03-15 14:30|1999-03-15 15:00|30|\n" +
+			"7|1|100001|192.0.2.1|1999-03-15 14:30|1999-03-15 15:00|30|\n"
+
+		loaded, rejects, err := load(ctx, h, "sessions", unload.NewReader(strings.NewReader(data)))
+		require.NoError(t, err)
+		assert.Equal(t, 1, loaded)
+		require.Len(t, rejects, 3)
+		assert.Equal(t, 2, rejects[0].Line)
+		assert.Contains(t, rejects[0].Reason, "minutes")
+		assert.Equal(t, Rejection{3, "no matching row in accounts"}, rejects[1])
+		assert.Equal(t, 4, rejects[2].Line)
+		assert.Contains(t, rejects[2].Reason, "UNIQUE")
+		require.NoError(t, h.Commit())
+	})
+
+	t.Run("unknown table", func(t *testing.T) {
+		_, h := setupLoadTest(t)
+		_, _, err := load(ctx, h, "credits", unload.NewReader(strings.NewReader("")))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,72 @@
+// Command ibload loads Informix UNLOAD files into the accounts database.
+//
+// Usage:
+//
+//	ibload [-n] [-d DELIM] TABLE FILE
+//
+// TABLE is accounts or sessions, and FILE holds the table's columns in the
+// order Informix unloaded them. SERIAL keys are kept. Rows that can't be
+// loaded are listed on standard output as FILE:LINE: reason, and the rest are
+// committed together. With -n nothing is committed. The exit status is 1 if
+// any row was rejected.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/nosborn/ibgames-1999/db"
+	"github.com/nosborn/ibgames-1999/unload"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("ibload: ")
+
+	dryRun := flag.Bool("n", false, "check the file without loading it")
+	delim := flag.String("d", string(unload.DefaultDelimiter), "field `delimiter`")
+	flag.Parse()
+	if flag.NArg() != 2 || len(*delim) != 1 {
+		fmt.Fprintf(os.Stderr, "usage: ibload [-n] [-d DELIM] TABLE FILE\n")
+		os.Exit(2)
+	}
+	table, file := flag.Arg(0), flag.Arg(1)
+
+	f, err := os.Open(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	r := unload.NewReader(f)
+	r.Delimiter = (*delim)[0]
+
+	if err := db.Connect(false); err != nil {
+		log.Fatal(err)
+	}
+	ctx := context.Background()
+
+	loaded, rejects, err := load(ctx, db.Default(), table, r)
+	f.Close()
+	if err != nil {
+		_ = db.Exit()
+		log.Fatalf("%s:%d: %v", file, r.Line(), err)
+	}
+	for _, rej := range rejects {
+		fmt.Printf("%s:%d: %s\n", file, rej.Line, rej.Reason)
+	}
+
+	if *dryRun {
+		_ = db.Exit() // Rolls back
+		log.Printf("%d rows would be loaded, %d rejected", loaded, len(rejects))
+	} else {
+		if err := db.Disconnect(); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("%d rows loaded, %d rejected", loaded, len(rejects))
+	}
+	if len(rejects) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,94 @@
+// Command ibmaint keeps the accounts database in good order while the game
+// servers are running.
+//
+// Usage:
+//
+//	ibmaint [-once] [-every D] [-truncate N] [-warn N] [-analyze D] [-vacuum D] [-pages N]
+//	ibmaint -enable-vacuum
+//
+// Every pass does a passive WAL checkpoint, or a truncating one once the -wal
+// file reaches -truncate bytes, and runs ANALYZE and an incremental vacuum
+// when they are due. Only one ibmaint on the host does any work at a time, so
+// it is safe to start one from every game server. With -once a single pass is
+// made. -enable-vacuum switches the database to incremental auto-vacuum,
+// which needs everything else to be stopped.
+//
+// The database is found through DBPATH.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/nosborn/ibgames-1999/config"
+	"github.com/nosborn/ibgames-1999/db"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("ibmaint: ")
+
+	once := flag.Bool("once", false, "make a single pass and exit")
+	every := flag.Duration("every", 5*time.Minute, "time between passes")
+	truncate := flag.Int64("truncate", 64<<20, "truncate the WAL once it reaches `bytes`")
+	warn := flag.Int64("warn", 256<<20, "warn if the WAL is still this many `bytes`")
+	analyze := flag.Duration("analyze", 24*time.Hour, "time between ANALYZEs, 0 for never")
+	vacuum := flag.Duration("vacuum", 24*time.Hour, "time between incremental vacuums, 0 for never")
+	pages := flag.Int("pages", 0, "`pages` freed by each vacuum, 0 for all")
+	enableVacuum := flag.Bool("enable-vacuum", false, "switch the database to incremental auto-vacuum")
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := config.Init(); err != nil {
+		log.Fatal(err)
+	}
+	dbPath := config.Get().DBPath
+	s := db.Schedule{
+		Interval:          *every,
+		CheckpointPassive: true,
+		TruncateWALSize:   *truncate,
+		WarnWALSize:       *warn,
+		AnalyzeInterval:   *analyze,
+		VacuumInterval:    *vacuum,
+		VacuumPages:       *pages,
+	}
+	if err := run(dbPath, s, *once, *enableVacuum); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(dbPath string, s db.Schedule, once, enableVacuum bool) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	m, err := db.OpenMaintenance(ctx, dbPath)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if enableVacuum {
+		return m.EnableIncrementalVacuum(ctx)
+	}
+	if once {
+		report, err := m.Pass(ctx, s)
+		if err != nil {
+			return err
+		}
+		log.Printf("WAL is %d bytes", report.WALSize)
+		return nil
+	}
+	if err := m.Run(ctx, s); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+// Command ibmigrate brings the accounts database schema up to date.
+//
+// Usage:
+//
+//	ibmigrate [-n]
+//
+// The database is found through DBPATH, as for every other program. With -n
+// the SQL for any pending migrations is printed but not run.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/nosborn/ibgames-1999/db"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("ibmigrate: ")
+
+	dryRun := flag.Bool("n", false, "print pending migrations without applying them")
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+
+	if err := db.Connect(false); err != nil {
+		log.Fatal(err)
+	}
+
+	if *dryRun {
+		err := db.MigrateDryRun(ctx, os.Stdout)
+		_ = db.Exit()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	applied, err := db.Migrate(ctx)
+	if err != nil {
+		_ = db.Exit()
+		log.Fatal(err)
+	}
+	version, err := db.SchemaVersion(ctx)
+	if err != nil {
+		_ = db.Exit()
+		log.Fatal(err)
+	}
+	if err := db.Disconnect(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Applied %d migrations, schema is at version %d\n", applied, version)
+}
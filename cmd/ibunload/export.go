@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nosborn/ibgames-1999/db"
+	"github.com/nosborn/ibgames-1999/unload"
+)
+
+// options select what export writes.
+type options struct {
+	table    string
+	columns  []string  // All columns if empty
+	statuses []string  // accounts.status values, all if empty
+	product  int       // sessions.product, all if negative
+	from     time.Time // Earliest signup or session start, if set
+	to       time.Time // Signups or session starts before this, if set
+}
+
+// recordWriter is satisfied by *unload.Writer and csvWriter.
+type recordWriter interface {
+	Write(record []sql.NullString) error
+}
+
+// csvWriter writes records as RFC 4180 CSV. NULLs and empty strings are both
+// written as empty fields.
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (cw csvWriter) Write(record []sql.NullString) error {
+	fields := make([]string, len(record))
+	for i, f := range record {
+		fields[i] = f.String
+	}
+	return cw.w.Write(fields)
+}
+
+// selectColumns returns the columns of table named in names, in that order,
+// or all of them if names is empty.
+func selectColumns(table string, names []string) ([]unload.Column, error) {
+	all, ok := unload.Tables[table]
+	if !ok {
+		return nil, fmt.Errorf("unknown table %q", table)
+	}
+	if len(names) == 0 {
+		return all, nil
+	}
+	columns := make([]unload.Column, 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, c := range all {
+			if c.Name == name {
+				columns = append(columns, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s has no column %q", table, name)
+		}
+	}
+	return columns, nil
+}
+
+// query builds the SELECT for opts.
+func query(opts options, columns []unload.Column) (string, []any, error) {
+	var (
+		where []string
+		args  []any
+	)
+	var key, dateColumn string
+	switch opts.table {
+	case "accounts":
+		key, dateColumn = "uid", "signup"
+		if len(opts.statuses) > 0 {
+			marks := make([]string, len(opts.statuses))
+			for i, s := range opts.statuses {
+				marks[i] = "?"
+				args = append(args, s)
+			}
+			where = append(where, "status IN ("+strings.Join(marks, ", ")+")")
+		}
+		if opts.product >= 0 {
+			return "", nil, fmt.Errorf("accounts can't be filtered by product")
+		}
+	case "sessions":
+		key, dateColumn = "sid", "begin"
+		if opts.product >= 0 {
+			where = append(where, "product = ?")
+			args = append(args, opts.product)
+		}
+		if len(opts.statuses) > 0 {
+			return "", nil, fmt.Errorf("sessions can't be filtered by status")
+		}
+	default:
+		return "", nil, fmt.Errorf("unknown table %q", opts.table)
+	}
+	if !opts.from.IsZero() {
+		where = append(where, dateColumn+" >= ?")
+		args = append(args, opts.from.Format(time.DateOnly))
+	}
+	if !opts.to.IsZero() {
+		where = append(where, dateColumn+" < ?")
+		args = append(args, opts.to.Format(time.DateOnly))
+	}
+
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = `"` + c.Name + `"` // end is a keyword
+	}
+	q := "SELECT " + strings.Join(names, ", ") + " FROM " + opts.table
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	q += " ORDER BY " + key
+	return q, args, nil
+}
+
+// export writes the rows selected by opts to w one at a time and returns how
+// many were written.
+func export(ctx context.Context, h *db.Handle, opts options, w recordWriter) (int, error) {
+	columns, err := selectColumns(opts.table, opts.columns)
+	if err != nil {
+		return 0, err
+	}
+	q, args, err := query(opts, columns)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := h.QueryContext(ctx, q, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	values := make([]any, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	record := make([]sql.NullString, len(columns))
+
+	n := 0
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return n, err
+		}
+		for i, c := range columns {
+			if record[i], err = c.Field(values[i]); err != nil {
+				return n, fmt.Errorf("row %d: %w", n+1, err)
+			}
+		}
+		if err := w.Write(record); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nosborn/ibgames-1999/db"
+	"github.com/nosborn/ibgames-1999/internal/testutil"
+	"github.com/nosborn/ibgames-1999/unload"
+)
+
+func setupExportTest(t *testing.T) *db.Handle {
+	setup := testutil.SetupTestDatabaseWithSchema(t)
+	setup.CreateTestAccount(t, 666600, "Alice", "N", 10)
+	setup.CreateTestAccount(t, 666601, "Bob", "Y", 0)
+	setup.CreateTestAccount(t, 666602, "Carol", "N", 5)
+	_, err := setup.TestDB.Exec(`
+		UPDATE accounts SET signup = '1998-12-25', acct_expire = 90, slogin = '1999-03-15 14:30:00';
+		UPDATE accounts SET status = 'S', signup = '1999-02-01' WHERE uid = 666601;
+		UPDATE accounts SET status = 'X', email = 'carol|x@example.com' WHERE uid = 666602;
+		INSERT INTO sessions (sid, product, uid, ip_address, begin, end, minutes) VALUES
+			(1, 1, 666600, '192.0.2.1', '1999-01-01 10:00:00', '1999-01-01 11:00:00', 60),
+			(2, 2, 666600, '192.0.2.1', '1999-01-02 10:00:00', '1999-01-02 10:30:00', 30),
+			(3, 1, 666601, '192.0.2.2', '1999-02-01 10:00:00', '1999-02-01 10:05:00', 5)`)
+	require.NoError(t, err)
+
+	h, err := db.Open(filepath.Dir(setup.FilePath), true)
+	require.NoError(t, err)
+	t.Cleanup(h.Abandon)
+	return h
+}
+
+func TestExport(t *testing.T) {
+	h := setupExportTest(t)
+	ctx := context.Background()
+
+	unloadRows := func(t *testing.T, opts options) string {
+		var buf strings.Builder
+		w := unload.NewWriter(&buf)
+		_, err := export(ctx, h, opts, w)
+		require.NoError(t, err)
+		require.NoError(t, w.Flush())
+		return buf.String()
+	}
+
+	t.Run("whole accounts table", func(t *testing.T) {
+		out := unloadRows(t, options{table: "accounts", product: -1})
+		lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+		require.Len(t, lines, 3)
+		assert.Equal(t,
+			"Alice|alice|666600|dummy_hash||  0 01:30|1999-03-15 14:30|||0||||12/25/1998|A|N|10|||Y|N||N|",
+			lines[0])
+		assert.Contains(t, lines[2], `carol\|x@example.com`)
+	})
+
+	t.Run("columns and filters", func(t *testing.T) {
+		out := unloadRows(t, options{
+			table:    "accounts",
+			columns:  []string{"uid", "status", "signup"},
+			statuses: []string{"A", "S"},
+			product:  -1,
+			from:     time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC),
+		})
+		assert.Equal(t, "666601|S|02/01/1999|\n", out)
+
+		out = unloadRows(t, options{
+			table:   "sessions",
+			columns: []string{"sid", "begin", "end"},
+			product: 1,
+			to:      time.Date(1999, 2, 1, 0, 0, 0, 0, time.UTC),
+		})
+		assert.Equal(t, "1|1999-01-01 10:00|1999-01-01 11:00|\n", out)
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		var buf strings.Builder
+		cw := csv.NewWriter(&buf)
+		n, err := export(ctx, h, options{table: "accounts", columns: []string{"name", "email"}, product: -1}, csvWriter{cw})
+		require.NoError(t, err)
+		cw.Flush()
+		assert.Equal(t, 3, n)
+		assert.Equal(t, "Alice,\nBob,\nCarol,carol|x@example.com\n", buf.String())
+	})
+
+	t.Run("bad options", func(t *testing.T) {
+		for _, opts := range []options{
+			{table: "credits", product: -1},
+			{table: "accounts", columns: []string{"nonesuch"}, product: -1},
+			{table: "accounts", product: 1},
+			{table: "sessions", statuses: []string{"A"}, product: -1},
+		} {
+			_, err := export(ctx, h, opts, unload.NewWriter(&strings.Builder{}))
+			assert.Error(t, err, opts)
+		}
+	})
+}
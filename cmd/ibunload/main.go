@@ -0,0 +1,133 @@
+// Command ibunload exports accounts and sessions from the accounts database.
+//
+// Usage:
+//
+//	ibunload [-csv] [-d DELIM] [-c COLUMNS] [-status LIST] [-product N]
+//	         [-from DATE] [-to DATE] TABLE [FILE]
+//
+// TABLE is accounts or sessions. Rows are written in Informix UNLOAD format,
+// or as CSV with a header line if -csv is given, to FILE or standard output.
+// Dates, times and intervals are written as Informix would have written them.
+//
+// -c takes a comma-separated list of the columns to write, in order. -status
+// takes a comma-separated list of account statuses (A, S or X) and -product a
+// session product number. -from and -to, as YYYY-MM-DD, limit account signups
+// or session starts to dates on or after -from and before -to.
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nosborn/ibgames-1999/db"
+	"github.com/nosborn/ibgames-1999/unload"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: ibunload [-csv] [-d DELIM] [-c COLUMNS] [-status LIST] [-product N]\n")
+	fmt.Fprintf(os.Stderr, "                [-from DATE] [-to DATE] TABLE [FILE]\n")
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("ibunload: ")
+
+	asCSV := flag.Bool("csv", false, "write CSV rather than UNLOAD format")
+	delim := flag.String("d", string(unload.DefaultDelimiter), "UNLOAD field `delimiter`")
+	columns := flag.String("c", "", "comma-separated `columns` to write")
+	statuses := flag.String("status", "", "comma-separated account `statuses` to write")
+	product := flag.Int("product", -1, "session `product` to write")
+	from := flag.String("from", "", "earliest `date` to write")
+	to := flag.String("to", "", "write dates before this `date`")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 || flag.NArg() > 2 || len(*delim) != 1 {
+		usage()
+	}
+
+	opts := options{table: flag.Arg(0), product: *product}
+	if *columns != "" {
+		opts.columns = strings.Split(*columns, ",")
+	}
+	if *statuses != "" {
+		opts.statuses = strings.Split(*statuses, ",")
+	}
+	var err error
+	if *from != "" {
+		if opts.from, err = time.Parse(time.DateOnly, *from); err != nil {
+			log.Fatalf("-from: %v", err)
+		}
+	}
+	if *to != "" {
+		if opts.to, err = time.Parse(time.DateOnly, *to); err != nil {
+			log.Fatalf("-to: %v", err)
+		}
+	}
+
+	var (
+		out  io.Writer = os.Stdout
+		file *os.File
+	)
+	if flag.NArg() == 2 {
+		if file, err = os.Create(flag.Arg(1)); err != nil {
+			log.Fatal(err)
+		}
+		out = file
+	}
+
+	if err := db.Connect(true); err != nil {
+		log.Fatal(err)
+	}
+	ctx := context.Background()
+
+	var n int
+	if *asCSV {
+		cols, err := selectColumns(opts.table, opts.columns)
+		if err != nil {
+			_ = db.Exit()
+			log.Fatal(err)
+		}
+		cw := csv.NewWriter(out)
+		header := make([]string, len(cols))
+		for i, c := range cols {
+			header[i] = c.Name
+		}
+		_ = cw.Write(header)
+		n, err = export(ctx, db.Default(), opts, csvWriter{cw})
+		cw.Flush()
+		if err == nil {
+			err = cw.Error()
+		}
+		if err != nil {
+			_ = db.Exit()
+			log.Fatal(err)
+		}
+	} else {
+		uw := unload.NewWriter(out)
+		uw.Delimiter = (*delim)[0]
+		n, err = export(ctx, db.Default(), opts, uw)
+		if err == nil {
+			err = uw.Flush()
+		}
+		if err != nil {
+			_ = db.Exit()
+			log.Fatal(err)
+		}
+	}
+	_ = db.Exit()
+
+	if file != nil {
+		if err := file.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("%d rows unloaded", n)
+}
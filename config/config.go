@@ -0,0 +1,257 @@
+// Package config holds the settings shared by the ibgames programs.
+//
+// Settings come from built-in defaults, then from the file named by
+// IBGAMES_CONFIG if it is set, then from environment variables. The file has
+// one "key = value" setting per line; blank lines and lines starting with #
+// are ignored. Durations are written as for time.ParseDuration, such as
+// "30m".
+//
+//	Key                      Environment                       Default
+//	dbpath                   DBPATH                            per OS
+//	cookie_lifetime          IBGAMES_COOKIE_LIFETIME           30m
+//	bcrypt_cost              IBGAMES_BCRYPT_COST               10
+//	lock_dir                 IBGAMES_LOCK_DIR                  $HOME/lock
+//	billing_write_interval   IBGAMES_BILLING_WRITE_INTERVAL    1m
+//	billing_minimum_charge   IBGAMES_BILLING_MINIMUM_CHARGE    1
+//	billing_free_period      IBGAMES_BILLING_FREE_PERIOD       false
+//	billing_base_currency    IBGAMES_BILLING_BASE_CURRENCY     USD
+//	netbanx_url              IBGAMES_NETBANX_URL               none
+//	netbanx_account          IBGAMES_NETBANX_ACCOUNT           none
+//	netbanx_api_key          IBGAMES_NETBANX_API_KEY           none
+//	netbanx_callback_secret  IBGAMES_NETBANX_CALLBACK_SECRET   none
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Config is a complete set of settings.
+type Config struct {
+	DBPath         string        // Directory holding ibgames.sqlite
+	CookieLifetime time.Duration // Idle time before a web cookie expires
+	BcryptCost     int           // Cost of new password hashes
+	LockDir        string        // Rules lock files; empty means $HOME/lock
+
+	BillingWriteInterval time.Duration // Longest time between session writes
+	BillingMinimumCharge int           // Minutes charged when a session begins
+	BillingFreePeriod    bool          // Don't charge anyone
+	BillingBaseCurrency  string        // Currency the accounts are kept in
+
+	NetbanxURL            string // Card payment gateway
+	NetbanxAccount        string // Merchant account number
+	NetbanxAPIKey         string // user:password for the gateway
+	NetbanxCallbackSecret string // Key that callbacks are signed with
+}
+
+// Default returns the built-in settings.
+func Default() *Config {
+	return &Config{
+		DBPath:               defaultDBPath,
+		CookieLifetime:       30 * time.Minute,
+		BcryptCost:           bcrypt.DefaultCost,
+		BillingWriteInterval: time.Minute,
+		BillingMinimumCharge: 1,
+		BillingBaseCurrency:  "USD",
+	}
+}
+
+// setting ties a key and environment variable to a field of Config.
+type setting struct {
+	key string
+	env string
+	set func(c *Config, value string) error
+}
+
+var settings = []setting{
+	{"dbpath", "DBPATH", func(c *Config, v string) error {
+		c.DBPath = v
+		return nil
+	}},
+	{"cookie_lifetime", "IBGAMES_COOKIE_LIFETIME", func(c *Config, v string) error {
+		return parseDuration(v, &c.CookieLifetime)
+	}},
+	{"bcrypt_cost", "IBGAMES_BCRYPT_COST", func(c *Config, v string) error {
+		if err := parseInt(v, &c.BcryptCost); err != nil {
+			return err
+		}
+		if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return nil
+	}},
+	{"lock_dir", "IBGAMES_LOCK_DIR", func(c *Config, v string) error {
+		c.LockDir = v
+		return nil
+	}},
+	{"billing_write_interval", "IBGAMES_BILLING_WRITE_INTERVAL", func(c *Config, v string) error {
+		return parseDuration(v, &c.BillingWriteInterval)
+	}},
+	{"billing_minimum_charge", "IBGAMES_BILLING_MINIMUM_CHARGE", func(c *Config, v string) error {
+		if err := parseInt(v, &c.BillingMinimumCharge); err != nil {
+			return err
+		}
+		if c.BillingMinimumCharge < 0 {
+			return fmt.Errorf("must not be negative")
+		}
+		return nil
+	}},
+	{"billing_free_period", "IBGAMES_BILLING_FREE_PERIOD", func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("bad boolean %q", v)
+		}
+		c.BillingFreePeriod = b
+		return nil
+	}},
+	{"billing_base_currency", "IBGAMES_BILLING_BASE_CURRENCY", func(c *Config, v string) error {
+		if len(v) != 3 || strings.Trim(v, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+			return fmt.Errorf("bad currency code %q", v)
+		}
+		c.BillingBaseCurrency = v
+		return nil
+	}},
+	{"netbanx_url", "IBGAMES_NETBANX_URL", func(c *Config, v string) error {
+		c.NetbanxURL = v
+		return nil
+	}},
+	{"netbanx_account", "IBGAMES_NETBANX_ACCOUNT", func(c *Config, v string) error {
+		c.NetbanxAccount = v
+		return nil
+	}},
+	{"netbanx_api_key", "IBGAMES_NETBANX_API_KEY", func(c *Config, v string) error {
+		c.NetbanxAPIKey = v
+		return nil
+	}},
+	{"netbanx_callback_secret", "IBGAMES_NETBANX_CALLBACK_SECRET", func(c *Config, v string) error {
+		c.NetbanxCallbackSecret = v
+		return nil
+	}},
+}
+
+func parseDuration(v string, d *time.Duration) error {
+	parsed, err := time.ParseDuration(v)
+	if err != nil || parsed <= 0 {
+		return fmt.Errorf("bad duration %q", v)
+	}
+	*d = parsed
+	return nil
+}
+
+func parseInt(v string, n *int) error {
+	parsed, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("bad number %q", v)
+	}
+	*n = parsed
+	return nil
+}
+
+// Load returns the defaults overridden by the settings in file, unless file
+// is empty, and then by the environment.
+func Load(file string) (*Config, error) {
+	c := Default()
+	if file != "" {
+		if err := c.readFile(file); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok && v != "" {
+			if err := s.set(c, v); err != nil {
+				return nil, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+	return c, nil
+}
+
+func (c *Config) readFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return fmt.Errorf("%s:%d: expected key = value", file, line)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		found := false
+		for _, s := range settings {
+			if s.key == key {
+				if err := s.set(c, value); err != nil {
+					return fmt.Errorf("%s:%d: %s: %w", file, line, key, err)
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s:%d: unknown setting %q", file, line, key)
+		}
+	}
+	return scanner.Err()
+}
+
+var (
+	mu      sync.Mutex
+	current *Config
+	loadErr error // Why current holds the defaults instead
+)
+
+// Init loads the settings for this process, unless they have already been
+// loaded or Set, and returns any problem with them. Programs call it once at
+// startup, usually through db.Connect, so that a bad configuration is
+// reported there and not when a setting is first needed.
+func Init() error {
+	mu.Lock()
+	defer mu.Unlock()
+	load()
+	return loadErr
+}
+
+// Get returns the settings for this process, loading them if Init hasn't. Get
+// never fails: if the settings can't be loaded, the problem is logged and the
+// built-in defaults are used, and Init reports it.
+func Get() *Config {
+	mu.Lock()
+	defer mu.Unlock()
+	load()
+	return current
+}
+
+// load loads the settings if there are none. mu must be held.
+func load() {
+	if current != nil {
+		return
+	}
+	current, loadErr = Load(os.Getenv("IBGAMES_CONFIG"))
+	if loadErr != nil {
+		log.Printf("config: %v; using defaults", loadErr)
+		current = Default()
+	}
+}
+
+// Set replaces the settings returned by Get. A nil c makes the next Get or
+// Init load them again.
+func Set(c *Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	current, loadErr = c, nil
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, text string) string {
+	file := filepath.Join(t.TempDir(), "ibgames.conf")
+	require.NoError(t, os.WriteFile(file, []byte(text), 0o644))
+	return file
+}
+
+// clearEnv stops the environment of the test run leaking into the results.
+func clearEnv(t *testing.T) {
+	for _, s := range settings {
+		t.Setenv(s.env, "")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		clearEnv(t)
+		c, err := Load("")
+		require.NoError(t, err)
+		assert.Equal(t, Default(), c)
+		assert.Equal(t, defaultDBPath, c.DBPath)
+		assert.Equal(t, 30*time.Minute, c.CookieLifetime)
+		assert.Equal(t, 10, c.BcryptCost)
+	})
+
+	t.Run("file", func(t *testing.T) {
+		clearEnv(t)
+		file := writeConfig(t, `
+# Test settings
+dbpath = /var/ibgames
+cookie_lifetime=1h
+bcrypt_cost = 12
+lock_dir = /var/ibgames/lock
+
+billing_write_interval = 30s
+billing_minimum_charge = 2
+billing_free_period = true
+billing_base_currency = GBP
+
+netbanx_url = https://api.test.netbanx.com
+netbanx_account = 1001
+netbanx_api_key = user:secret
+netbanx_callback_secret = shh
+`)
+		c, err := Load(file)
+		require.NoError(t, err)
+		assert.Equal(t, &Config{
+			DBPath:               "/var/ibgames",
+			CookieLifetime:       time.Hour,
+			BcryptCost:           12,
+			LockDir:              "/var/ibgames/lock",
+			BillingWriteInterval: 30 * time.Second,
+			BillingMinimumCharge: 2,
+			BillingFreePeriod:    true,
+			BillingBaseCurrency:  "GBP",
+
+			NetbanxURL:            "https://api.test.netbanx.com",
+			NetbanxAccount:        "1001",
+			NetbanxAPIKey:         "user:secret",
+			NetbanxCallbackSecret: "shh",
+		}, c)
+	})
+
+	t.Run("environment overrides file", func(t *testing.T) {
+		clearEnv(t)
+		file := writeConfig(t, "dbpath = /var/ibgames\nbcrypt_cost = 12\n")
+		t.Setenv("DBPATH", "/tmp/ibgames")
+		t.Setenv("IBGAMES_COOKIE_LIFETIME", "5m")
+
+		c, err := Load(file)
+		require.NoError(t, err)
+		assert.Equal(t, "/tmp/ibgames", c.DBPath)
+		assert.Equal(t, 5*time.Minute, c.CookieLifetime)
+		assert.Equal(t, 12, c.BcryptCost)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		clearEnv(t)
+		for text, msg := range map[string]string{
+			"dbpath":                      ":1: expected key = value",
+			"\ncolour = blue":             ":2: unknown setting",
+			"bcrypt_cost = 99":            "bcrypt_cost: must be between",
+			"cookie_lifetime = forever":   "bad duration",
+			"cookie_lifetime = -1m":       "bad duration",
+			"billing_minimum_charge = -1": "must not be negative",
+			"billing_free_period = maybe": "bad boolean",
+			"billing_write_interval = 10": "bad duration",
+			"bcrypt_cost = ten":           "bad number",
+			"billing_base_currency = usd": "bad currency code",
+		} {
+			_, err := Load(writeConfig(t, text))
+			assert.ErrorContains(t, err, msg, text)
+		}
+
+		_, err := Load(filepath.Join(t.TempDir(), "missing.conf"))
+		assert.Error(t, err)
+
+		t.Setenv("IBGAMES_BCRYPT_COST", "1")
+		_, err = Load("")
+		assert.ErrorContains(t, err, "IBGAMES_BCRYPT_COST")
+	})
+}
+
+func TestGet(t *testing.T) {
+	clearEnv(t)
+	t.Cleanup(func() { Set(nil) })
+
+	t.Setenv("IBGAMES_CONFIG", writeConfig(t, "bcrypt_cost = 11\n"))
+	Set(nil)
+	assert.Equal(t, 11, Get().BcryptCost)
+	assert.Same(t, Get(), Get())
+
+	c := Default()
+	c.BcryptCost = 4
+	Set(c)
+	assert.Equal(t, 4, Get().BcryptCost)
+
+	t.Setenv("IBGAMES_CONFIG", writeConfig(t, "bcrypt_cost = 1\n"))
+	Set(nil)
+	assert.Equal(t, Default(), Get())
+	assert.ErrorContains(t, Init(), "bcrypt_cost")
+}
+
+func TestInit(t *testing.T) {
+	clearEnv(t)
+	t.Cleanup(func() { Set(nil) })
+
+	t.Setenv("IBGAMES_CONFIG", writeConfig(t, "bcrypt_cost = 1\n"))
+	Set(nil)
+	assert.ErrorContains(t, Init(), "bcrypt_cost")
+	assert.ErrorContains(t, Init(), "bcrypt_cost") // Until it is loaded again
+
+	t.Setenv("IBGAMES_CONFIG", writeConfig(t, "bcrypt_cost = 11\n"))
+	Set(nil)
+	require.NoError(t, Init())
+	assert.Equal(t, 11, Get().BcryptCost)
+
+	c := Default()
+	Set(c)
+	require.NoError(t, Init())
+	assert.Same(t, c, Get())
+}
@@ -0,0 +1,5 @@
+//go:build darwin
+
+package config
+
+const defaultDBPath = "data"
@@ -0,0 +1,330 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// ErrIntegrity is returned by Restore when the backup fails PRAGMA
+// integrity_check.
+var ErrIntegrity = errors.New("database failed integrity check")
+
+// ErrDatabaseInUse is returned by Restore when another connection is writing
+// to the live database.
+var ErrDatabaseInUse = errors.New("database is in use")
+
+// snapshotLayout is the timestamp in snapshot file names. It sorts in time
+// order.
+const snapshotLayout = "20060102T150405Z"
+
+// Backup writes a consistent copy of the default database to destPath.
+func Backup(ctx context.Context, destPath string) error {
+	return std.Backup(ctx, destPath)
+}
+
+// Backup writes a consistent copy of the database to destPath, which must not
+// already exist. The copy is made with VACUUM INTO on a separate read-only
+// connection, so it contains only committed work, doesn't disturb the
+// auto-transaction and doesn't stop other processes from writing. The copy
+// appears at destPath only once it is complete.
+func (h *Handle) Backup(ctx context.Context, destPath string) error {
+	if _, err := os.Lstat(destPath); err == nil {
+		return fmt.Errorf("%s already exists", destPath)
+	}
+
+	params := "mode=ro&_pragma=busy_timeout(5000)"
+	if h.mode == "immutable" {
+		params += "&immutable=1"
+	}
+	src, err := sql.Open("sqlite", fmt.Sprintf("file:%s?%s", h.file, params))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpPath := destPath + ".tmp"
+	_ = os.Remove(tmpPath) // left over from an earlier failure
+	if _, err := src.ExecContext(ctx, "VACUUM INTO ?", tmpPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := syncFile(tmpPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, destPath)
+}
+
+// Snapshot backs up the default database into dir.
+func Snapshot(ctx context.Context, dir string, keep int) (string, error) {
+	return std.Snapshot(ctx, dir, keep)
+}
+
+// Snapshot backs up the database into dir under a name containing the current
+// UTC time, such as ibgames-19990315T143000Z.sqlite, and returns the file name.
+// If keep is positive, the oldest snapshots in dir are then removed so that at
+// most keep remain.
+func (h *Handle) Snapshot(ctx context.Context, dir string, keep int) (string, error) {
+	name := filepath.Join(dir, "ibgames-"+time.Now().UTC().Format(snapshotLayout)+".sqlite")
+	if err := h.Backup(ctx, name); err != nil {
+		return "", err
+	}
+	if keep > 0 {
+		if err := pruneSnapshots(dir, keep); err != nil {
+			return name, err
+		}
+	}
+	return name, nil
+}
+
+// Snapshots returns the snapshot files in dir, oldest first.
+func Snapshots(dir string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "ibgames-*.sqlite"))
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []string
+	for _, m := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(m), "ibgames-"), ".sqlite")
+		if _, err := time.Parse(snapshotLayout, stamp); err == nil {
+			snapshots = append(snapshots, m)
+		}
+	}
+	sort.Strings(snapshots)
+	return snapshots, nil
+}
+
+func pruneSnapshots(dir string, keep int) error {
+	snapshots, err := Snapshots(dir)
+	if err != nil {
+		return err
+	}
+	for len(snapshots) > keep {
+		if err := os.Remove(snapshots[0]); err != nil {
+			return err
+		}
+		snapshots = snapshots[1:]
+	}
+	return nil
+}
+
+// Restore replaces the accounts database in directory dbPath with the backup
+// in srcFile. The backup must pass PRAGMA integrity_check and must not have a
+// newer schema than this program understands.
+//
+// The database that is replaced is kept alongside under a name containing the
+// current UTC time, such as ibgames.sqlite.replaced-19990315T143000Z, with its
+// -wal file if it still holds work that couldn't be checkpointed. The write
+// lock is held throughout, so Restore fails with ErrDatabaseInUse if another
+// connection is writing, and there is always a database file. Handles on the
+// old database reconnect at their next transaction boundary, but programs
+// that don't use Handle must be stopped first.
+func Restore(ctx context.Context, srcFile, dbPath string) error {
+	if std != nil && std.file == filepath.Join(dbPath, "ibgames.sqlite") {
+		return fmt.Errorf("database is open; disconnect first")
+	}
+
+	if err := verifyBackup(ctx, srcFile); err != nil {
+		return err
+	}
+
+	dbFile := filepath.Join(dbPath, "ibgames.sqlite")
+	tmpFile := dbFile + ".restore"
+	if err := copyFile(srcFile, tmpFile); err != nil {
+		_ = os.Remove(tmpFile)
+		return err
+	}
+
+	if _, err := os.Stat(dbFile); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			_ = os.Remove(tmpFile)
+			return err
+		}
+		return os.Rename(tmpFile, dbFile)
+	}
+	if err := swapDatabase(ctx, dbFile, tmpFile); err != nil {
+		_ = os.Remove(tmpFile)
+		return err
+	}
+	return nil
+}
+
+// swapDatabase keeps dbFile under a new name and renames newFile over it,
+// holding the write lock throughout.
+//
+// When the last connection to a WAL database closes, SQLite checkpoints and
+// deletes the -wal and -shm files by name. Once newFile is in place those
+// names belong to the new database, so neither connection made here is
+// allowed to delete them.
+func swapDatabase(ctx context.Context, dbFile, newFile string) error {
+	live, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)", dbFile))
+	if err != nil {
+		return err
+	}
+	defer live.Close()
+	lock, err := openPersistentWAL(ctx, live)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	checkpoint, err := openPersistentWAL(ctx, live)
+	if err != nil {
+		return err
+	}
+	defer checkpoint.Close()
+
+	if _, err := lock.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return fmt.Errorf("%s: %w: %w", dbFile, ErrDatabaseInUse, err)
+	}
+	defer func() { _, _ = lock.ExecContext(context.Background(), "ROLLBACK") }()
+
+	// A passive checkpoint doesn't need the write lock. It can't copy work
+	// that readers of older snapshots may still need.
+	var busy, walFrames, checkpointed int
+	err = checkpoint.QueryRowContext(ctx, "PRAGMA wal_checkpoint(PASSIVE)").Scan(&busy, &walFrames, &checkpointed)
+	if err != nil {
+		return err
+	}
+
+	replaced, err := linkUnique(dbFile, dbFile+".replaced-"+time.Now().UTC().Format(snapshotLayout))
+	if err != nil {
+		return err
+	}
+	if walFrames > checkpointed {
+		if err := os.Link(dbFile+"-wal", replaced+"-wal"); err != nil {
+			return err
+		}
+	}
+
+	// The old -wal and -shm files must be gone before the new file appears,
+	// or its first user would apply the old log to it.
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dbFile + suffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(newFile, dbFile)
+}
+
+// openPersistentWAL returns a connection from sqlDB that leaves the -wal and
+// -shm files in place when it closes.
+func openPersistentWAL(ctx context.Context, sqlDB *sql.DB) (*sql.Conn, error) {
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = conn.Raw(func(driverConn any) error {
+		fc, ok := driverConn.(sqlite.FileControl)
+		if !ok {
+			return errors.New("sqlite driver has no file controls")
+		}
+		_, err := fc.FileControlPersistWAL("main", 1)
+		return err
+	})
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// linkUnique makes a hard link to file named name, or name with a number
+// added if name is taken, and returns the name used.
+func linkUnique(file, name string) (string, error) {
+	link := name
+	for i := 1; ; i++ {
+		err := os.Link(file, link)
+		if !errors.Is(err, fs.ErrExist) {
+			return link, err
+		}
+		link = fmt.Sprintf("%s.%d", name, i)
+	}
+}
+
+func verifyBackup(ctx context.Context, srcFile string) error {
+	h, err := OpenSnapshotContext(ctx, srcFile)
+	if err != nil {
+		return err
+	}
+	defer h.Abandon()
+
+	problems, err := h.IntegrityCheck(ctx)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s: %w: %s", srcFile, ErrIntegrity, strings.Join(problems, "; "))
+	}
+
+	if _, err := h.PendingMigrations(ctx); err != nil {
+		return fmt.Errorf("%s: %w", srcFile, err)
+	}
+	return nil
+}
+
+// IntegrityCheck runs PRAGMA integrity_check and returns the problems it
+// reports, if any.
+func (h *Handle) IntegrityCheck(ctx context.Context) ([]string, error) {
+	rows, err := h.QueryContext(ctx, "PRAGMA integrity_check")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			return nil, err
+		}
+		if msg != "ok" {
+			problems = append(problems, msg)
+		}
+	}
+	return problems, rows.Err()
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func syncFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
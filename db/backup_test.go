@@ -0,0 +1,277 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func countTestRows(t *testing.T, h *Handle) int {
+	var n int
+	require.NoError(t, h.QueryRow("SELECT COUNT(*) FROM test").Scan(&n))
+	return n
+}
+
+func TestBackup(t *testing.T) {
+	ctx := context.Background()
+
+	h := openTestHandle(t)
+	_, err := h.Exec("CREATE TABLE test (name TEXT)")
+	require.NoError(t, err)
+	_, err = h.Exec("INSERT INTO test (name) VALUES ('committed')")
+	require.NoError(t, err)
+	require.NoError(t, h.Commit())
+	_, err = h.Exec("INSERT INTO test (name) VALUES ('uncommitted')")
+	require.NoError(t, err)
+
+	t.Run("copies committed work only", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "backup.sqlite")
+		require.NoError(t, h.Backup(ctx, dest))
+
+		backup, err := OpenSnapshot(dest)
+		require.NoError(t, err)
+		defer backup.Abandon()
+		assert.Equal(t, 1, countTestRows(t, backup))
+
+		// The auto-transaction is undisturbed.
+		assert.Equal(t, 2, countTestRows(t, h))
+	})
+
+	t.Run("won't overwrite", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "backup.sqlite")
+		require.NoError(t, os.WriteFile(dest, []byte("precious"), 0o600))
+
+		require.Error(t, h.Backup(ctx, dest))
+
+		data, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		assert.Equal(t, "precious", string(data))
+	})
+
+	t.Run("works from read-only handles", func(t *testing.T) {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "backup.sqlite")
+		require.NoError(t, h.Backup(ctx, src))
+
+		snapshot, err := OpenSnapshot(src)
+		require.NoError(t, err)
+		defer snapshot.Abandon()
+
+		dest := filepath.Join(dir, "copy.sqlite")
+		require.NoError(t, snapshot.Backup(ctx, dest))
+		_, err = os.Stat(dest)
+		require.NoError(t, err)
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	h := openTestHandle(t)
+	_, err := h.Exec("CREATE TABLE test (name TEXT)")
+	require.NoError(t, err)
+	require.NoError(t, h.Commit())
+
+	dir := t.TempDir()
+	old := []string{
+		filepath.Join(dir, "ibgames-19990101T000000Z.sqlite"),
+		filepath.Join(dir, "ibgames-19990201T000000Z.sqlite"),
+		filepath.Join(dir, "ibgames-19990301T000000Z.sqlite"),
+	}
+	for _, name := range old {
+		require.NoError(t, os.WriteFile(name, nil, 0o600))
+	}
+	unrelated := filepath.Join(dir, "ibgames-notes.sqlite")
+	require.NoError(t, os.WriteFile(unrelated, nil, 0o600))
+
+	name, err := h.Snapshot(ctx, dir, 2)
+	require.NoError(t, err)
+	assert.Equal(t, dir, filepath.Dir(name))
+
+	snapshots, err := Snapshots(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{old[2], name}, snapshots)
+
+	_, err = os.Stat(unrelated)
+	assert.NoError(t, err, "unrelated files are left alone")
+}
+
+func TestRestore(t *testing.T) {
+	ctx := context.Background()
+
+	makeBackup := func(t *testing.T, rows int) string {
+		h := openTestHandle(t)
+		_, err := h.Exec("CREATE TABLE test (name TEXT)")
+		require.NoError(t, err)
+		for range rows {
+			_, err = h.Exec("INSERT INTO test (name) VALUES ('row')")
+			require.NoError(t, err)
+		}
+		require.NoError(t, h.Commit())
+		dest := filepath.Join(t.TempDir(), "backup.sqlite")
+		require.NoError(t, h.Backup(ctx, dest))
+		return dest
+	}
+
+	t.Run("replaces live database", func(t *testing.T) {
+		backup := makeBackup(t, 3)
+
+		dbPath := t.TempDir()
+		live, err := Open(dbPath, false)
+		require.NoError(t, err)
+		_, err = live.Exec("CREATE TABLE test (name TEXT)")
+		require.NoError(t, err)
+		require.NoError(t, live.Close())
+
+		require.NoError(t, Restore(ctx, backup, dbPath))
+
+		restored, err := Open(dbPath, true)
+		require.NoError(t, err)
+		defer restored.Abandon()
+		assert.Equal(t, 3, countTestRows(t, restored))
+
+		replaced, err := filepath.Glob(filepath.Join(dbPath, "ibgames.sqlite.replaced-*"))
+		require.NoError(t, err)
+		assert.Len(t, replaced, 1)
+	})
+
+	t.Run("keeps committed work of open connections", func(t *testing.T) {
+		backup := makeBackup(t, 3)
+
+		dbPath := t.TempDir()
+		live, err := Open(dbPath, false)
+		require.NoError(t, err)
+		defer live.Abandon()
+		_, err = live.Exec("CREATE TABLE test (name TEXT)")
+		require.NoError(t, err)
+		_, err = live.Exec("INSERT INTO test (name) VALUES ('only in the WAL')")
+		require.NoError(t, err)
+		require.NoError(t, live.Commit()) // Stays open, so no checkpoint on close.
+
+		// A reader of an older snapshot stops the last row being
+		// checkpointed.
+		reader, err := Open(dbPath, true)
+		require.NoError(t, err)
+		defer reader.Abandon()
+		assert.Equal(t, 1, countTestRows(t, reader))
+		_, err = live.Exec("INSERT INTO test (name) VALUES ('reader can''t see')")
+		require.NoError(t, err)
+		require.NoError(t, live.Commit())
+
+		require.NoError(t, Restore(ctx, backup, dbPath))
+		require.NoError(t, Restore(ctx, backup, dbPath))
+
+		replaced, err := filepath.Glob(filepath.Join(dbPath, "ibgames.sqlite.replaced-*[^lm]"))
+		require.NoError(t, err)
+		require.Len(t, replaced, 2)
+		sort.Strings(replaced)
+		old, err := sql.Open("sqlite", replaced[0])
+		require.NoError(t, err)
+		defer old.Close()
+		var n int
+		require.NoError(t, old.QueryRow("SELECT COUNT(*) FROM test").Scan(&n))
+		assert.Equal(t, 2, n)
+	})
+
+	t.Run("refuses while another connection is writing", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("waits for the busy timeout")
+		}
+		backup := makeBackup(t, 1)
+
+		dbPath := t.TempDir()
+		live, err := Open(dbPath, false)
+		require.NoError(t, err)
+		defer live.Abandon()
+		_, err = live.Exec("CREATE TABLE test (name TEXT)")
+		require.NoError(t, err)
+		require.NoError(t, live.Commit())
+		_, err = live.Exec("INSERT INTO test (name) VALUES ('pending')")
+		require.NoError(t, err)
+
+		require.ErrorIs(t, Restore(ctx, backup, dbPath), ErrDatabaseInUse)
+		require.NoError(t, live.Commit())
+		assert.Equal(t, 1, countTestRows(t, live))
+	})
+
+	t.Run("refuses damaged backup", func(t *testing.T) {
+		backup := makeBackup(t, 100)
+
+		// Scribble over the second page.
+		f, err := os.OpenFile(backup, os.O_WRONLY, 0)
+		require.NoError(t, err)
+		_, err = f.WriteAt(make([]byte, 512), 4096+100)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		dbPath := t.TempDir()
+		require.Error(t, Restore(ctx, backup, dbPath))
+
+		_, err = os.Stat(filepath.Join(dbPath, "ibgames.sqlite"))
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("refuses newer schema", func(t *testing.T) {
+		h := openTestHandle(t)
+		_, err := h.Exec("PRAGMA user_version = 9999")
+		require.NoError(t, err)
+		require.NoError(t, h.Commit())
+		backup := filepath.Join(t.TempDir(), "backup.sqlite")
+		require.NoError(t, h.Backup(ctx, backup))
+
+		require.ErrorIs(t, Restore(ctx, backup, t.TempDir()), ErrSchemaTooNew)
+	})
+
+	t.Run("refuses while connected", func(t *testing.T) {
+		backup := makeBackup(t, 1)
+		setupTestDB(t)
+		require.NoError(t, Connect(false))
+		defer Exit()
+
+		require.Error(t, Restore(ctx, backup, os.Getenv("DBPATH")))
+	})
+}
+
+func TestOpenPersistentWAL(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "test.sqlite")
+	walExists := func() bool {
+		_, err := os.Stat(file + "-wal")
+		return err == nil
+	}
+	write := func(conn *sql.Conn) {
+		_, err := conn.ExecContext(ctx, "INSERT INTO test (name) VALUES ('one')")
+		require.NoError(t, err)
+		require.NoError(t, conn.Close())
+	}
+
+	sqlDB, err := sql.Open("sqlite", "file:"+file+"?_pragma=journal_mode(WAL)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	_, err = sqlDB.Exec("CREATE TABLE test (name TEXT)")
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+
+	// The last connection to close normally deletes the -wal file...
+	sqlDB, err = sql.Open("sqlite", "file:"+file)
+	require.NoError(t, err)
+	conn, err := sqlDB.Conn(ctx)
+	require.NoError(t, err)
+	write(conn)
+	require.NoError(t, sqlDB.Close())
+	assert.False(t, walExists())
+
+	// ...but not when it might no longer be the file's own.
+	sqlDB, err = sql.Open("sqlite", "file:"+file)
+	require.NoError(t, err)
+	conn, err = openPersistentWAL(ctx, sqlDB)
+	require.NoError(t, err)
+	write(conn)
+	require.NoError(t, sqlDB.Close())
+	assert.True(t, walExists())
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nosborn/ibgames-1999"
+)
+
+// CreateSchema creates the tables in the default database.
+func CreateSchema(ctx context.Context) error {
+	return std.CreateSchema(ctx)
+}
+
+// CreateSchema creates the tables in a new database by running the embedded
+// ibgames.sql script, without needing the sqlite3 shell. It does nothing if
+// the database already has tables; use Migrate to bring an existing database
+// up to date.
+//
+// The script manages its own transaction, so any work pending in the
+// auto-transaction is committed first.
+func (h *Handle) CreateSchema(ctx context.Context) error {
+	script, err := sqlScript(ibgames.Schema)
+	if err != nil {
+		return err
+	}
+	tx, err := h.transaction()
+	if err != nil {
+		return err
+	}
+
+	var n int
+	err = h.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE name NOT LIKE 'sqlite_%'").Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	start := time.Now()
+	err = tx.Commit()
+	traceCall("COMMIT", 0, start, nil, err)
+	if err != nil {
+		h.noteError(err)
+		return err
+	}
+	h.tx, h.dirty = nil, false
+
+	start = time.Now()
+	result, err := h.conn.ExecContext(ctx, script)
+	traceCall(script, 0, start, result, err)
+	if err != nil {
+		_, _ = h.conn.ExecContext(context.Background(), "ROLLBACK") // in case the script's own transaction is open
+		if err2 := h.startTransaction(); err2 != nil {
+			return err2
+		}
+		return err
+	}
+	return h.startTransaction()
+}
+
+// sqlScript strips sqlite3 shell dot-commands from script so that the rest can
+// be run as plain SQL. Only ".bail on" is accepted, and it needs no
+// translation because execution always stops at the first error.
+func sqlScript(script string) (string, error) {
+	lines := strings.Split(script, "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, ".") {
+			continue
+		}
+		if strings.Join(strings.Fields(line), " ") != ".bail on" {
+			return "", fmt.Errorf("line %d: unsupported dot-command %q", i+1, line)
+		}
+		lines[i] = ""
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateSchema(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("creates tables in empty database", func(t *testing.T) {
+		h := openTestHandle(t)
+
+		require.NoError(t, h.CreateSchema(ctx))
+
+		_, err := h.Exec("INSERT INTO accounts (uid, name, name_key, encrypt) VALUES (666000, 'new', 'new', 'x')")
+		require.NoError(t, err)
+
+		// The schema is marked as fully migrated.
+		pending, err := h.PendingMigrations(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, pending)
+	})
+
+	t.Run("leaves existing database alone", func(t *testing.T) {
+		h := openTestHandle(t)
+
+		_, err := h.Exec("CREATE TABLE other (x INTEGER)")
+		require.NoError(t, err)
+		require.NoError(t, h.Commit())
+
+		require.NoError(t, h.CreateSchema(ctx))
+
+		_, err = h.Exec("SELECT uid FROM accounts")
+		require.Error(t, err)
+	})
+
+	t.Run("commits pending work first", func(t *testing.T) {
+		h := openTestHandle(t)
+
+		_, err := h.Exec("PRAGMA user_version = 0") // harmless pending statement
+		require.NoError(t, err)
+		require.NoError(t, h.CreateSchema(ctx))
+
+		// The auto-transaction is still usable afterwards.
+		_, err = h.Exec("SELECT uid FROM accounts")
+		require.NoError(t, err)
+		require.NoError(t, h.Rollback())
+	})
+
+	t.Run("works through default handle", func(t *testing.T) {
+		setupTestDB(t)
+		require.NoError(t, Connect(false))
+
+		require.NoError(t, CreateSchema(ctx))
+		assert.Equal(t, 1, IsCancelled(999999)) // Query succeeds; missing account counts as cancelled
+
+		require.NoError(t, Disconnect())
+	})
+}
+
+func TestSQLScript(t *testing.T) {
+	t.Run("removes .bail on", func(t *testing.T) {
+		script, err := sqlScript(".bail on\n\nCREATE TABLE t (x INTEGER);\n")
+		require.NoError(t, err)
+		assert.Equal(t, "\n\nCREATE TABLE t (x INTEGER);\n", script)
+	})
+
+	t.Run("tolerates extra spacing", func(t *testing.T) {
+		_, err := sqlScript(".bail   on  \nSELECT 1;")
+		require.NoError(t, err)
+	})
+
+	t.Run("rejects other dot-commands", func(t *testing.T) {
+		_, err := sqlScript("SELECT 1;\n.read other.sql\n")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "line 2")
+
+		_, err = sqlScript(".bail off\n")
+		require.Error(t, err)
+	})
+
+	t.Run("leaves SQL alone", func(t *testing.T) {
+		const sql = "SELECT '.not a command';\n  .5 + 1;\n"
+		script, err := sqlScript(sql)
+		require.NoError(t, err)
+		assert.Equal(t, sql, script)
+	})
+}
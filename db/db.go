@@ -8,154 +8,162 @@
 // - Commit/Rollback restart transactions automatically
 // - Disconnect cleanly closes the connection
 // - Exit abandons the connection (for process termination)
+//
+// The package-level functions operate on a default Handle. Programs that need
+// more than one connection can Open further handles of their own.
 package db
 
 import (
 	"context"
 	"database/sql"
 	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
 
 	_ "modernc.org/sqlite"
-)
 
-var (
-	db   *sql.DB   // Global database connection
-	conn *sql.Conn // Single connection from the pool
-	tx   *sql.Tx   // Current auto-transaction
+	"github.com/nosborn/ibgames-1999/config"
 )
 
+var std *Handle // Default handle, set by Connect
+
 // Commit commits the current transaction and immediately starts a new one,
 // matching Informix ANSI auto-transaction behaviour.
 func Commit() error {
-	err := tx.Commit()
-	if err != nil {
-		return err
-	}
-	tx = nil
-	return startTransaction()
+	return std.Commit()
+}
+
+// CommitContext is like Commit but gives up without committing if ctx is
+// done.
+func CommitContext(ctx context.Context) error {
+	return std.CommitContext(ctx)
 }
 
 // Connect establishes a connection to the accounts database. Like the original
 // Informix implementation, the database name is hardcoded and the location is
-// determined by the DBPATH environment variable. Only one connection can be
+// the configured dbpath, normally from the DBPATH environment variable. A bad
+// configuration is reported here rather than later. Only one connection can be
 // active at a time.
 func Connect(readOnly bool) error {
-	if db != nil {
-		return fmt.Errorf("already open")
-	}
+	return ConnectContext(context.Background(), readOnly)
+}
 
-	dbPath, ok := os.LookupEnv("DBPATH")
-	if !ok {
-		return fmt.Errorf("DBPATH not set")
-	}
-	dbFile := filepath.Join(dbPath, "ibgames.sqlite")
-
-	dsnParams := []string{
-		"_pragma=automatic_index(0)",
-		"_pragma=busy_timeout(5000)",
-		"_pragma=foreign_keys(1)",
-		"_pragma=journal_mode(WAL)",
-		"_time_format=sqlite",
-	}
-	if readOnly {
-		dsnParams = append(dsnParams, "_pragma=query_only(1)") // not truly read-only
+// ConnectContext is like Connect but uses ctx while connecting.
+func ConnectContext(ctx context.Context, readOnly bool) error {
+	if std != nil {
+		return fmt.Errorf("already open")
 	}
 
-	dsn := fmt.Sprintf("file:%s?%s", dbFile, strings.Join(dsnParams, "&"))
-	var err error
-	db, err = sql.Open("sqlite", dsn)
-	if err != nil {
+	if err := config.Init(); err != nil {
 		return err
 	}
 
-	conn, err = db.Conn(context.Background())
+	h, err := OpenContext(ctx, config.Get().DBPath, readOnly)
 	if err != nil {
 		return err
 	}
+	std = h
+	return nil
+}
 
-	return startTransaction()
+// Default returns the handle used by the package-level functions, or nil if
+// Connect hasn't been called.
+func Default() *Handle {
+	return std
 }
 
 // Detach detaches from the database server, equivalent to Informix
 // sqldetach(). Used in fork/exec scenarios where child processes need to clean
 // up inherited database connections without affecting the parent process.
+// Returns 0 on success; there is nothing that can fail. Afterwards Connect can
+// be called to open a connection of the child's own. See Handle.Detach.
 func Detach() int {
-	// TODO: Implement if needed for process forking scenarios
-	return -1
+	if std != nil {
+		std.Detach()
+	}
+	std = nil
+	return 0
 }
 
 // Disconnect cleanly closes the database connection after committing the
 // current transaction. Like Informix DISCONNECT CURRENT, this resets all
 // connection state and allows a new Connect() to be called.
 func Disconnect() error {
-	if db == nil {
+	return DisconnectContext(context.Background())
+}
+
+// DisconnectContext is like Disconnect but gives up without committing if ctx
+// is done.
+func DisconnectContext(ctx context.Context) error {
+	if std == nil {
 		return nil
 	}
-	if err := tx.Commit(); err != nil { // DISCONNECT issues a COMMIT in Informix.
-		return err
-	}
-	tx = nil
-	if err := conn.Close(); err != nil {
-		return err
-	}
-	conn = nil
-	if err := db.Close(); err != nil {
+	if err := std.CloseContext(ctx); err != nil {
 		return err
 	}
-	db = nil
+	std = nil
 	return nil
 }
 
 // Exec executes a SQL statement within the current auto-transaction.
 func Exec(query string, args ...any) (sql.Result, error) {
-	return tx.Exec(query, args...)
+	return std.Exec(query, args...)
+}
+
+// ExecContext is like Exec but uses ctx for the statement.
+func ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return std.ExecContext(ctx, query, args...)
 }
 
 // Exit abandons the database connection, equivalent to Informix sqlexit().
 // This rolls back any open transaction and closes the database without error
 // handling, typically used during process termination.
 func Exit() error {
-	if tx != nil {
-		_ = tx.Rollback() // sqlexit() rolls back open transactions
-		tx = nil
-	}
-	if db != nil {
-		_ = db.Close() // sqlexit() closes databases, ignore errors
+	if std != nil {
+		std.Abandon()
 	}
-	conn, db = nil, nil
+	std = nil
 	return nil
 }
 
 // Prepare prepares a SQL statement for repeated execution. The statement is
 // prepared on the connection, not the transaction.
-func Prepare(query string) (*sql.Stmt, error) {
-	return conn.PrepareContext(context.Background(), query)
+func Prepare(query string) (*Stmt, error) {
+	return std.Prepare(query)
+}
+
+// PrepareContext is like Prepare but uses ctx while preparing.
+func PrepareContext(ctx context.Context, query string) (*Stmt, error) {
+	return std.PrepareContext(ctx, query)
+}
+
+// Query executes a query that returns rows within the current
+// auto-transaction.
+func Query(query string, args ...any) (*sql.Rows, error) {
+	return std.Query(query, args...)
+}
+
+// QueryContext is like Query but uses ctx for the query.
+func QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return std.QueryContext(ctx, query, args...)
 }
 
 // QueryRow executes a query that returns at most one row within the current
 // auto-transaction.
-func QueryRow(query string, args ...any) *sql.Row {
-	return tx.QueryRow(query, args...)
+func QueryRow(query string, args ...any) *Row {
+	return std.QueryRow(query, args...)
+}
+
+// QueryRowContext is like QueryRow but uses ctx for the query.
+func QueryRowContext(ctx context.Context, query string, args ...any) *Row {
+	return std.QueryRowContext(ctx, query, args...)
 }
 
 // Rollback rolls back the current transaction and immediately starts a new
 // one, matching Informix ANSI auto-transaction behaviour.
 func Rollback() error {
-	if err := tx.Rollback(); err != nil {
-		return err
-	}
-	tx = nil
-	return startTransaction()
+	return std.Rollback()
 }
 
-// startTransaction begins a new transaction on the connection. This is called
-// automatically after Connect, Commit, and Rollback to maintain the Informix
-// ANSI auto-transaction semantics.
-func startTransaction() error {
-	var err error
-	tx, err = conn.BeginTx(context.Background(), nil)
-	return err
+// RollbackContext is like Rollback.
+func RollbackContext(ctx context.Context) error {
+	return std.RollbackContext(ctx)
 }
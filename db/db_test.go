@@ -1,16 +1,20 @@
 package db
 
 import (
+	"context"
 	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/nosborn/ibgames-1999/config"
 )
 
 func setupTestDB(t *testing.T) {
 	tmpDir := t.TempDir()
 	os.Setenv("DBPATH", tmpDir)
+	config.Set(nil) // Load DBPATH again
 
 	t.Cleanup(func() {
 		Exit()
@@ -111,3 +115,55 @@ func TestAlreadyConnected(t *testing.T) {
 	err = Disconnect()
 	require.NoError(t, err)
 }
+
+func TestContextOperations(t *testing.T) {
+	setupTestDB(t)
+
+	err := ConnectContext(context.Background(), false)
+	require.NoError(t, err)
+
+	_, err = ExecContext(context.Background(), "CREATE TABLE test (id INTEGER PRIMARY KEY, name TEXT)")
+	require.NoError(t, err)
+	require.NoError(t, CommitContext(context.Background()))
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	t.Run("canceled context stops statements", func(t *testing.T) {
+		_, err := ExecContext(canceled, "INSERT INTO test (name) VALUES ('canceled')")
+		require.ErrorIs(t, err, context.Canceled)
+
+		var n int
+		err = QueryRowContext(canceled, "SELECT COUNT(*) FROM test").Scan(&n)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("canceled context stops commit", func(t *testing.T) {
+		_, err := Exec("INSERT INTO test (name) VALUES ('pending')")
+		require.NoError(t, err)
+
+		err = CommitContext(canceled)
+		require.ErrorIs(t, err, context.Canceled)
+
+		// The transaction is still open and can be committed later.
+		require.NoError(t, Commit())
+
+		var n int
+		err = QueryRow("SELECT COUNT(*) FROM test").Scan(&n)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+	})
+
+	t.Run("auto-transaction survives canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		_, err := ExecContext(ctx, "INSERT INTO test (name) VALUES ('survivor')")
+		require.NoError(t, err)
+		cancel()
+
+		require.NoError(t, RollbackContext(canceled))
+		_, err = Exec("SELECT 1")
+		require.NoError(t, err)
+	})
+
+	require.NoError(t, DisconnectContext(context.Background()))
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const detachChildEnv = "IBGAMES_DETACH_CHILD"
+
+func TestDetach(t *testing.T) {
+	t.Run("allows reconnection", func(t *testing.T) {
+		setupTestDB(t)
+
+		require.NoError(t, Connect(false))
+		_, err := Exec("CREATE TABLE test (name TEXT)")
+		require.NoError(t, err)
+		require.NoError(t, Commit())
+
+		assert.Equal(t, 0, Detach())
+		assert.Nil(t, Default())
+
+		require.NoError(t, Connect(false))
+		_, err = Exec("SELECT name FROM test")
+		require.NoError(t, err)
+		require.NoError(t, Disconnect())
+	})
+
+	t.Run("without connection is harmless", func(t *testing.T) {
+		assert.Equal(t, 0, Detach())
+	})
+
+	t.Run("releases own snapshot without committing", func(t *testing.T) {
+		dir := t.TempDir()
+		h1, err := Open(dir, false)
+		require.NoError(t, err)
+		t.Cleanup(h1.Abandon)
+		_, err = h1.Exec("CREATE TABLE test (name TEXT)")
+		require.NoError(t, err)
+		require.NoError(t, h1.Commit())
+
+		h2, err := Open(dir, false)
+		require.NoError(t, err)
+		var n int
+		require.NoError(t, h2.QueryRow("SELECT COUNT(*) FROM test").Scan(&n)) // Take a snapshot.
+		_, err = h2.Exec("INSERT INTO test (name) VALUES ('pending')")
+		require.NoError(t, err)
+
+		h2.Detach()
+
+		_, err = h1.Exec("INSERT INTO test (name) VALUES ('later')")
+		require.NoError(t, err)
+		require.NoError(t, h1.Commit())
+		var busy, frames, done int
+		err = h1.conn.QueryRowContext(context.Background(), "PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &frames, &done)
+		require.NoError(t, err)
+		assert.Zero(t, busy, "checkpoint held up by detached snapshot")
+
+		require.NoError(t, h1.QueryRow("SELECT COUNT(*) FROM test").Scan(&n))
+		assert.Equal(t, 1, n) // h2's pending row was never committed
+	})
+
+	t.Run("child leaves parent's work alone", func(t *testing.T) {
+		setupTestDB(t)
+
+		require.NoError(t, Connect(false))
+		_, err := Exec("CREATE TABLE test (name TEXT)")
+		require.NoError(t, err)
+		_, err = Exec("INSERT INTO test (name) VALUES ('committed')")
+		require.NoError(t, err)
+		require.NoError(t, Commit())
+
+		// Leave some work in progress while the child runs.
+		_, err = Exec("INSERT INTO test (name) VALUES ('pending')")
+		require.NoError(t, err)
+
+		cmd := exec.Command(os.Args[0], "-test.run=^TestDetachChild$", "-test.v")
+		cmd.Env = append(os.Environ(), detachChildEnv+"=1")
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, "child failed:\n%s", output)
+		require.Contains(t, string(output), "--- PASS: TestDetachChild")
+
+		// The parent's transaction is intact and can still be committed.
+		assert.True(t, Default().Uncommitted())
+		require.NoError(t, Commit())
+
+		var n int
+		require.NoError(t, QueryRow("SELECT COUNT(*) FROM test").Scan(&n))
+		assert.Equal(t, 2, n)
+		require.NoError(t, Disconnect())
+	})
+
+	t.Run("handle copied by fork leaves parent's work alone", func(t *testing.T) {
+		parent := openTestHandle(t)
+		_, err := parent.Exec("CREATE TABLE test (name TEXT)")
+		require.NoError(t, err)
+		require.NoError(t, parent.Commit())
+		_, err = parent.Exec("INSERT INTO test (name) VALUES ('pending')")
+		require.NoError(t, err)
+
+		// After fork the child has a copy of the handle, made by another
+		// process.
+		child := *parent
+		child.pid = -1
+		child.Detach()
+
+		// The parent's transaction is intact and can still be committed.
+		require.NoError(t, parent.Commit())
+		var n int
+		require.NoError(t, parent.QueryRow("SELECT COUNT(*) FROM test").Scan(&n))
+		assert.Equal(t, 1, n)
+	})
+}
+
+// TestDetachChild is run by TestDetach in a child process, in the same way
+// that a daemon spawns a per-connection worker.
+func TestDetachChild(t *testing.T) {
+	if os.Getenv(detachChildEnv) != "1" {
+		t.Skip("only run as a child of TestDetach")
+	}
+
+	// The worker lets go of whatever it inherited and connects for itself.
+	require.Equal(t, 0, Detach())
+	require.NoError(t, Connect(false))
+	var n int
+	require.NoError(t, QueryRow("SELECT COUNT(*) FROM test").Scan(&n))
+	require.Equal(t, 1, n) // The parent's pending row isn't visible
+	require.NoError(t, Disconnect())
+}
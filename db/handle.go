@@ -0,0 +1,381 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Handle is a connection to the accounts database with its own
+// auto-transaction. A process may hold several handles, to the same or
+// different databases, but a single Handle must not be used by more than one
+// goroutine at a time.
+//
+// The Context variants of the methods apply the context to the operation
+// itself. The auto-transaction outlives any one request, so it is never tied
+// to a caller's context.
+//
+// If the connection fails or the database file is replaced, the handle
+// reconnects when the next auto-transaction starts. See Ping.
+type Handle struct {
+	db         *sql.DB     // Database connection
+	conn       *sql.Conn   // Single connection from the pool
+	tx         *sql.Tx     // Current auto-transaction
+	file       string      // Database file name
+	mode       string      // Open mode: "rwc", "ro" or "immutable"
+	readOnly   bool        // Opened with mode=ro or immutable
+	info       os.FileInfo // File as it was when connected, if it existed
+	generation int         // Incremented by every reconnection
+	reconnects int         // Number of reconnections
+	dirty      bool        // Auto-transaction has uncommitted writes
+	broken     bool        // Connection has failed
+	pid        int         // Process that made the connection
+}
+
+// ErrReadOnly is returned when a statement is executed on a read-only handle.
+var ErrReadOnly = errors.New("database handle is read-only")
+
+// Open connects to the accounts database in directory dbPath and starts the
+// first auto-transaction.
+//
+// A read-only handle opens the file with mode=ro, so the database must already
+// exist, and its auto-transactions are deferred read transactions that never
+// take the write lock. Exec always fails with ErrReadOnly, so Commit can only
+// ever end the read transaction and move on to a fresh snapshot.
+func Open(dbPath string, readOnly bool) (*Handle, error) {
+	return OpenContext(context.Background(), dbPath, readOnly)
+}
+
+// OpenContext is like Open but uses ctx while connecting.
+func OpenContext(ctx context.Context, dbPath string, readOnly bool) (*Handle, error) {
+	dbFile := filepath.Join(dbPath, "ibgames.sqlite")
+	if readOnly {
+		return open(ctx, dbFile, "ro")
+	}
+	return open(ctx, dbFile, "rwc")
+}
+
+// OpenSnapshot opens a read-only handle on a database file that nothing will
+// change while it is open, such as a backup. SQLite is told the file is
+// immutable, so no locks are taken and no -wal or -shm files are used.
+func OpenSnapshot(dbFile string) (*Handle, error) {
+	return OpenSnapshotContext(context.Background(), dbFile)
+}
+
+// OpenSnapshotContext is like OpenSnapshot but uses ctx while connecting.
+func OpenSnapshotContext(ctx context.Context, dbFile string) (*Handle, error) {
+	if _, err := os.Stat(dbFile); err != nil {
+		return nil, err
+	}
+	return open(ctx, dbFile, "immutable")
+}
+
+// open opens dbFile in one of the modes "rwc" (read-write, create if missing),
+// "ro" (read-only) or "immutable" (read-only, never changes).
+func open(ctx context.Context, dbFile, mode string) (*Handle, error) {
+	h := &Handle{file: dbFile, mode: mode, readOnly: mode != "rwc"}
+	if err := h.connect(ctx); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// connect opens a connection to the handle's file and starts the first
+// auto-transaction.
+func (h *Handle) connect(ctx context.Context) error {
+	dsnParams := []string{
+		"_pragma=automatic_index(0)",
+		"_pragma=busy_timeout(5000)",
+		"_pragma=foreign_keys(1)",
+		"_time_format=sqlite",
+	}
+	switch h.mode {
+	case "rwc":
+		dsnParams = append(dsnParams, "_pragma=journal_mode(WAL)")
+	case "ro":
+		dsnParams = append(dsnParams, "mode=ro", "_pragma=query_only(1)")
+	case "immutable":
+		dsnParams = append(dsnParams, "immutable=1", "mode=ro", "_pragma=query_only(1)")
+	default:
+		panic("bad open mode " + h.mode)
+	}
+
+	dsn := fmt.Sprintf("file:%s?%s", h.file, strings.Join(dsnParams, "&"))
+	sqlDB, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return err
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		_ = sqlDB.Close()
+		return err
+	}
+
+	tx, err := conn.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: h.readOnly})
+	if err != nil {
+		_ = conn.Close()
+		_ = sqlDB.Close()
+		return err
+	}
+
+	h.db, h.conn, h.tx = sqlDB, conn, tx
+	h.pid = os.Getpid()
+	h.info, _ = os.Stat(h.file) // nil if it can't be seen, which disables the check
+	h.dirty, h.broken = false, false
+	return nil
+}
+
+// Abandon rolls back any open transaction and closes the handle without error
+// handling, like Informix sqlexit().
+func (h *Handle) Abandon() {
+	if h.tx != nil {
+		_ = h.tx.Rollback()
+		h.tx = nil
+	}
+	if h.db != nil {
+		_ = h.db.Close()
+	}
+	h.conn, h.db = nil, nil
+}
+
+// Detach gives up the handle's connection without committing. The handle
+// can't be used afterwards.
+//
+// If the process made the connection itself, its transaction is rolled back
+// and the connection closed, so that the process holds no locks and no WAL
+// snapshot that would hold up checkpoints. A forked child's copy of its
+// parent's connection is only forgotten: the transaction belongs to the
+// parent, and the child has none of the parent's locks to release.
+func (h *Handle) Detach() {
+	if h.pid == os.Getpid() {
+		if h.tx != nil {
+			_ = h.tx.Rollback()
+		}
+		if h.conn != nil {
+			_ = h.conn.Close()
+		}
+		if h.db != nil {
+			_ = h.db.Close()
+		}
+	}
+	h.tx, h.conn, h.db = nil, nil, nil
+}
+
+// Close commits the current transaction and closes the handle, like Informix
+// DISCONNECT CURRENT.
+func (h *Handle) Close() error {
+	return h.CloseContext(context.Background())
+}
+
+// CloseContext is like Close but gives up without committing if ctx is done.
+func (h *Handle) CloseContext(ctx context.Context) error {
+	if h.db == nil {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if h.tx != nil {
+		if h.replaced() && h.dirty {
+			return ErrDatabaseReplaced
+		}
+		if err := h.tx.Commit(); err != nil { // DISCONNECT issues a COMMIT in Informix.
+			return err
+		}
+		h.tx = nil
+	}
+	if err := h.conn.Close(); err != nil {
+		return err
+	}
+	h.conn = nil
+	if err := h.db.Close(); err != nil {
+		return err
+	}
+	h.db = nil
+	return nil
+}
+
+// Commit commits the current transaction and immediately starts a new one.
+func (h *Handle) Commit() error {
+	return h.CommitContext(context.Background())
+}
+
+// CommitContext is like Commit but gives up without committing if ctx is
+// done. Once the commit has started it runs to completion.
+//
+// If the database file has been replaced since the handle connected, work in
+// the transaction would be committed to the old file and lost, so Commit
+// fails with ErrDatabaseReplaced and leaves the transaction open. Rollback
+// discards the work and reconnects.
+func (h *Handle) CommitContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if h.tx == nil { // The last reconnection failed.
+		return h.nextTransaction(ctx)
+	}
+	if h.replaced() {
+		if h.dirty {
+			return ErrDatabaseReplaced
+		}
+		_ = h.tx.Rollback() // Nothing to lose
+		h.tx = nil
+		return h.reconnect(ctx)
+	}
+
+	start := time.Now()
+	err := h.tx.Commit()
+	traceCall("COMMIT", 0, start, nil, err)
+	if err != nil {
+		h.noteError(err)
+		return err
+	}
+	h.tx, h.dirty = nil, false
+	return h.nextTransaction(ctx)
+}
+
+// Exec executes a SQL statement within the current auto-transaction.
+func (h *Handle) Exec(query string, args ...any) (sql.Result, error) {
+	return h.ExecContext(context.Background(), query, args...)
+}
+
+// ExecContext is like Exec but uses ctx for the statement.
+func (h *Handle) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if h.readOnly {
+		return nil, ErrReadOnly
+	}
+	result, err := h.exec(ctx, query, args...)
+	h.noteWrite(err)
+	return result, err
+}
+
+// exec executes a statement within the current auto-transaction, even on a
+// read-only handle, without marking the transaction as having writes.
+func (h *Handle) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	tx, err := h.transaction()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	result, err := tx.ExecContext(ctx, query, args...)
+	traceCall(query, len(args), start, result, err)
+	h.noteError(err)
+	return result, err
+}
+
+// Prepare prepares a SQL statement for repeated execution. The statement is
+// prepared on the connection, not the transaction.
+func (h *Handle) Prepare(query string) (*Stmt, error) {
+	return h.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext is like Prepare but uses ctx while preparing. The statement
+// itself isn't bound to ctx.
+func (h *Handle) PrepareContext(ctx context.Context, query string) (*Stmt, error) {
+	stmt, err := h.conn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &Stmt{h: h, stmt: stmt, query: query, generation: h.generation}, nil
+}
+
+// Query executes a query that returns rows within the current
+// auto-transaction. The rows must be closed before the next Commit or
+// Rollback.
+func (h *Handle) Query(query string, args ...any) (*sql.Rows, error) {
+	return h.QueryContext(context.Background(), query, args...)
+}
+
+// QueryContext is like Query but uses ctx for the query.
+func (h *Handle) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	tx, err := h.transaction()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	rows, err := tx.QueryContext(ctx, query, args...)
+	traceCall(query, len(args), start, nil, err)
+	h.noteError(err)
+	return rows, err
+}
+
+// QueryRow executes a query that returns at most one row within the current
+// auto-transaction.
+func (h *Handle) QueryRow(query string, args ...any) *Row {
+	return h.QueryRowContext(context.Background(), query, args...)
+}
+
+// QueryRowContext is like QueryRow but uses ctx for the query.
+func (h *Handle) QueryRowContext(ctx context.Context, query string, args ...any) *Row {
+	tx, err := h.transaction()
+	if err != nil {
+		return &Row{err: err}
+	}
+	start := time.Now()
+	row := tx.QueryRowContext(ctx, query, args...)
+	traceCall(query, len(args), start, nil, row.Err())
+	h.noteError(row.Err())
+	return &Row{row: row}
+}
+
+// Rollback rolls back the current transaction and immediately starts a new
+// one.
+func (h *Handle) Rollback() error {
+	return h.RollbackContext(context.Background())
+}
+
+// RollbackContext is like Rollback. Abandoning a rollback part way would leave
+// the connection in an unknown state, so ctx is used only if the handle has to
+// reconnect.
+//
+// Rollback also recovers from a failed Commit: the transaction is finished
+// off and, if the connection has failed or the file has been replaced, the
+// handle reconnects.
+func (h *Handle) RollbackContext(ctx context.Context) error {
+	if h.tx != nil {
+		start := time.Now()
+		err := h.tx.Rollback()
+		traceCall("ROLLBACK", 0, start, nil, err)
+		h.noteError(err)
+		switch {
+		case err == nil, h.broken:
+		case errors.Is(err, sql.ErrTxDone):
+			// A COMMIT that failed with SQLITE_BUSY leaves SQLite's
+			// transaction open even though database/sql considers
+			// it finished. Any other failure has already ended it,
+			// so the ROLLBACK's own error doesn't matter.
+			_, _ = h.conn.ExecContext(context.Background(), "ROLLBACK")
+		default:
+			return err
+		}
+	}
+	h.tx, h.dirty = nil, false
+	return h.nextTransaction(ctx)
+}
+
+// transaction returns the current auto-transaction, or ErrNoTransaction if
+// the last reconnection failed to start one. Statements must only be run in
+// the transaction it returns, never on the bare connection, where they would
+// be committed straight away.
+func (h *Handle) transaction() (*sql.Tx, error) {
+	if h.tx == nil {
+		return nil, ErrNoTransaction
+	}
+	return h.tx, nil
+}
+
+// startTransaction begins a new transaction on the connection. This is called
+// automatically after Commit and Rollback to maintain the Informix ANSI
+// auto-transaction semantics.
+func (h *Handle) startTransaction() error {
+	var err error
+	opts := &sql.TxOptions{ReadOnly: h.readOnly}           // always a deferred BEGIN
+	h.tx, err = h.conn.BeginTx(context.Background(), opts) // not bound to any request
+	return err
+}
@@ -0,0 +1,216 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestHandle(t *testing.T) *Handle {
+	h, err := Open(t.TempDir(), false)
+	require.NoError(t, err)
+	t.Cleanup(h.Abandon)
+	return h
+}
+
+func TestHandle(t *testing.T) {
+	t.Run("handles are independent", func(t *testing.T) {
+		h1 := openTestHandle(t)
+		h2 := openTestHandle(t)
+
+		_, err := h1.Exec("CREATE TABLE test (name TEXT)")
+		require.NoError(t, err)
+		_, err = h1.Exec("INSERT INTO test (name) VALUES ('one')")
+		require.NoError(t, err)
+		require.NoError(t, h1.Commit())
+
+		// The second handle is a different database.
+		_, err = h2.Exec("SELECT name FROM test")
+		require.Error(t, err)
+
+		var name string
+		err = h1.QueryRow("SELECT name FROM test").Scan(&name)
+		require.NoError(t, err)
+		assert.Equal(t, "one", name)
+	})
+
+	t.Run("rollback discards work on this handle only", func(t *testing.T) {
+		dir := t.TempDir()
+		h1, err := Open(dir, false)
+		require.NoError(t, err)
+		t.Cleanup(h1.Abandon)
+
+		_, err = h1.Exec("CREATE TABLE test (name TEXT)")
+		require.NoError(t, err)
+		require.NoError(t, h1.Commit())
+
+		h2, err := Open(dir, false)
+		require.NoError(t, err)
+		t.Cleanup(h2.Abandon)
+
+		_, err = h1.Exec("INSERT INTO test (name) VALUES ('kept')")
+		require.NoError(t, err)
+		require.NoError(t, h1.Commit())
+
+		_, err = h1.Exec("INSERT INTO test (name) VALUES ('discarded')")
+		require.NoError(t, err)
+		require.NoError(t, h1.Rollback())
+
+		var n int
+		err = h2.QueryRow("SELECT COUNT(*) FROM test").Scan(&n)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+	})
+
+	t.Run("prepared statements run on the handle's connection", func(t *testing.T) {
+		h := openTestHandle(t)
+
+		stmt, err := h.Prepare("SELECT ? + 1")
+		require.NoError(t, err)
+		defer stmt.Close()
+
+		var n int
+		require.NoError(t, stmt.QueryRow(41).Scan(&n))
+		assert.Equal(t, 42, n)
+	})
+
+	t.Run("query returns rows", func(t *testing.T) {
+		h := openTestHandle(t)
+
+		_, err := h.Exec("CREATE TABLE test (name TEXT)")
+		require.NoError(t, err)
+		_, err = h.Exec("INSERT INTO test (name) VALUES ('one'), ('two')")
+		require.NoError(t, err)
+
+		rows, err := h.Query("SELECT name FROM test ORDER BY name")
+		require.NoError(t, err)
+		var names []string
+		for rows.Next() {
+			var name string
+			require.NoError(t, rows.Scan(&name))
+			names = append(names, name)
+		}
+		require.NoError(t, rows.Err())
+		require.NoError(t, rows.Close())
+		assert.Equal(t, []string{"one", "two"}, names)
+	})
+
+	t.Run("close commits", func(t *testing.T) {
+		dir := t.TempDir()
+		h, err := Open(dir, false)
+		require.NoError(t, err)
+
+		_, err = h.Exec("CREATE TABLE test (name TEXT)")
+		require.NoError(t, err)
+		require.NoError(t, h.Close())
+		require.NoError(t, h.Close()) // Closing twice is harmless
+
+		h, err = Open(dir, false)
+		require.NoError(t, err)
+		defer h.Abandon()
+		_, err = h.Exec("SELECT name FROM test")
+		assert.NoError(t, err)
+	})
+}
+
+func TestDefault(t *testing.T) {
+	setupTestDB(t)
+
+	assert.Nil(t, Default())
+
+	require.NoError(t, Connect(false))
+	assert.NotNil(t, Default())
+
+	require.NoError(t, Disconnect())
+	assert.Nil(t, Default())
+}
+
+func TestReadOnlyHandle(t *testing.T) {
+	dir := t.TempDir()
+	writer, err := Open(dir, false)
+	require.NoError(t, err)
+	t.Cleanup(writer.Abandon)
+
+	_, err = writer.Exec("CREATE TABLE test (name TEXT)")
+	require.NoError(t, err)
+	_, err = writer.Exec("INSERT INTO test (name) VALUES ('first')")
+	require.NoError(t, err)
+	require.NoError(t, writer.Commit())
+
+	reader, err := Open(dir, true)
+	require.NoError(t, err)
+	t.Cleanup(reader.Abandon)
+
+	countRows := func() int {
+		var n int
+		require.NoError(t, reader.QueryRow("SELECT COUNT(*) FROM test").Scan(&n))
+		return n
+	}
+
+	t.Run("reads", func(t *testing.T) {
+		assert.Equal(t, 1, countRows())
+	})
+
+	t.Run("rejects Exec", func(t *testing.T) {
+		_, err := reader.Exec("INSERT INTO test (name) VALUES ('sneaky')")
+		require.ErrorIs(t, err, ErrReadOnly)
+		require.NoError(t, reader.Commit())
+	})
+
+	t.Run("rejects writes through prepared statements", func(t *testing.T) {
+		stmt, err := reader.Prepare("INSERT INTO test (name) VALUES ('sneaky')")
+		if err == nil {
+			defer stmt.Close()
+			_, err = stmt.Exec()
+		}
+		require.Error(t, err)
+		require.NoError(t, reader.Rollback())
+		assert.Equal(t, 1, countRows())
+	})
+
+	t.Run("doesn't block writer", func(t *testing.T) {
+		// The reader holds a snapshot in its open transaction.
+		assert.Equal(t, 1, countRows())
+
+		_, err := writer.Exec("INSERT INTO test (name) VALUES ('second')")
+		require.NoError(t, err)
+		require.NoError(t, writer.Commit())
+
+		assert.Equal(t, 1, countRows()) // Still the old snapshot
+
+		require.NoError(t, reader.Commit())
+		assert.Equal(t, 2, countRows())
+	})
+
+	t.Run("doesn't create missing database", func(t *testing.T) {
+		_, err := Open(t.TempDir(), true)
+		require.Error(t, err)
+	})
+}
+
+func TestOpenSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	h, err := Open(dir, false)
+	require.NoError(t, err)
+	_, err = h.Exec("CREATE TABLE test (name TEXT)")
+	require.NoError(t, err)
+	_, err = h.Exec("INSERT INTO test (name) VALUES ('saved')")
+	require.NoError(t, err)
+	require.NoError(t, h.Close()) // Last connection out checkpoints the WAL
+
+	snapshot, err := OpenSnapshot(filepath.Join(dir, "ibgames.sqlite"))
+	require.NoError(t, err)
+	defer snapshot.Abandon()
+
+	var name string
+	require.NoError(t, snapshot.QueryRow("SELECT name FROM test").Scan(&name))
+	assert.Equal(t, "saved", name)
+
+	_, err = snapshot.Exec("DELETE FROM test")
+	require.ErrorIs(t, err, ErrReadOnly)
+
+	_, err = OpenSnapshot(filepath.Join(t.TempDir(), "missing.sqlite"))
+	require.Error(t, err)
+}
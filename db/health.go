@@ -0,0 +1,170 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"os"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+var (
+	// ErrDatabaseReplaced is returned by Commit and Close when the database
+	// file has been replaced, by a restore for example, while the
+	// auto-transaction has uncommitted work.
+	ErrDatabaseReplaced = errors.New("database file has been replaced")
+
+	// ErrNoTransaction is returned when the handle couldn't reconnect. The
+	// next Commit or Rollback tries again.
+	ErrNoTransaction = errors.New("no database transaction")
+
+	// ErrNotConnected is returned by Ping when Connect hasn't been called.
+	ErrNotConnected = errors.New("not connected to database")
+)
+
+// isConnError reports whether err means the connection can't be used any more.
+func isConnError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	if sqliteErr.Code() == sqlite3.SQLITE_READONLY_DBMOVED {
+		return true
+	}
+	switch sqliteErr.Code() & 0xff { // Primary result code
+	case sqlite3.SQLITE_IOERR, sqlite3.SQLITE_CORRUPT, sqlite3.SQLITE_CANTOPEN, sqlite3.SQLITE_NOTADB:
+		return true
+	default:
+		return false
+	}
+}
+
+// noteError marks the connection broken if err says so.
+func (h *Handle) noteError(err error) {
+	if err != nil && isConnError(err) {
+		h.broken = true
+	}
+}
+
+// noteWrite records the outcome of a statement that may have changed the
+// database.
+func (h *Handle) noteWrite(err error) {
+	if err == nil {
+		h.dirty = true
+	}
+	h.noteError(err)
+}
+
+// replaced reports whether the handle's file is no longer the one it
+// connected to.
+func (h *Handle) replaced() bool {
+	if h.info == nil {
+		return false
+	}
+	info, err := os.Stat(h.file)
+	return err != nil || !os.SameFile(h.info, info)
+}
+
+// nextTransaction starts the next auto-transaction, reconnecting first if
+// the connection has failed or the file has been replaced.
+func (h *Handle) nextTransaction(ctx context.Context) error {
+	if h.broken || h.replaced() {
+		return h.reconnect(ctx)
+	}
+	return h.startTransaction()
+}
+
+// reconnect replaces the handle's connection with a new one. It must only be
+// called between transactions. If the new connection can't be made the old
+// one is kept, so that later calls report errors rather than crash.
+func (h *Handle) reconnect(ctx context.Context) error {
+	oldDB, oldConn := h.db, h.conn
+	if err := h.connect(ctx); err != nil {
+		h.db, h.conn, h.broken = oldDB, oldConn, true
+		_ = h.startTransaction() // Leaves h.tx nil on failure.
+		return err
+	}
+	if oldConn != nil {
+		_ = oldConn.Close()
+	}
+	if oldDB != nil {
+		_ = oldDB.Close()
+	}
+	h.generation++
+	h.reconnects++
+	return nil
+}
+
+// Ping checks the default handle. See Handle.Ping.
+func Ping(ctx context.Context) error {
+	if std == nil {
+		return ErrNotConnected
+	}
+	return std.Ping(ctx)
+}
+
+// Ping checks that the handle's connection works and that the file it is
+// connected to is still the database file. Problems found are put right at
+// the next transaction boundary.
+func (h *Handle) Ping(ctx context.Context) error {
+	if h.tx == nil {
+		return ErrNoTransaction
+	}
+	if err := h.conn.PingContext(ctx); err != nil {
+		h.noteError(err)
+		return err
+	}
+	var n int
+	if err := h.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_schema").Scan(&n); err != nil {
+		return err
+	}
+	if h.replaced() {
+		return ErrDatabaseReplaced
+	}
+	return nil
+}
+
+// Uncommitted reports whether the auto-transaction has writes that haven't
+// been committed.
+func (h *Handle) Uncommitted() bool {
+	return h.dirty
+}
+
+// Health describes the state of a handle, for daemons to report.
+type Health struct {
+	File        string `json:"file"`
+	Mode        string `json:"mode"`
+	OK          bool   `json:"ok"`
+	Error       string `json:"error,omitempty"`
+	Uncommitted bool   `json:"uncommitted"` // Auto-transaction has writes
+	Reconnects  int    `json:"reconnects"`
+}
+
+// HealthCheck reports on the default handle. See Handle.HealthCheck.
+func HealthCheck(ctx context.Context) Health {
+	if std == nil {
+		return Health{Error: ErrNotConnected.Error()}
+	}
+	return std.HealthCheck(ctx)
+}
+
+// HealthCheck pings the handle and reports its state.
+func (h *Handle) HealthCheck(ctx context.Context) Health {
+	health := Health{
+		File:        h.file,
+		Mode:        h.mode,
+		Uncommitted: h.dirty,
+		Reconnects:  h.reconnects,
+	}
+	if err := h.Ping(ctx); err != nil {
+		health.Error = err.Error()
+	} else {
+		health.OK = true
+	}
+	return health
+}
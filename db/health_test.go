@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// otherBackup returns a backup of a database holding only the table "other".
+func otherBackup(t *testing.T) string {
+	other, err := Open(t.TempDir(), false)
+	require.NoError(t, err)
+	_, err = other.Exec("CREATE TABLE other (name TEXT)")
+	require.NoError(t, err)
+	require.NoError(t, other.Commit())
+	backup := filepath.Join(t.TempDir(), "backup.sqlite")
+	require.NoError(t, other.Backup(context.Background(), backup))
+	require.NoError(t, other.Close())
+	return backup
+}
+
+// replaceDatabase restores a database holding only the table "other" over
+// dir's database file, as ibbackup restore would.
+func replaceDatabase(t *testing.T, dir string) {
+	require.NoError(t, Restore(context.Background(), otherBackup(t), dir))
+}
+
+// clobberDatabase renames a database holding only the table "other" over dir's
+// database file, as someone copying a backup into place by hand might, even
+// though the file is being written to.
+func clobberDatabase(t *testing.T, dir string) {
+	dbFile := filepath.Join(dir, "ibgames.sqlite")
+	require.NoError(t, os.Remove(dbFile+"-wal"))
+	require.NoError(t, os.Remove(dbFile+"-shm"))
+	require.NoError(t, os.Rename(otherBackup(t), dbFile))
+}
+
+func tableExists(t *testing.T, h *Handle, name string) bool {
+	var n int
+	err := h.QueryRow("SELECT COUNT(*) FROM sqlite_schema WHERE name = ?", name).Scan(&n)
+	require.NoError(t, err)
+	return n > 0
+}
+
+func TestReconnect(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T) (*Handle, string) {
+		dir := t.TempDir()
+		h, err := Open(dir, false)
+		require.NoError(t, err)
+		t.Cleanup(h.Abandon)
+		_, err = h.Exec("CREATE TABLE test (name TEXT)")
+		require.NoError(t, err)
+		require.NoError(t, h.Commit())
+		return h, dir
+	}
+
+	t.Run("replaced file is picked up at commit", func(t *testing.T) {
+		h, dir := setup(t)
+		stmt, err := h.Prepare("SELECT COUNT(*) FROM sqlite_schema WHERE name = 'other'")
+		require.NoError(t, err)
+		defer stmt.Close()
+
+		require.NoError(t, h.Ping(ctx))
+		replaceDatabase(t, dir)
+		assert.ErrorIs(t, h.Ping(ctx), ErrDatabaseReplaced)
+
+		require.NoError(t, h.Commit())
+		assert.True(t, tableExists(t, h, "other"))
+		assert.False(t, tableExists(t, h, "test"))
+		require.NoError(t, h.Ping(ctx))
+
+		// Prepared statements follow the handle to the new connection.
+		var n int
+		require.NoError(t, stmt.QueryRow().Scan(&n))
+		assert.Equal(t, 1, n)
+
+		health := h.HealthCheck(ctx)
+		assert.True(t, health.OK)
+		assert.Equal(t, 1, health.Reconnects)
+	})
+
+	t.Run("uncommitted work is never dropped", func(t *testing.T) {
+		h, dir := setup(t)
+		_, err := h.Exec("INSERT INTO test (name) VALUES ('precious')")
+		require.NoError(t, err)
+
+		clobberDatabase(t, dir)
+		assert.ErrorIs(t, h.Commit(), ErrDatabaseReplaced)
+		assert.ErrorIs(t, h.Close(), ErrDatabaseReplaced)
+
+		health := h.HealthCheck(ctx)
+		assert.False(t, health.OK)
+		assert.True(t, health.Uncommitted)
+		assert.Contains(t, health.Error, "replaced")
+
+		// Rolling back is the caller's decision.
+		require.NoError(t, h.Rollback())
+		assert.True(t, tableExists(t, h, "other"))
+		assert.False(t, h.HealthCheck(ctx).Uncommitted)
+	})
+
+	t.Run("broken connection is replaced at rollback", func(t *testing.T) {
+		h, _ := setup(t)
+		h.broken = true
+		require.NoError(t, h.Rollback())
+		assert.False(t, h.broken)
+		assert.Equal(t, 1, h.reconnects)
+		assert.True(t, tableExists(t, h, "test"))
+	})
+
+	t.Run("rollback recovers from a failed commit", func(t *testing.T) {
+		h, _ := setup(t)
+		_, err := h.Exec("INSERT INTO test (name) VALUES ('one')")
+		require.NoError(t, err)
+		require.NoError(t, h.tx.Commit()) // Leaves h.tx finished
+		require.NoError(t, h.Rollback())
+
+		_, err = h.Exec("INSERT INTO test (name) VALUES ('two')")
+		require.NoError(t, err)
+		require.NoError(t, h.Commit())
+	})
+}
+
+func TestNoTransaction(t *testing.T) {
+	ctx := context.Background()
+	h := openTestHandle(t)
+	_, err := h.Exec("CREATE TABLE test (name TEXT)")
+	require.NoError(t, err)
+	require.NoError(t, h.Commit())
+	stmt, err := h.Prepare("INSERT INTO test (name) VALUES (?)")
+	require.NoError(t, err)
+	defer stmt.Close()
+
+	// As if the last reconnection had failed.
+	require.NoError(t, h.tx.Rollback())
+	h.tx = nil
+
+	_, err = stmt.Exec("autocommitted")
+	require.ErrorIs(t, err, ErrNoTransaction)
+	_, err = h.Exec("INSERT INTO test (name) VALUES ('autocommitted')")
+	require.ErrorIs(t, err, ErrNoTransaction)
+	_, err = h.Query("SELECT name FROM test")
+	require.ErrorIs(t, err, ErrNoTransaction)
+	var name string
+	require.ErrorIs(t, h.QueryRow("SELECT name FROM test").Scan(&name), ErrNoTransaction)
+	require.ErrorIs(t, h.QueryRow("SELECT name FROM test").Err(), ErrNoTransaction)
+	require.ErrorIs(t, stmt.QueryRow("autocommitted").Err(), ErrNoTransaction)
+	require.ErrorIs(t, h.Savepoint("nothing"), ErrNoTransaction)
+	_, err = h.SchemaVersion(ctx)
+	require.ErrorIs(t, err, ErrNoTransaction)
+	_, err = h.IntegrityCheck(ctx)
+	require.ErrorIs(t, err, ErrNoTransaction)
+	_, err = h.Migrate(ctx)
+	require.ErrorIs(t, err, ErrNoTransaction)
+	require.ErrorIs(t, h.CreateSchema(ctx), ErrNoTransaction)
+
+	require.NoError(t, h.Rollback())
+	var n int
+	require.NoError(t, h.QueryRow("SELECT COUNT(*) FROM test").Scan(&n))
+	assert.Zero(t, n)
+}
+
+func TestPing(t *testing.T) {
+	ctx := context.Background()
+
+	Exit()
+	assert.ErrorIs(t, Ping(ctx), ErrNotConnected)
+	assert.False(t, HealthCheck(ctx).OK)
+
+	setupTestDB(t)
+	require.NoError(t, Connect(false))
+	require.NoError(t, Ping(ctx))
+	health := HealthCheck(ctx)
+	assert.True(t, health.OK)
+	assert.Equal(t, "rwc", health.Mode)
+}
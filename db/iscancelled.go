@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 
 	"github.com/nosborn/ibgames-1999"
@@ -9,14 +10,38 @@ import (
 // IsCancelled checks an account for cancellation. Returns 1 if cancelled, 0 if
 // not cancelled and -1 on error occurs. Non-existent accounts are assumed to
 // be cancelled.
+//
+// Deprecated: Use accounts.GetStatus, which tells missing accounts from
+// cancelled ones and reports suspensions.
 func IsCancelled(uid ibgames.AccountID) int {
+	return std.IsCancelled(uid)
+}
+
+// IsCancelledContext is like IsCancelled but uses ctx for the query.
+//
+// Deprecated: Use accounts.GetStatus.
+func IsCancelledContext(ctx context.Context, uid ibgames.AccountID) int {
+	return std.IsCancelledContext(ctx, uid)
+}
+
+// IsCancelled is like the package-level IsCancelled but uses h.
+//
+// Deprecated: Use accounts.GetStatus.
+func (h *Handle) IsCancelled(uid ibgames.AccountID) int {
+	return h.IsCancelledContext(context.Background(), uid)
+}
+
+// IsCancelledContext is like IsCancelled but uses ctx for the query.
+//
+// Deprecated: Use accounts.GetStatus.
+func (h *Handle) IsCancelledContext(ctx context.Context, uid ibgames.AccountID) int {
 	const query = `
 		SELECT status
 		FROM accounts
 		WHERE uid = ?`
 
 	var status string
-	err := tx.QueryRow(query, uid).Scan(&status)
+	err := h.QueryRowContext(ctx, query, uid).Scan(&status)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return 1
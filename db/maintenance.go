@@ -0,0 +1,304 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrMaintenanceLocked is returned by Maintenance.Pass when another process is
+// already maintaining the database.
+var ErrMaintenanceLocked = errors.New("database maintenance is running in another process")
+
+// CheckpointMode is the mode of a WAL checkpoint, as for PRAGMA wal_checkpoint.
+type CheckpointMode string
+
+const (
+	CheckpointPassive  CheckpointMode = "PASSIVE"  // Copy what it can without waiting
+	CheckpointFull     CheckpointMode = "FULL"     // Wait for writers, then copy everything
+	CheckpointRestart  CheckpointMode = "RESTART"  // FULL, then wait for readers so the WAL restarts
+	CheckpointTruncate CheckpointMode = "TRUNCATE" // RESTART, then truncate the WAL to nothing
+)
+
+// CheckpointResult is the outcome of a checkpoint.
+type CheckpointResult struct {
+	Busy         bool // Couldn't complete because of other connections
+	WALFrames    int  // Frames in the WAL, -1 if unknown
+	Checkpointed int  // Frames copied into the database, -1 if unknown
+}
+
+// Maintenance performs housekeeping on a database from a connection of its
+// own, so that it can run alongside the programs using the database.
+type Maintenance struct {
+	db       *sql.DB
+	file     string
+	lockFile string // Held during a pass; records when tasks last ran
+}
+
+// OpenMaintenance opens the accounts database in directory dbPath for
+// maintenance.
+func OpenMaintenance(ctx context.Context, dbPath string) (*Maintenance, error) {
+	file := filepath.Join(dbPath, "ibgames.sqlite")
+	if _, err := os.Stat(file); err != nil {
+		return nil, err
+	}
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", file)
+	sqlDB, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := sqlDB.PingContext(ctx); err != nil {
+		_ = sqlDB.Close()
+		return nil, err
+	}
+	return &Maintenance{db: sqlDB, file: file, lockFile: file + ".maint"}, nil
+}
+
+// Close closes the maintenance connection.
+func (m *Maintenance) Close() error {
+	return m.db.Close()
+}
+
+// Checkpoint copies the WAL into the database file.
+func (m *Maintenance) Checkpoint(ctx context.Context, mode CheckpointMode) (CheckpointResult, error) {
+	switch mode {
+	case CheckpointPassive, CheckpointFull, CheckpointRestart, CheckpointTruncate:
+	default:
+		return CheckpointResult{}, fmt.Errorf("bad checkpoint mode %q", mode)
+	}
+	var busy int
+	var result CheckpointResult
+	err := m.db.QueryRowContext(ctx, "PRAGMA wal_checkpoint("+string(mode)+")").
+		Scan(&busy, &result.WALFrames, &result.Checkpointed)
+	result.Busy = busy != 0
+	return result, err
+}
+
+// Analyze gathers the statistics the query planner relies on. They matter
+// more than usual because automatic indexes are turned off.
+func (m *Maintenance) Analyze(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, "ANALYZE")
+	return err
+}
+
+// EnableIncrementalVacuum switches the database to incremental auto-vacuum.
+// This rebuilds the whole file with VACUUM, which needs exclusive access, so
+// it should be done once while nothing else is using the database.
+func (m *Maintenance) EnableIncrementalVacuum(ctx context.Context) error {
+	if _, err := m.db.ExecContext(ctx, "PRAGMA auto_vacuum = INCREMENTAL"); err != nil {
+		return err
+	}
+	_, err := m.db.ExecContext(ctx, "VACUUM")
+	return err
+}
+
+// IncrementalVacuum returns up to pages free pages to the file system, or
+// all of them if pages isn't positive, and returns how many were freed. It
+// does nothing unless incremental auto-vacuum has been enabled.
+func (m *Maintenance) IncrementalVacuum(ctx context.Context, pages int) (int, error) {
+	var before, after int
+	if err := m.db.QueryRowContext(ctx, "PRAGMA freelist_count").Scan(&before); err != nil {
+		return 0, err
+	}
+	// PRAGMA doesn't take parameters. Each step of the statement frees one
+	// page, so all its rows must be read.
+	rows, err := m.db.QueryContext(ctx, fmt.Sprintf("PRAGMA incremental_vacuum(%d)", max(pages, 0)))
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	if err := m.db.QueryRowContext(ctx, "PRAGMA freelist_count").Scan(&after); err != nil {
+		return 0, err
+	}
+	return before - after, nil
+}
+
+// WALSize returns the size of the database's -wal file in bytes.
+func (m *Maintenance) WALSize() (int64, error) {
+	info, err := os.Stat(m.file + "-wal")
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// lock takes the host-wide maintenance lock without waiting, returning
+// ErrMaintenanceLocked if another process holds it. Closing the file releases
+// the lock.
+func (m *Maintenance) lock() (*os.File, error) {
+	f, err := os.OpenFile(m.lockFile, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		_ = f.Close()
+		if errors.Is(err, unix.EWOULDBLOCK) {
+			return nil, ErrMaintenanceLocked
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// maintenanceState records when the periodic tasks last ran. It is kept in the
+// lock file, so that every process maintaining the database shares it.
+type maintenanceState struct {
+	LastAnalyze time.Time `json:"last_analyze"`
+	LastVacuum  time.Time `json:"last_vacuum"`
+}
+
+// readState reads the state from the locked file f. A new or unreadable file
+// gives the zero state, so every task is due.
+func readState(f *os.File) maintenanceState {
+	var state maintenanceState
+	data, err := io.ReadAll(io.NewSectionReader(f, 0, math.MaxInt64))
+	if err == nil && len(data) > 0 {
+		if err := json.Unmarshal(data, &state); err != nil {
+			log.Printf("Database maintenance: %s: %v", f.Name(), err)
+			state = maintenanceState{}
+		}
+	}
+	return state
+}
+
+// writeState replaces the state in the locked file f.
+func writeState(f *os.File, state maintenanceState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err = f.WriteAt(append(data, '\n'), 0)
+	return err
+}
+
+// Schedule says what Pass and Run do. Zero intervals and sizes turn the
+// corresponding task off.
+type Schedule struct {
+	Interval          time.Duration // Time between passes, for Run
+	CheckpointPassive bool          // Passive checkpoint on every pass
+	TruncateWALSize   int64         // Truncate the WAL once it is this big
+	WarnWALSize       int64         // Log a warning if the WAL is still this big
+	AnalyzeInterval   time.Duration // Time between ANALYZEs
+	VacuumInterval    time.Duration // Time between incremental vacuums
+	VacuumPages       int           // Pages freed by each vacuum, 0 for all
+}
+
+// PassReport describes what a pass did.
+type PassReport struct {
+	Checkpoint *CheckpointResult // Nil if no checkpoint was done
+	Truncated  bool              // The checkpoint was TRUNCATE
+	Analyzed   bool
+	Vacuumed   int   // Pages freed
+	WALSize    int64 // Size of the WAL after the pass
+}
+
+// Pass performs whichever maintenance tasks in s are due. Only one process on
+// the host performs maintenance at a time: if another is already doing so, Pass
+// returns ErrMaintenanceLocked and does nothing. When ANALYZE and vacuum last
+// ran is kept with the lock, so they are due by the same clock whichever
+// process makes the pass.
+func (m *Maintenance) Pass(ctx context.Context, s Schedule) (PassReport, error) {
+	var report PassReport
+
+	f, err := m.lock()
+	if err != nil {
+		return report, err
+	}
+	defer f.Close()
+
+	state := readState(f)
+	now := time.Now()
+	if s.AnalyzeInterval > 0 && now.Sub(state.LastAnalyze) >= s.AnalyzeInterval {
+		if err := m.Analyze(ctx); err != nil {
+			return report, err
+		}
+		state.LastAnalyze = now
+		if err := writeState(f, state); err != nil {
+			return report, err
+		}
+		report.Analyzed = true
+	}
+	if s.VacuumInterval > 0 && now.Sub(state.LastVacuum) >= s.VacuumInterval {
+		if report.Vacuumed, err = m.IncrementalVacuum(ctx, s.VacuumPages); err != nil {
+			return report, err
+		}
+		state.LastVacuum = now
+		if err := writeState(f, state); err != nil {
+			return report, err
+		}
+	}
+
+	// Checkpoint last, to include anything written above.
+	walSize, err := m.WALSize()
+	if err != nil {
+		return report, err
+	}
+	mode := CheckpointMode("")
+	switch {
+	case s.TruncateWALSize > 0 && walSize >= s.TruncateWALSize:
+		mode = CheckpointTruncate
+	case s.CheckpointPassive:
+		mode = CheckpointPassive
+	}
+	if mode != "" {
+		result, err := m.Checkpoint(ctx, mode)
+		if err != nil {
+			return report, err
+		}
+		report.Checkpoint = &result
+		report.Truncated = mode == CheckpointTruncate && !result.Busy
+	}
+
+	if report.WALSize, err = m.WALSize(); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// Run performs a pass every s.Interval until ctx is done. Errors are logged
+// and don't stop later passes. A pass skipped because another process is
+// maintaining the database isn't an error.
+func (m *Maintenance) Run(ctx context.Context, s Schedule) error {
+	if s.Interval <= 0 {
+		return fmt.Errorf("bad maintenance interval %v", s.Interval)
+	}
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		report, err := m.Pass(ctx, s)
+		switch {
+		case errors.Is(err, ErrMaintenanceLocked):
+		case err != nil:
+			log.Printf("Database maintenance: %v", err)
+		case s.WarnWALSize > 0 && report.WALSize >= s.WarnWALSize:
+			log.Printf("Database maintenance: %s-wal is %d bytes", m.file, report.WALSize)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
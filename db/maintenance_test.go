@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupMaintenanceTest(t *testing.T) (*Handle, *Maintenance) {
+	dir := t.TempDir()
+	h, err := Open(dir, false)
+	require.NoError(t, err)
+	t.Cleanup(h.Abandon)
+	_, err = h.Exec("CREATE TABLE test (name TEXT)")
+	require.NoError(t, err)
+	require.NoError(t, h.Commit())
+
+	m, err := OpenMaintenance(context.Background(), dir)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = m.Close() })
+	return h, m
+}
+
+func fillTable(t *testing.T, h *Handle, rows int) {
+	for range rows {
+		_, err := h.Exec("INSERT INTO test (name) VALUES (?)", string(make([]byte, 1000)))
+		require.NoError(t, err)
+	}
+	require.NoError(t, h.Commit())
+}
+
+func TestMaintenance(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("checkpoints", func(t *testing.T) {
+		h, m := setupMaintenanceTest(t)
+		fillTable(t, h, 100)
+
+		size, err := m.WALSize()
+		require.NoError(t, err)
+		assert.Positive(t, size)
+
+		result, err := m.Checkpoint(ctx, CheckpointPassive)
+		require.NoError(t, err)
+		assert.False(t, result.Busy)
+		assert.Equal(t, result.WALFrames, result.Checkpointed)
+
+		require.NoError(t, h.Close())
+		result, err = m.Checkpoint(ctx, CheckpointTruncate)
+		require.NoError(t, err)
+		assert.False(t, result.Busy)
+		size, err = m.WALSize()
+		require.NoError(t, err)
+		assert.Zero(t, size)
+
+		_, err = m.Checkpoint(ctx, "SOMETIMES")
+		assert.Error(t, err)
+	})
+
+	t.Run("analyze", func(t *testing.T) {
+		h, m := setupMaintenanceTest(t)
+		_, err := h.Exec("CREATE INDEX test_idx ON test (name)")
+		require.NoError(t, err)
+		fillTable(t, h, 10)
+
+		require.NoError(t, m.Analyze(ctx))
+		var n int
+		require.NoError(t, h.QueryRow("SELECT COUNT(*) FROM sqlite_stat1").Scan(&n))
+		assert.Positive(t, n)
+	})
+
+	t.Run("incremental vacuum", func(t *testing.T) {
+		h, m := setupMaintenanceTest(t)
+		fillTable(t, h, 100)
+		_, err := h.Exec("DELETE FROM test")
+		require.NoError(t, err)
+		require.NoError(t, h.Commit())
+
+		// Without incremental auto-vacuum nothing happens.
+		freed, err := m.IncrementalVacuum(ctx, 0)
+		require.NoError(t, err)
+		assert.Zero(t, freed)
+
+		require.NoError(t, h.Close())
+		require.NoError(t, m.EnableIncrementalVacuum(ctx))
+
+		h, err = Open(filepath.Dir(m.file), false)
+		require.NoError(t, err)
+		defer h.Abandon()
+		fillTable(t, h, 100)
+		_, err = h.Exec("DELETE FROM test")
+		require.NoError(t, err)
+		require.NoError(t, h.Commit())
+
+		freed, err = m.IncrementalVacuum(ctx, 5)
+		require.NoError(t, err)
+		assert.Equal(t, 5, freed)
+		freed, err = m.IncrementalVacuum(ctx, 0)
+		require.NoError(t, err)
+		assert.Positive(t, freed)
+	})
+
+	t.Run("one process at a time", func(t *testing.T) {
+		_, m := setupMaintenanceTest(t)
+		f, err := m.lock()
+		require.NoError(t, err)
+
+		// flock locks belong to the open file, so a second open of the
+		// lock file conflicts just as another process would.
+		_, err = m.Pass(ctx, Schedule{CheckpointPassive: true})
+		assert.ErrorIs(t, err, ErrMaintenanceLocked)
+
+		require.NoError(t, f.Close())
+		_, err = m.Pass(ctx, Schedule{CheckpointPassive: true})
+		assert.NoError(t, err)
+	})
+
+	t.Run("pass runs due tasks", func(t *testing.T) {
+		h, m := setupMaintenanceTest(t)
+		fillTable(t, h, 100)
+		require.NoError(t, h.Close())
+
+		s := Schedule{
+			TruncateWALSize: 1,
+			AnalyzeInterval: time.Hour,
+			VacuumInterval:  time.Hour,
+		}
+		report, err := m.Pass(ctx, s)
+		require.NoError(t, err)
+		require.NotNil(t, report.Checkpoint)
+		assert.True(t, report.Truncated)
+		assert.True(t, report.Analyzed)
+		assert.Zero(t, report.WALSize)
+
+		// Nothing is due the second time round.
+		report, err = m.Pass(ctx, s)
+		require.NoError(t, err)
+		assert.Nil(t, report.Checkpoint)
+		assert.False(t, report.Analyzed)
+	})
+
+	t.Run("tasks are due by the same clock in every process", func(t *testing.T) {
+		_, m1 := setupMaintenanceTest(t)
+		m2, err := OpenMaintenance(ctx, filepath.Dir(m1.file))
+		require.NoError(t, err)
+		defer m2.Close()
+
+		s := Schedule{AnalyzeInterval: time.Hour, VacuumInterval: time.Hour}
+		report, err := m1.Pass(ctx, s)
+		require.NoError(t, err)
+		assert.True(t, report.Analyzed)
+
+		report, err = m2.Pass(ctx, s)
+		require.NoError(t, err)
+		assert.False(t, report.Analyzed)
+
+		// Once the interval has passed, whichever process comes next does
+		// the work.
+		s.AnalyzeInterval = time.Nanosecond
+		report, err = m2.Pass(ctx, s)
+		require.NoError(t, err)
+		assert.True(t, report.Analyzed)
+	})
+
+	t.Run("run stops with context", func(t *testing.T) {
+		_, m := setupMaintenanceTest(t)
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		err := m.Run(ctx, Schedule{Interval: 10 * time.Millisecond, CheckpointPassive: true})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		assert.Error(t, m.Run(ctx, Schedule{}))
+	})
+}
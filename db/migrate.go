@@ -0,0 +1,174 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// ErrSchemaTooNew is returned when the database has been migrated by a newer
+// program than this one.
+var ErrSchemaTooNew = errors.New("database schema is newer than this program")
+
+// Migration is one step in the evolution of the database schema. Migrations
+// are embedded from db/migrations, where each file is named NNNN_name.sql and
+// NNNN is the schema version it produces. The schema version is kept in
+// PRAGMA user_version.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Migrations returns every known migration in version order.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(entries))
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		prefix, _, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: bad file name", entry.Name())
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: bad version", entry.Name())
+		}
+		sql, err := fs.ReadFile(migrationFiles, "migrations/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{
+			Version: version,
+			Name:    name,
+			SQL:     string(sql),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %s: expected version %d", m.Name, i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// LatestVersion returns the schema version produced by the last migration.
+func LatestVersion() (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	return len(migrations), nil
+}
+
+// SchemaVersion returns the schema version of the default database.
+func SchemaVersion(ctx context.Context) (int, error) {
+	return std.SchemaVersion(ctx)
+}
+
+// SchemaVersion returns the schema version of the database.
+func (h *Handle) SchemaVersion(ctx context.Context) (int, error) {
+	if _, err := h.transaction(); err != nil {
+		return 0, err // Don't report a version from outside the transaction.
+	}
+	var version int
+	err := h.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+// PendingMigrations returns the migrations that Migrate would apply to the
+// default database.
+func PendingMigrations(ctx context.Context) ([]Migration, error) {
+	return std.PendingMigrations(ctx)
+}
+
+// PendingMigrations returns the migrations that Migrate would apply, or
+// ErrSchemaTooNew if the database is ahead of this program.
+func (h *Handle) PendingMigrations(ctx context.Context) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	version, err := h.SchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if version > len(migrations) {
+		return nil, fmt.Errorf("%w (version %d, expected at most %d)", ErrSchemaTooNew, version, len(migrations))
+	}
+	return migrations[version:], nil
+}
+
+// Migrate brings the default database schema up to date.
+func Migrate(ctx context.Context) (int, error) {
+	return std.Migrate(ctx)
+}
+
+// Migrate applies any pending migrations and returns how many were applied.
+// Each migration runs in a transaction of its own together with the update to
+// the schema version, so a failure leaves the database at the last version
+// that succeeded.
+//
+// Migrate must be called at a transaction boundary, typically straight after
+// connecting, because it commits the auto-transaction.
+func (h *Handle) Migrate(ctx context.Context) (int, error) {
+	pending, err := h.PendingMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, m := range pending {
+		if _, err := h.ExecContext(ctx, m.SQL); err != nil {
+			_ = h.Rollback()
+			return i, fmt.Errorf("migration %s: %w", m.Name, err)
+		}
+		// PRAGMA doesn't take parameters.
+		if _, err := h.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", m.Version)); err != nil {
+			_ = h.Rollback()
+			return i, fmt.Errorf("migration %s: %w", m.Name, err)
+		}
+		if err := h.CommitContext(ctx); err != nil {
+			_ = h.Rollback()
+			return i, fmt.Errorf("migration %s: %w", m.Name, err)
+		}
+	}
+	return len(pending), nil
+}
+
+// MigrateDryRun writes the SQL that Migrate would run on the default database
+// to w.
+func MigrateDryRun(ctx context.Context, w io.Writer) error {
+	return std.MigrateDryRun(ctx, w)
+}
+
+// MigrateDryRun writes the SQL that Migrate would run to w without changing
+// the database.
+func (h *Handle) MigrateDryRun(ctx context.Context, w io.Writer) error {
+	pending, err := h.PendingMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range pending {
+		if _, err := fmt.Fprintf(w, "-- Migration %s\n\n%s\nPRAGMA user_version = %d;\n\n", m.Name, m.SQL, m.Version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
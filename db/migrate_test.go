@@ -0,0 +1,101 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version)
+		assert.NotEmpty(t, m.SQL)
+	}
+	assert.Equal(t, "0001_baseline", migrations[0].Name)
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	latest, err := LatestVersion()
+	require.NoError(t, err)
+
+	t.Run("migrates empty database", func(t *testing.T) {
+		h := openTestHandle(t)
+
+		version, err := h.SchemaVersion(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, version)
+
+		applied, err := h.Migrate(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, latest, applied)
+
+		version, err = h.SchemaVersion(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, latest, version)
+
+		_, err = h.Exec("SELECT uid FROM accounts")
+		require.NoError(t, err)
+
+		// Nothing more to do.
+		applied, err = h.Migrate(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, applied)
+	})
+
+	t.Run("refuses newer schema", func(t *testing.T) {
+		h := openTestHandle(t)
+
+		_, err := h.Exec("PRAGMA user_version = 9999")
+		require.NoError(t, err)
+		require.NoError(t, h.Commit())
+
+		_, err = h.Migrate(ctx)
+		require.ErrorIs(t, err, ErrSchemaTooNew)
+
+		err = h.MigrateDryRun(ctx, &bytes.Buffer{})
+		require.ErrorIs(t, err, ErrSchemaTooNew)
+	})
+
+	t.Run("dry run shows pending SQL without applying it", func(t *testing.T) {
+		h := openTestHandle(t)
+
+		var buf bytes.Buffer
+		require.NoError(t, h.MigrateDryRun(ctx, &buf))
+		assert.Contains(t, buf.String(), "-- Migration 0001_baseline")
+		assert.Contains(t, buf.String(), "CREATE TABLE IF NOT EXISTS accounts")
+		assert.Contains(t, buf.String(), "PRAGMA user_version = 1;")
+
+		version, err := h.SchemaVersion(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, version)
+
+		_, err = h.Exec("SELECT uid FROM accounts")
+		require.Error(t, err)
+	})
+
+	t.Run("package functions use default handle", func(t *testing.T) {
+		setupTestDB(t)
+		require.NoError(t, Connect(false))
+
+		pending, err := PendingMigrations(ctx)
+		require.NoError(t, err)
+		assert.Len(t, pending, latest)
+
+		_, err = Migrate(ctx)
+		require.NoError(t, err)
+
+		version, err := SchemaVersion(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, latest, version)
+
+		require.NoError(t, Disconnect())
+	})
+}
@@ -0,0 +1,4 @@
+-- Why an account was suspended or cancelled, shown to the player and to
+-- administrators.
+
+ALTER TABLE accounts ADD COLUMN status_reason TEXT; -- CHAR(80)
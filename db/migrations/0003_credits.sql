@@ -0,0 +1,30 @@
+-- Purchases of minutes. Each row adds its minutes to accounts.minutes.
+
+CREATE TABLE IF NOT EXISTS credits (
+    cid INTEGER PRIMARY KEY AUTOINCREMENT, -- SERIAL NOT NULL
+    uid INTEGER NOT NULL,
+    credited TEXT DEFAULT CURRENT_TIMESTAMP, -- DATETIME YEAR TO MINUTE DEFAULT CURRENT YEAR TO MINUTE
+    minutes INTEGER NOT NULL,
+    price INTEGER NOT NULL, -- MONEY(8,2) held in minor units
+    currency TEXT NOT NULL, -- CHAR(3)
+    method TEXT NOT NULL, -- CHAR(1)
+    reference TEXT, -- CHAR(32)
+    admin_uid INT,
+
+    CHECK (cid <= 2147483647), -- int32 max value
+    CHECK (method IN ('A' ,'C' ,'K' )),
+    CHECK (minutes > 0),
+    CHECK (price >= 0),
+
+    FOREIGN KEY (admin_uid) REFERENCES accounts(uid),
+    FOREIGN KEY (uid) REFERENCES accounts(uid)
+) STRICT;
+
+CREATE INDEX IF NOT EXISTS cr_uid_idx ON credits (uid);
+
+CREATE TRIGGER IF NOT EXISTS prevent_cid_overflow
+BEFORE INSERT ON credits
+WHEN (SELECT seq FROM sqlite_sequence WHERE name = 'credits') >= 2147483647
+BEGIN
+    SELECT RAISE(FAIL, 'CID limit reached');
+END;
@@ -0,0 +1,26 @@
+-- Exchange rates and price lists, so that customers can pay in their own
+-- currency. Credits also record what they were worth in the base currency.
+
+CREATE TABLE IF NOT EXISTS exchange_rate (
+    currency TEXT NOT NULL, -- CHAR(3)
+    effective TEXT NOT NULL, -- DATE
+    rate TEXT NOT NULL, -- DECIMAL(20,12), base currency per unit of currency
+
+    PRIMARY KEY (currency, effective)
+) STRICT;
+
+CREATE TABLE IF NOT EXISTS price_list (
+    product INTEGER NOT NULL, -- SMALLINT
+    currency TEXT NOT NULL, -- CHAR(3)
+    minutes INTEGER NOT NULL,
+    effective TEXT NOT NULL, -- DATE
+    price INTEGER NOT NULL, -- MONEY(8,2) held in minor units
+
+    CHECK (minutes > 0),
+    CHECK (price >= 0),
+    CHECK (product >= 0),
+
+    PRIMARY KEY (product, currency, minutes, effective)
+) STRICT;
+
+ALTER TABLE credits ADD COLUMN base_price INTEGER; -- MONEY(8,2) held in minor units of the base currency
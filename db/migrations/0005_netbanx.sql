@@ -0,0 +1,36 @@
+-- Card payments taken through the Netbanx gateway. A row is written before
+-- the gateway is called, so a payment whose outcome wasn't heard is left
+-- pending rather than forgotten.
+
+CREATE TABLE IF NOT EXISTS netbanx (
+    nid INTEGER PRIMARY KEY AUTOINCREMENT, -- SERIAL NOT NULL
+    idempotency_key TEXT NOT NULL, -- CHAR(32)
+    uid INTEGER NOT NULL,
+    operation TEXT NOT NULL, -- CHAR(1)
+    amount INTEGER NOT NULL, -- MONEY(8,2) held in minor units
+    currency TEXT NOT NULL, -- CHAR(3)
+    minutes INTEGER, -- Credited when a capture is approved
+    card_last4 TEXT, -- CHAR(4)
+    parent_id TEXT, -- CHAR(36)
+    txn_id TEXT, -- CHAR(36)
+    status TEXT DEFAULT "P", -- CHAR(1)
+    code TEXT, -- CHAR(8)
+    message TEXT, -- CHAR(80)
+    created TEXT DEFAULT CURRENT_TIMESTAMP, -- DATETIME YEAR TO SECOND DEFAULT CURRENT YEAR TO SECOND
+    updated TEXT DEFAULT CURRENT_TIMESTAMP, -- DATETIME YEAR TO SECOND DEFAULT CURRENT YEAR TO SECOND
+    cid INT,
+
+    UNIQUE (idempotency_key),
+
+    CHECK (amount > 0),
+    CHECK (minutes > 0),
+    CHECK (nid <= 2147483647), -- int32 max value
+    CHECK (operation IN ('A' ,'C' ,'R' )),
+    CHECK (status IN ('A' ,'D' ,'P' )),
+
+    FOREIGN KEY (cid) REFERENCES credits(cid),
+    FOREIGN KEY (uid) REFERENCES accounts(uid)
+) STRICT;
+
+CREATE INDEX IF NOT EXISTS nb_txn_id_idx ON netbanx (txn_id);
+CREATE INDEX IF NOT EXISTS nb_uid_idx ON netbanx (uid);
@@ -0,0 +1,47 @@
+-- Checks received by post, and the bank accounts they are drawn on. A check
+-- is credited when it clears, and the credit is reversed if it bounces.
+
+CREATE TABLE IF NOT EXISTS bank_accounts (
+    bid INTEGER PRIMARY KEY AUTOINCREMENT, -- SERIAL NOT NULL
+    uid INTEGER NOT NULL,
+    routing TEXT NOT NULL, -- CHAR(9)
+    account TEXT NOT NULL, -- CHAR(17)
+    holder TEXT, -- CHAR(48)
+    added TEXT DEFAULT CURRENT_DATE, -- DATE DEFAULT TODAY
+
+    UNIQUE (uid, routing, account),
+
+    CHECK (bid <= 2147483647), -- int32 max value
+
+    FOREIGN KEY (uid) REFERENCES accounts(uid)
+) STRICT;
+
+CREATE TABLE IF NOT EXISTS checks (
+    chid INTEGER PRIMARY KEY AUTOINCREMENT, -- SERIAL NOT NULL
+    uid INTEGER NOT NULL,
+    bid INT,
+    check_number TEXT, -- CHAR(16)
+    amount INTEGER NOT NULL, -- MONEY(8,2) held in minor units
+    currency TEXT NOT NULL, -- CHAR(3)
+    minutes INTEGER NOT NULL,
+    received TEXT DEFAULT CURRENT_DATE, -- DATE DEFAULT TODAY
+    status TEXT DEFAULT "R", -- CHAR(1)
+    settled TEXT, -- DATE
+    cid INT,
+    admin_uid INT,
+
+    CHECK (amount > 0),
+    CHECK (chid <= 2147483647), -- int32 max value
+    CHECK (minutes > 0),
+    CHECK (status IN ('B' ,'C' ,'R' )),
+
+    FOREIGN KEY (admin_uid) REFERENCES accounts(uid),
+    FOREIGN KEY (bid) REFERENCES bank_accounts(bid),
+    FOREIGN KEY (cid) REFERENCES credits(cid),
+    FOREIGN KEY (uid) REFERENCES accounts(uid)
+) STRICT;
+
+CREATE INDEX IF NOT EXISTS ck_status_idx ON checks (status);
+CREATE INDEX IF NOT EXISTS ck_uid_idx ON checks (uid);
+
+ALTER TABLE credits ADD COLUMN reversed TEXT; -- DATETIME YEAR TO SECOND
@@ -0,0 +1,5 @@
+-- Administrators are identified by their own account, as in the admin_uid
+-- columns, and the programs that use them decide who may act as one. The
+-- admins table duplicated that.
+
+DROP TABLE IF EXISTS admins;
@@ -0,0 +1,48 @@
+-- Checks must be in a valid currency, and a check number may only be received
+-- once on each bank account, or once from each player for checks with no bank
+-- account. NULLs are all distinct in a unique index, so bid is indexed as 0 when
+-- it is NULL. SQLite can't add a CHECK constraint to a table, so checks is
+-- rebuilt. The migration fails if duplicate check numbers have
+-- already been received; they must be put right by hand first.
+
+CREATE TABLE checks_new (
+    chid INTEGER PRIMARY KEY AUTOINCREMENT, -- SERIAL NOT NULL
+    uid INTEGER NOT NULL,
+    bid INT,
+    check_number TEXT, -- CHAR(16)
+    amount INTEGER NOT NULL, -- MONEY(8,2) held in minor units
+    currency TEXT NOT NULL, -- CHAR(3)
+    minutes INTEGER NOT NULL,
+    received TEXT DEFAULT CURRENT_DATE, -- DATE DEFAULT TODAY
+    status TEXT DEFAULT "R", -- CHAR(1)
+    settled TEXT, -- DATE
+    cid INT,
+    admin_uid INT,
+
+    CHECK (amount > 0),
+    CHECK (chid <= 2147483647), -- int32 max value
+    CHECK (length(currency) = 3 AND currency NOT GLOB '*[^A-Z]*'), -- ISO 4217
+    CHECK (minutes > 0),
+    CHECK (status IN ('B' ,'C' ,'R' )),
+
+    FOREIGN KEY (admin_uid) REFERENCES accounts(uid),
+    FOREIGN KEY (bid) REFERENCES bank_accounts(bid),
+    FOREIGN KEY (cid) REFERENCES credits(cid),
+    FOREIGN KEY (uid) REFERENCES accounts(uid)
+) STRICT;
+
+INSERT INTO checks_new
+SELECT chid, uid, bid, check_number, amount, currency, minutes, received, status, settled, cid, admin_uid
+FROM checks;
+
+-- Keep chid from reusing the IDs of any checks that have been deleted.
+UPDATE sqlite_sequence
+SET seq = MAX(seq, COALESCE((SELECT seq FROM sqlite_sequence WHERE name = 'checks'), 0))
+WHERE name = 'checks_new';
+
+DROP TABLE checks;
+ALTER TABLE checks_new RENAME TO checks;
+
+CREATE INDEX IF NOT EXISTS ck_status_idx ON checks (status);
+CREATE INDEX IF NOT EXISTS ck_uid_idx ON checks (uid);
+CREATE UNIQUE INDEX IF NOT EXISTS ck_number_idx ON checks (COALESCE(bid, 0), uid, check_number) WHERE check_number IS NOT NULL;
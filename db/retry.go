@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Backoff between attempts of a busy transaction. The delay doubles from
+// minRetryDelay up to maxRetryDelay, and each sleep is a random time between
+// half the delay and the full delay so that competing processes spread out.
+const (
+	maxTxAttempts = 8
+	minRetryDelay = 10 * time.Millisecond
+	maxRetryDelay = time.Second
+)
+
+// IsBusy reports whether err is SQLITE_BUSY or SQLITE_LOCKED, including their
+// extended codes. Such errors are transient: the transaction that got one has
+// to be rolled back and can then be retried.
+func IsBusy(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	switch sqliteErr.Code() & 0xff { // Primary result code
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsUniqueViolation reports whether err is a UNIQUE or PRIMARY KEY constraint
+// failure, such as another process inserting the same key first.
+func IsUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return true
+	default:
+		return false
+	}
+}
+
+// RunInTx runs fn in the default database's auto-transaction and commits it,
+// retrying busy transactions. See Handle.RunInTx.
+func RunInTx(fn func() error) (int, error) {
+	return std.RunInTx(fn)
+}
+
+// RunInTxContext is like RunInTx but uses ctx for the commit and stops
+// retrying when ctx is done.
+func RunInTxContext(ctx context.Context, fn func() error) (int, error) {
+	return std.RunInTxContext(ctx, fn)
+}
+
+// RunInTx runs fn in the auto-transaction and commits the work it did. If fn
+// or the commit fails with a busy or locked error the transaction is rolled
+// back and fn is run again after a jittered backoff, up to eight attempts in
+// all. Any other error is returned straight away and the transaction is left
+// as it is for the caller to deal with, so fn should do its work in a
+// savepoint if a failure part way must be undone. RunInTx returns the number
+// of retries made. Each retry is reported to the tracer as a "RETRY" event
+// carrying the busy error and the time slept.
+//
+// Because a retry starts the whole transaction again, RunInTx must be called
+// at a transaction boundary and fn must do all of the transaction's work.
+// fn must not commit or roll back itself.
+func (h *Handle) RunInTx(fn func() error) (int, error) {
+	return h.RunInTxContext(context.Background(), fn)
+}
+
+// RunInTxContext is like RunInTx but uses ctx for the commit and stops
+// retrying when ctx is done.
+func (h *Handle) RunInTxContext(ctx context.Context, fn func() error) (int, error) {
+	delay := minRetryDelay
+	for retries := 0; ; retries++ {
+		err := fn()
+		if err == nil {
+			err = h.CommitContext(ctx)
+		}
+		if err == nil {
+			return retries, nil
+		}
+		if !IsBusy(err) {
+			return retries, err
+		}
+		_ = h.RollbackContext(ctx)
+		if retries+1 == maxTxAttempts {
+			return retries, err
+		}
+
+		sleep := delay/2 + rand.N(delay/2)
+		select {
+		case <-ctx.Done():
+			return retries, ctx.Err()
+		case <-time.After(sleep):
+		}
+		traceRetry(sleep, err)
+		delay = min(2*delay, maxRetryDelay)
+	}
+}
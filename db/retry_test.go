@@ -0,0 +1,195 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunInTx(t *testing.T) {
+	setup := func(t *testing.T) (*Handle, *Handle) {
+		dir := t.TempDir()
+		h1, err := Open(dir, false)
+		require.NoError(t, err)
+		t.Cleanup(h1.Abandon)
+		_, err = h1.Exec("CREATE TABLE test (name TEXT)")
+		require.NoError(t, err)
+		require.NoError(t, h1.Commit())
+
+		h2, err := Open(dir, false)
+		require.NoError(t, err)
+		t.Cleanup(h2.Abandon)
+		return h1, h2
+	}
+
+	count := func(t *testing.T, h interface {
+		QueryRow(string, ...any) *Row
+	}) int {
+		var n int
+		require.NoError(t, h.QueryRow("SELECT COUNT(*) FROM test").Scan(&n))
+		return n
+	}
+
+	t.Run("commits", func(t *testing.T) {
+		h1, h2 := setup(t)
+		retries, err := h2.RunInTx(func() error {
+			_, err := h2.Exec("INSERT INTO test (name) VALUES ('one')")
+			return err
+		})
+		require.NoError(t, err)
+		assert.Zero(t, retries)
+		assert.Equal(t, 1, count(t, h1))
+	})
+
+	t.Run("retries busy transaction", func(t *testing.T) {
+		h1, h2 := setup(t)
+		rec := &recordingTracer{}
+		setTestTracer(t, rec)
+
+		attempts := 0
+		retries, err := h2.RunInTx(func() error {
+			attempts++
+			count(t, h2) // Start a read transaction.
+			if attempts == 1 {
+				// Change the database under h2's snapshot so its
+				// write fails with SQLITE_BUSY_SNAPSHOT.
+				_, err := h1.Exec("INSERT INTO test (name) VALUES ('one')")
+				require.NoError(t, err)
+				require.NoError(t, h1.Commit())
+			}
+			_, err := h2.Exec("INSERT INTO test (name) VALUES ('two')")
+			return err
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, attempts)
+		assert.Equal(t, 1, retries)
+		require.NoError(t, h1.Commit())
+		assert.Equal(t, 2, count(t, h1))
+
+		var retried []TraceEvent
+		for _, ev := range rec.events {
+			if ev.SQL == "RETRY" {
+				retried = append(retried, ev)
+			}
+		}
+		require.Len(t, retried, 1)
+		assert.True(t, IsBusy(retried[0].Err))
+		assert.Positive(t, retried[0].Duration)
+	})
+
+	t.Run("retries busy commit", func(t *testing.T) {
+		dir := t.TempDir()
+		h, err := Open(dir, false)
+		require.NoError(t, err)
+		t.Cleanup(h.Abandon)
+
+		// In rollback journal mode a COMMIT needs an exclusive lock, so
+		// a reader makes it fail with SQLITE_BUSY. The journal mode can
+		// only be changed while no other connection is open.
+		require.NoError(t, h.tx.Rollback())
+		for _, stmt := range []string{
+			"PRAGMA journal_mode = DELETE",
+			"PRAGMA busy_timeout = 0",
+			"CREATE TABLE test (name TEXT)",
+		} {
+			_, err := h.conn.ExecContext(context.Background(), stmt)
+			require.NoError(t, err)
+		}
+		require.NoError(t, h.startTransaction())
+
+		reader, err := sql.Open("sqlite", "file:"+filepath.Join(dir, "ibgames.sqlite"))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = reader.Close() })
+		readTx, err := reader.Begin()
+		require.NoError(t, err)
+
+		attempts := 0
+		retries, err := h.RunInTx(func() error {
+			attempts++
+			switch attempts {
+			case 1:
+				var n int // Take a shared lock.
+				require.NoError(t, readTx.QueryRow("SELECT COUNT(*) FROM test").Scan(&n))
+			case 2:
+				require.NoError(t, readTx.Rollback())
+			}
+			_, err := h.Exec("INSERT INTO test (name) VALUES ('one')")
+			return err
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, attempts)
+		assert.Equal(t, 1, retries)
+		assert.Equal(t, 1, count(t, h))
+
+		// The handle is still usable.
+		_, err = h.Exec("INSERT INTO test (name) VALUES ('two')")
+		require.NoError(t, err)
+		require.NoError(t, h.Commit())
+	})
+
+	t.Run("other errors are left to the caller without retrying", func(t *testing.T) {
+		h1, h2 := setup(t)
+		errTest := errors.New("test")
+		attempts := 0
+		retries, err := h2.RunInTx(func() error {
+			attempts++
+			_, err := h2.Exec("INSERT INTO test (name) VALUES ('one')")
+			require.NoError(t, err)
+			return errTest
+		})
+		assert.ErrorIs(t, err, errTest)
+		assert.Zero(t, retries)
+		assert.Equal(t, 1, attempts)
+		assert.Zero(t, count(t, h1))
+
+		// The work is still pending in h2's transaction.
+		assert.Equal(t, 1, count(t, h2))
+		require.NoError(t, h2.Rollback())
+		assert.Zero(t, count(t, h2))
+	})
+
+	t.Run("stops when context is done", func(t *testing.T) {
+		h1, h2 := setup(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		retries, err := h2.RunInTxContext(ctx, func() error {
+			count(t, h2)
+			_, err := h1.Exec("INSERT INTO test (name) VALUES ('one')")
+			require.NoError(t, err)
+			require.NoError(t, h1.Commit())
+			cancel()
+			_, err = h2.Exec("INSERT INTO test (name) VALUES ('two')")
+			return err
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Zero(t, retries)
+	})
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	assert.False(t, IsUniqueViolation(nil))
+
+	h := openTestHandle(t)
+	_, err := h.Exec("CREATE TABLE test (name TEXT UNIQUE)")
+	require.NoError(t, err)
+	_, err = h.Exec("INSERT INTO test (name) VALUES ('one')")
+	require.NoError(t, err)
+	_, err = h.Exec("INSERT INTO test (name) VALUES ('one')")
+	assert.True(t, IsUniqueViolation(err))
+	_, err = h.Exec("INSERT INTO test (name, other) VALUES ('two', 1)")
+	assert.False(t, IsUniqueViolation(err))
+}
+
+func TestIsBusy(t *testing.T) {
+	assert.False(t, IsBusy(nil))
+	assert.False(t, IsBusy(errors.New("database is locked")))
+
+	h := openTestHandle(t)
+	_, err := h.Exec("SELECT * FROM nonexistent")
+	require.Error(t, err)
+	assert.False(t, IsBusy(err))
+}
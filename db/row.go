@@ -0,0 +1,27 @@
+package db
+
+import "database/sql"
+
+// Row is the result of QueryRow. It is like sql.Row, but can also carry the
+// error from a query that couldn't be run at all, such as ErrNoTransaction.
+type Row struct {
+	row *sql.Row
+	err error
+}
+
+// Scan copies the columns of the row into dest, as sql.Row.Scan does. It
+// returns sql.ErrNoRows if the query selected no rows.
+func (r *Row) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.row.Scan(dest...)
+}
+
+// Err returns the error, if any, from running the query.
+func (r *Row) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.row.Err()
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+var savepointName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Savepoint marks a point within the current auto-transaction that work can
+// later be rolled back to without abandoning the whole transaction.
+func Savepoint(name string) error {
+	return std.Savepoint(name)
+}
+
+// SavepointContext is like Savepoint but uses ctx for the statement.
+func SavepointContext(ctx context.Context, name string) error {
+	return std.SavepointContext(ctx, name)
+}
+
+// RollbackTo undoes all work done since the named savepoint was set. The
+// savepoint remains in place.
+func RollbackTo(name string) error {
+	return std.RollbackTo(name)
+}
+
+// RollbackToContext is like RollbackTo but uses ctx for the statement.
+func RollbackToContext(ctx context.Context, name string) error {
+	return std.RollbackToContext(ctx, name)
+}
+
+// Release removes the named savepoint, and any set after it, keeping the work
+// done since. The work is still only committed by Commit.
+func Release(name string) error {
+	return std.Release(name)
+}
+
+// ReleaseContext is like Release but uses ctx for the statement.
+func ReleaseContext(ctx context.Context, name string) error {
+	return std.ReleaseContext(ctx, name)
+}
+
+// WithSavepoint runs fn inside the named savepoint. If fn returns an error the
+// work it did is rolled back, leaving the rest of the transaction as it was.
+func WithSavepoint(name string, fn func() error) error {
+	return std.WithSavepoint(name, fn)
+}
+
+// WithSavepointContext is like WithSavepoint but uses ctx for the savepoint
+// statements.
+func WithSavepointContext(ctx context.Context, name string, fn func() error) error {
+	return std.WithSavepointContext(ctx, name, fn)
+}
+
+// Savepoint is like the package-level Savepoint but uses h.
+func (h *Handle) Savepoint(name string) error {
+	return h.SavepointContext(context.Background(), name)
+}
+
+// SavepointContext is like Savepoint but uses ctx for the statement.
+func (h *Handle) SavepointContext(ctx context.Context, name string) error {
+	return h.savepointExec(ctx, "SAVEPOINT %s", name)
+}
+
+// RollbackTo is like the package-level RollbackTo but uses h.
+func (h *Handle) RollbackTo(name string) error {
+	return h.RollbackToContext(context.Background(), name)
+}
+
+// RollbackToContext is like RollbackTo but uses ctx for the statement.
+func (h *Handle) RollbackToContext(ctx context.Context, name string) error {
+	return h.savepointExec(ctx, "ROLLBACK TO %s", name)
+}
+
+// Release is like the package-level Release but uses h.
+func (h *Handle) Release(name string) error {
+	return h.ReleaseContext(context.Background(), name)
+}
+
+// ReleaseContext is like Release but uses ctx for the statement.
+func (h *Handle) ReleaseContext(ctx context.Context, name string) error {
+	return h.savepointExec(ctx, "RELEASE %s", name)
+}
+
+// WithSavepoint is like the package-level WithSavepoint but uses h.
+func (h *Handle) WithSavepoint(name string, fn func() error) error {
+	return h.WithSavepointContext(context.Background(), name, fn)
+}
+
+// WithSavepointContext is like WithSavepoint but uses ctx for the savepoint
+// statements. The savepoint is also unwound if fn panics.
+func (h *Handle) WithSavepointContext(ctx context.Context, name string, fn func() error) (err error) {
+	if err := h.SavepointContext(ctx, name); err != nil {
+		return err
+	}
+
+	done := false
+	defer func() {
+		if !done {
+			// fn panicked; unwind without masking the panic.
+			_ = h.unwindSavepoint(context.Background(), name)
+		}
+	}()
+
+	err = fn()
+	done = true
+	if err != nil {
+		if uerr := h.unwindSavepoint(ctx, name); uerr != nil {
+			return fmt.Errorf("%w (and unwinding savepoint %s: %v)", err, name, uerr)
+		}
+		return err
+	}
+	return h.ReleaseContext(ctx, name)
+}
+
+// unwindSavepoint rolls back and removes a savepoint.
+func (h *Handle) unwindSavepoint(ctx context.Context, name string) error {
+	if err := h.RollbackToContext(ctx, name); err != nil {
+		return err
+	}
+	return h.ReleaseContext(ctx, name)
+}
+
+func (h *Handle) savepointExec(ctx context.Context, format, name string) error {
+	if !savepointName.MatchString(name) {
+		return fmt.Errorf("bad savepoint name %q", name)
+	}
+	// Savepoint names can't be bound as parameters.
+	_, err := h.exec(ctx, fmt.Sprintf(format, name))
+	return err
+}
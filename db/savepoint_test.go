@@ -0,0 +1,115 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSavepoints(t *testing.T) {
+	setupTestDB(t)
+	require.NoError(t, Connect(false))
+
+	_, err := Exec("CREATE TABLE test (name TEXT)")
+	require.NoError(t, err)
+	require.NoError(t, Commit())
+
+	count := func() int {
+		var n int
+		require.NoError(t, QueryRow("SELECT COUNT(*) FROM test").Scan(&n))
+		return n
+	}
+
+	t.Run("rollback to savepoint keeps earlier work", func(t *testing.T) {
+		_, err := Exec("INSERT INTO test (name) VALUES ('before')")
+		require.NoError(t, err)
+
+		require.NoError(t, Savepoint("sp1"))
+		_, err = Exec("INSERT INTO test (name) VALUES ('after')")
+		require.NoError(t, err)
+		assert.Equal(t, 2, count())
+
+		require.NoError(t, RollbackTo("sp1"))
+		assert.Equal(t, 1, count())
+		require.NoError(t, Release("sp1"))
+
+		require.NoError(t, Commit())
+		assert.Equal(t, 1, count())
+	})
+
+	t.Run("release keeps work", func(t *testing.T) {
+		require.NoError(t, Savepoint("sp2"))
+		_, err := Exec("INSERT INTO test (name) VALUES ('released')")
+		require.NoError(t, err)
+		require.NoError(t, Release("sp2"))
+
+		require.NoError(t, Commit())
+		assert.Equal(t, 2, count())
+	})
+
+	t.Run("nested savepoints", func(t *testing.T) {
+		require.NoError(t, Savepoint("outer"))
+		_, err := Exec("INSERT INTO test (name) VALUES ('outer')")
+		require.NoError(t, err)
+		require.NoError(t, Savepoint("inner"))
+		_, err = Exec("INSERT INTO test (name) VALUES ('inner')")
+		require.NoError(t, err)
+
+		require.NoError(t, RollbackTo("inner"))
+		require.NoError(t, Release("outer")) // Releases inner too
+		require.NoError(t, Commit())
+		assert.Equal(t, 3, count())
+	})
+
+	t.Run("WithSavepoint unwinds on error", func(t *testing.T) {
+		_, err := Exec("INSERT INTO test (name) VALUES ('kept')")
+		require.NoError(t, err)
+
+		failure := errors.New("failure")
+		err = WithSavepoint("work", func() error {
+			_, err := Exec("INSERT INTO test (name) VALUES ('discarded')")
+			require.NoError(t, err)
+			return failure
+		})
+		require.ErrorIs(t, err, failure)
+		assert.Equal(t, 4, count())
+
+		// The savepoint has gone.
+		require.Error(t, Release("work"))
+
+		require.NoError(t, Commit())
+		assert.Equal(t, 4, count())
+	})
+
+	t.Run("WithSavepoint keeps work on success", func(t *testing.T) {
+		err := WithSavepoint("work", func() error {
+			_, err := Exec("INSERT INTO test (name) VALUES ('success')")
+			return err
+		})
+		require.NoError(t, err)
+		require.NoError(t, Commit())
+		assert.Equal(t, 5, count())
+	})
+
+	t.Run("WithSavepoint unwinds on panic", func(t *testing.T) {
+		assert.Panics(t, func() {
+			_ = WithSavepoint("work", func() error {
+				_, err := Exec("INSERT INTO test (name) VALUES ('panic')")
+				require.NoError(t, err)
+				panic("oops")
+			})
+		})
+		assert.Equal(t, 5, count())
+		require.Error(t, Release("work"))
+	})
+
+	t.Run("rejects bad names", func(t *testing.T) {
+		require.Error(t, Savepoint(""))
+		require.Error(t, Savepoint("x; DROP TABLE test"))
+		require.Error(t, Savepoint("1st"))
+	})
+
+	require.NoError(t, Disconnect())
+}
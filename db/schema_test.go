@@ -0,0 +1,79 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nosborn/ibgames-1999/db"
+	"github.com/nosborn/ibgames-1999/internal/testutil"
+)
+
+// describeSchema summarises the tables, columns, indexes and triggers in a
+// database so that two schemas can be compared regardless of formatting.
+func describeSchema(t *testing.T, sqlDB *sql.DB) []string {
+	var desc []string
+
+	rows, err := sqlDB.Query(`
+		SELECT type, name, tbl_name
+		FROM sqlite_master
+		WHERE name NOT LIKE 'sqlite_%'
+		ORDER BY type, name`)
+	require.NoError(t, err)
+	var tables []string
+	for rows.Next() {
+		var typ, name, tblName string
+		require.NoError(t, rows.Scan(&typ, &name, &tblName))
+		desc = append(desc, fmt.Sprintf("%s %s on %s", typ, name, tblName))
+		if typ == "table" {
+			tables = append(tables, name)
+		}
+	}
+	require.NoError(t, rows.Err())
+	rows.Close()
+
+	for _, table := range tables {
+		rows, err := sqlDB.Query(`
+			SELECT name, type, "notnull", COALESCE(dflt_value, ''), pk
+			FROM pragma_table_info(?)
+			ORDER BY cid`, table)
+		require.NoError(t, err)
+		for rows.Next() {
+			var name, typ, dflt string
+			var notNull, pk int
+			require.NoError(t, rows.Scan(&name, &typ, &notNull, &dflt, &pk))
+			desc = append(desc, fmt.Sprintf("column %s.%s %s notnull=%d default=%s pk=%d", table, name, typ, notNull, dflt, pk))
+		}
+		require.NoError(t, rows.Err())
+		rows.Close()
+	}
+
+	var version int
+	require.NoError(t, sqlDB.QueryRow("PRAGMA user_version").Scan(&version))
+	desc = append(desc, fmt.Sprintf("user_version %d", version))
+
+	return desc
+}
+
+func TestSchemaMatchesMigrations(t *testing.T) {
+	fromScript := testutil.SetupTestDatabaseWithSchema(t)
+
+	dir := t.TempDir()
+	h, err := db.Open(dir, false)
+	require.NoError(t, err)
+	_, err = h.Migrate(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, h.Close())
+
+	fromMigrations, err := sql.Open("sqlite", filepath.Join(dir, "ibgames.sqlite"))
+	require.NoError(t, err)
+	defer fromMigrations.Close()
+
+	assert.Equal(t, describeSchema(t, fromScript.TestDB), describeSchema(t, fromMigrations),
+		"ibgames.sql and db/migrations have drifted apart")
+}
@@ -1,9 +1,15 @@
 package db
 
-import "os"
+import (
+	"os"
 
+	"github.com/nosborn/ibgames-1999/config"
+)
+
+// SetEnvironment sets DBPATH to the configured database directory, for the
+// benefit of Connect and of any child processes.
 func SetEnvironment() int {
-	if err := os.Setenv("DBPATH", path); err != nil {
+	if err := os.Setenv("DBPATH", config.Get().DBPath); err != nil {
 		return -1
 	}
 	return 0
@@ -1,7 +0,0 @@
-//go:build darwin
-
-package db
-
-const (
-	path = "data"
-)
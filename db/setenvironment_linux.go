@@ -1,7 +0,0 @@
-//go:build linux
-
-package db
-
-const (
-	path = "/home/fed/data"
-)
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Stmt is a prepared statement. Its executions are traced like the other
+// database calls, and it is prepared again if its handle reconnects.
+type Stmt struct {
+	h          *Handle
+	stmt       *sql.Stmt
+	query      string
+	generation int // Handle generation the statement was prepared in
+}
+
+// Close closes the statement.
+func (s *Stmt) Close() error {
+	return s.stmt.Close()
+}
+
+// prepared returns the statement prepared on the handle's current connection
+// and bound to its auto-transaction.
+func (s *Stmt) prepared(ctx context.Context) (*sql.Stmt, error) {
+	tx, err := s.h.transaction()
+	if err != nil {
+		return nil, err
+	}
+	if s.generation != s.h.generation {
+		stmt, err := s.h.conn.PrepareContext(ctx, s.query)
+		if err != nil {
+			return nil, err
+		}
+		_ = s.stmt.Close()
+		s.stmt, s.generation = stmt, s.h.generation
+	}
+	return tx.StmtContext(ctx, s.stmt), nil
+}
+
+// Exec executes the statement with the given arguments.
+func (s *Stmt) Exec(args ...any) (sql.Result, error) {
+	return s.ExecContext(context.Background(), args...)
+}
+
+// ExecContext is like Exec but uses ctx for the statement.
+func (s *Stmt) ExecContext(ctx context.Context, args ...any) (sql.Result, error) {
+	start := time.Now()
+	stmt, err := s.prepared(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result, err := stmt.ExecContext(ctx, args...)
+	traceCall(s.query, len(args), start, result, err)
+	s.h.noteWrite(err)
+	return result, err
+}
+
+// QueryRow executes the statement as a query that returns at most one row.
+func (s *Stmt) QueryRow(args ...any) *Row {
+	return s.QueryRowContext(context.Background(), args...)
+}
+
+// QueryRowContext is like QueryRow but uses ctx for the query.
+func (s *Stmt) QueryRowContext(ctx context.Context, args ...any) *Row {
+	start := time.Now()
+	stmt, err := s.prepared(ctx)
+	if err != nil {
+		return &Row{err: err}
+	}
+	row := stmt.QueryRowContext(ctx, args...)
+	traceCall(s.query, len(args), start, nil, row.Err())
+	s.h.noteError(row.Err())
+	return &Row{row: row}
+}
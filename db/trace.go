@@ -0,0 +1,196 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// TraceEvent describes one call to the database.
+type TraceEvent struct {
+	SQL          string        // Statement text
+	Args         int           // Number of arguments
+	Duration     time.Duration // Time taken by the call
+	RowsAffected int64         // -1 for queries, or if unknown
+	Err          error         // Error returned by the call, if any
+}
+
+// Tracer observes calls to the database. Trace is called synchronously after
+// every Exec, Query, QueryRow, prepared statement execution, Commit and
+// Rollback on every handle, and for every retry made by RunInTx, so it must be
+// quick and safe for concurrent use.
+type Tracer interface {
+	Trace(ev TraceEvent)
+}
+
+type tracerHolder struct{ t Tracer }
+
+var tracer atomic.Pointer[tracerHolder]
+
+// SetTracer installs t as the tracer for all handles, replacing any previous
+// one. A nil t turns tracing off. Use MultiTracer to install more than one.
+func SetTracer(t Tracer) {
+	if t == nil {
+		tracer.Store(nil)
+		return
+	}
+	tracer.Store(&tracerHolder{t})
+}
+
+// MultiTracer returns a Tracer that passes each event to all of ts in turn.
+func MultiTracer(ts ...Tracer) Tracer {
+	return multiTracer(ts)
+}
+
+type multiTracer []Tracer
+
+func (m multiTracer) Trace(ev TraceEvent) {
+	for _, t := range m {
+		t.Trace(ev)
+	}
+}
+
+// traceRetry reports a busy transaction that was retried after sleeping.
+func traceRetry(sleep time.Duration, err error) {
+	th := tracer.Load()
+	if th == nil {
+		return
+	}
+	th.t.Trace(TraceEvent{SQL: "RETRY", Duration: sleep, RowsAffected: -1, Err: err})
+}
+
+// traceCall reports a call that started at start to the current tracer.
+func traceCall(query string, nargs int, start time.Time, result sql.Result, err error) {
+	th := tracer.Load()
+	if th == nil {
+		return
+	}
+	ev := TraceEvent{
+		SQL:          query,
+		Args:         nargs,
+		Duration:     time.Since(start),
+		RowsAffected: -1,
+		Err:          err,
+	}
+	if result != nil && err == nil {
+		if n, rerr := result.RowsAffected(); rerr == nil {
+			ev.RowsAffected = n
+		}
+	}
+	th.t.Trace(ev)
+}
+
+// compactSQL squeezes the whitespace out of a statement for logging.
+func compactSQL(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+// SlowQueryLogger is a Tracer that logs calls that take at least Threshold.
+type SlowQueryLogger struct {
+	Threshold time.Duration
+	Logger    *log.Logger // nil means the standard logger
+}
+
+// Trace implements Tracer.
+func (l *SlowQueryLogger) Trace(ev TraceEvent) {
+	if ev.Duration < l.Threshold {
+		return
+	}
+	msg := fmt.Sprintf("Slow query (%v, %d args): %s", ev.Duration, ev.Args, compactSQL(ev.SQL))
+	if ev.Err != nil {
+		msg += fmt.Sprintf(" failed: %v", ev.Err)
+	}
+	if l.Logger != nil {
+		l.Logger.Print(msg)
+	} else {
+		log.Print(msg)
+	}
+}
+
+// StatementStats holds the counters for one statement.
+type StatementStats struct {
+	SQL    string
+	Calls  int64
+	Errors int64
+	Rows   int64 // Total rows affected
+	Total  time.Duration
+	Max    time.Duration
+}
+
+// Stats is a Tracer that keeps counters for each distinct statement.
+type Stats struct {
+	mu         sync.Mutex
+	statements map[string]*StatementStats
+}
+
+// NewStats returns an empty set of statement counters.
+func NewStats() *Stats {
+	return &Stats{statements: map[string]*StatementStats{}}
+}
+
+// Trace implements Tracer.
+func (s *Stats) Trace(ev TraceEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.statements[ev.SQL]
+	if !ok {
+		st = &StatementStats{SQL: ev.SQL}
+		s.statements[ev.SQL] = st
+	}
+	st.Calls++
+	if ev.Err != nil {
+		st.Errors++
+	}
+	if ev.RowsAffected > 0 {
+		st.Rows += ev.RowsAffected
+	}
+	st.Total += ev.Duration
+	if ev.Duration > st.Max {
+		st.Max = ev.Duration
+	}
+}
+
+// Statements returns a copy of the counters, busiest statement first.
+func (s *Stats) Statements() []StatementStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make([]StatementStats, 0, len(s.statements))
+	for _, st := range s.statements {
+		stats = append(stats, *st)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Total != stats[j].Total {
+			return stats[i].Total > stats[j].Total
+		}
+		return stats[i].SQL < stats[j].SQL
+	})
+	return stats
+}
+
+// Reset clears all the counters.
+func (s *Stats) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statements = map[string]*StatementStats{}
+}
+
+// Dump writes the counters to w as a table, busiest statement first.
+func (s *Stats) Dump(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "CALLS\tERRORS\tROWS\tTOTAL\tMEAN\tMAX\t SQL")
+	for _, st := range s.Statements() {
+		mean := st.Total / time.Duration(st.Calls)
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%v\t%v\t%v\t %s\n",
+			st.Calls, st.Errors, st.Rows, st.Total, mean, st.Max, compactSQL(st.SQL))
+	}
+	return tw.Flush()
+}
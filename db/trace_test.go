@@ -0,0 +1,152 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingTracer struct {
+	mu     sync.Mutex
+	events []TraceEvent
+}
+
+func (r *recordingTracer) Trace(ev TraceEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, ev)
+}
+
+func setTestTracer(t *testing.T, tr Tracer) {
+	SetTracer(tr)
+	t.Cleanup(func() { SetTracer(nil) })
+}
+
+func TestTracer(t *testing.T) {
+	t.Run("sees every call", func(t *testing.T) {
+		h := openTestHandle(t)
+		_, err := h.Exec("CREATE TABLE test (name TEXT)")
+		require.NoError(t, err)
+
+		rec := &recordingTracer{}
+		setTestTracer(t, rec)
+
+		_, err = h.Exec("INSERT INTO test (name) VALUES (?), (?)", "one", "two")
+		require.NoError(t, err)
+		var n int
+		require.NoError(t, h.QueryRow("SELECT COUNT(*) FROM test WHERE name <> ?", "").Scan(&n))
+		stmt, err := h.Prepare("DELETE FROM test WHERE name = ?")
+		require.NoError(t, err)
+		defer stmt.Close()
+		_, err = stmt.Exec("one")
+		require.NoError(t, err)
+		require.NoError(t, h.Commit())
+		_, err = h.Exec("INSERT INTO nonexistent VALUES (1)")
+		require.Error(t, err)
+		require.NoError(t, h.Rollback())
+
+		require.Len(t, rec.events, 6)
+		assert.Equal(t, "INSERT INTO test (name) VALUES (?), (?)", rec.events[0].SQL)
+		assert.Equal(t, 2, rec.events[0].Args)
+		assert.Equal(t, int64(2), rec.events[0].RowsAffected)
+		assert.NoError(t, rec.events[0].Err)
+		assert.Equal(t, 1, rec.events[1].Args)
+		assert.Equal(t, int64(-1), rec.events[1].RowsAffected)
+		assert.Equal(t, "DELETE FROM test WHERE name = ?", rec.events[2].SQL)
+		assert.Equal(t, int64(1), rec.events[2].RowsAffected)
+		assert.Equal(t, "COMMIT", rec.events[3].SQL)
+		assert.Error(t, rec.events[4].Err)
+		assert.Equal(t, int64(-1), rec.events[4].RowsAffected)
+		assert.Equal(t, "ROLLBACK", rec.events[5].SQL)
+	})
+
+	t.Run("sees helper queries", func(t *testing.T) {
+		h := openTestHandle(t)
+		rec := &recordingTracer{}
+		setTestTracer(t, rec)
+
+		require.NoError(t, h.WithSavepoint("traced", func() error { return nil }))
+		_, err := h.SchemaVersion(context.Background())
+		require.NoError(t, err)
+		_, err = h.IntegrityCheck(context.Background())
+		require.NoError(t, err)
+
+		var sqls []string
+		for _, ev := range rec.events {
+			sqls = append(sqls, ev.SQL)
+		}
+		assert.Equal(t, []string{"SAVEPOINT traced", "RELEASE traced", "PRAGMA user_version", "PRAGMA integrity_check"}, sqls)
+	})
+
+	t.Run("nil turns tracing off", func(t *testing.T) {
+		h := openTestHandle(t)
+		rec := &recordingTracer{}
+		setTestTracer(t, rec)
+		SetTracer(nil)
+
+		_, err := h.Exec("CREATE TABLE test (name TEXT)")
+		require.NoError(t, err)
+		assert.Empty(t, rec.events)
+	})
+
+	t.Run("multi tracer", func(t *testing.T) {
+		h := openTestHandle(t)
+		rec1, rec2 := &recordingTracer{}, &recordingTracer{}
+		setTestTracer(t, MultiTracer(rec1, rec2))
+
+		_, err := h.Exec("CREATE TABLE test (name TEXT)")
+		require.NoError(t, err)
+		assert.Len(t, rec1.events, 1)
+		assert.Len(t, rec2.events, 1)
+	})
+}
+
+func TestSlowQueryLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &SlowQueryLogger{Threshold: time.Second, Logger: log.New(&buf, "", 0)}
+
+	logger.Trace(TraceEvent{SQL: "SELECT 1", Duration: time.Millisecond})
+	assert.Empty(t, buf.String())
+
+	logger.Trace(TraceEvent{SQL: "SELECT *\n\t\tFROM accounts\n\t\tWHERE uid = ?", Args: 1, Duration: 2 * time.Second})
+	assert.Equal(t, "Slow query (2s, 1 args): SELECT * FROM accounts WHERE uid = ?\n", buf.String())
+}
+
+func TestStats(t *testing.T) {
+	stats := NewStats()
+	stats.Trace(TraceEvent{SQL: "SELECT 1", Duration: time.Millisecond, RowsAffected: -1})
+	stats.Trace(TraceEvent{SQL: "UPDATE x", Duration: 3 * time.Millisecond, RowsAffected: 2})
+	stats.Trace(TraceEvent{SQL: "UPDATE x", Duration: 5 * time.Millisecond, RowsAffected: 1})
+	stats.Trace(TraceEvent{SQL: "UPDATE x", Duration: time.Millisecond, Err: assert.AnError})
+
+	got := stats.Statements()
+	require.Len(t, got, 2)
+	assert.Equal(t, StatementStats{
+		SQL:    "UPDATE x",
+		Calls:  3,
+		Errors: 1,
+		Rows:   3,
+		Total:  9 * time.Millisecond,
+		Max:    5 * time.Millisecond,
+	}, got[0])
+	assert.Equal(t, "SELECT 1", got[1].SQL)
+	assert.Equal(t, int64(0), got[1].Rows)
+
+	var buf bytes.Buffer
+	require.NoError(t, stats.Dump(&buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Contains(t, lines[0], "CALLS")
+	assert.Contains(t, lines[1], "UPDATE x")
+	assert.Contains(t, lines[2], "SELECT 1")
+
+	stats.Reset()
+	assert.Empty(t, stats.Statements())
+}
@@ -1,6 +1,9 @@
 package ibgames
 
-import "math"
+import (
+	"math"
+	"strconv"
+)
 
 type AccountID uint32
 
@@ -11,3 +14,30 @@ const (
 	MinAccountID = 100000
 	MaxAccountID = math.MaxInt32 // NOT MaxUint32
 )
+
+// AccountStatus is the state of an account. The values are the characters
+// stored in accounts.status, except for AccountNotFound, which is reported
+// for accounts that don't exist.
+type AccountStatus byte
+
+const (
+	AccountNotFound  AccountStatus = 0
+	AccountActive    AccountStatus = 'A'
+	AccountSuspended AccountStatus = 'S'
+	AccountCancelled AccountStatus = 'X'
+)
+
+func (s AccountStatus) String() string {
+	switch s {
+	case AccountNotFound:
+		return "not found"
+	case AccountActive:
+		return "active"
+	case AccountSuspended:
+		return "suspended"
+	case AccountCancelled:
+		return "cancelled"
+	default:
+		return "AccountStatus(" + strconv.Quote(string(rune(s))) + ")"
+	}
+}
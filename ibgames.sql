@@ -29,6 +29,7 @@ CREATE TABLE IF NOT EXISTS accounts (
     bad_check TEXT DEFAULT "N", -- CHAR(1)
     buddy_uid INT,
     buddy_payment TEXT DEFAULT "N", -- CHAR(1)
+    status_reason TEXT, -- CHAR(80)
 
     UNIQUE (name_key),
 
@@ -53,8 +54,77 @@ BEGIN
     SELECT RAISE(FAIL, 'UID limit reached');
 END;
 
--- CREATE TABLE bank_accounts
--- CREATE TABLE checks
+CREATE TABLE IF NOT EXISTS name_history (
+    uid INTEGER NOT NULL,
+    name TEXT NOT NULL, -- CHAR(32)
+    name_key TEXT NOT NULL, -- CHAR(32)
+    changed TEXT DEFAULT CURRENT_TIMESTAMP, -- DATETIME YEAR TO MINUTE DEFAULT CURRENT YEAR TO MINUTE
+    admin_uid INT,
+    reserved_until TEXT, -- DATETIME YEAR TO MINUTE
+
+    FOREIGN KEY (admin_uid) REFERENCES accounts(uid),
+    FOREIGN KEY (uid) REFERENCES accounts(uid) ON DELETE CASCADE
+) STRICT;
+
+CREATE INDEX IF NOT EXISTS nh_name_key_idx ON name_history (name_key);
+CREATE INDEX IF NOT EXISTS nh_uid_idx ON name_history (uid);
+
+CREATE TABLE IF NOT EXISTS impersonations (
+    admin_uid INTEGER NOT NULL,
+    uid INTEGER NOT NULL,
+    ip_address TEXT NOT NULL, -- CHAR(15)
+    begin TEXT DEFAULT CURRENT_TIMESTAMP, -- DATETIME YEAR TO MINUTE DEFAULT CURRENT YEAR TO MINUTE
+
+    FOREIGN KEY (admin_uid) REFERENCES accounts(uid),
+    FOREIGN KEY (uid) REFERENCES accounts(uid) ON DELETE CASCADE
+) STRICT;
+
+CREATE INDEX IF NOT EXISTS im_uid_idx ON impersonations (uid);
+
+CREATE TABLE IF NOT EXISTS bank_accounts (
+    bid INTEGER PRIMARY KEY AUTOINCREMENT, -- SERIAL NOT NULL
+    uid INTEGER NOT NULL,
+    routing TEXT NOT NULL, -- CHAR(9)
+    account TEXT NOT NULL, -- CHAR(17)
+    holder TEXT, -- CHAR(48)
+    added TEXT DEFAULT CURRENT_DATE, -- DATE DEFAULT TODAY
+
+    UNIQUE (uid, routing, account),
+
+    CHECK (bid <= 2147483647), -- int32 max value
+
+    FOREIGN KEY (uid) REFERENCES accounts(uid)
+) STRICT;
+
+CREATE TABLE IF NOT EXISTS checks (
+    chid INTEGER PRIMARY KEY AUTOINCREMENT, -- SERIAL NOT NULL
+    uid INTEGER NOT NULL,
+    bid INT,
+    check_number TEXT, -- CHAR(16)
+    amount INTEGER NOT NULL, -- MONEY(8,2) held in minor units
+    currency TEXT NOT NULL, -- CHAR(3)
+    minutes INTEGER NOT NULL,
+    received TEXT DEFAULT CURRENT_DATE, -- DATE DEFAULT TODAY
+    status TEXT DEFAULT "R", -- CHAR(1)
+    settled TEXT, -- DATE
+    cid INT,
+    admin_uid INT,
+
+    CHECK (amount > 0),
+    CHECK (chid <= 2147483647), -- int32 max value
+    CHECK (length(currency) = 3 AND currency NOT GLOB '*[^A-Z]*'), -- ISO 4217
+    CHECK (minutes > 0),
+    CHECK (status IN ('B' ,'C' ,'R' )),
+
+    FOREIGN KEY (admin_uid) REFERENCES accounts(uid),
+    FOREIGN KEY (bid) REFERENCES bank_accounts(bid),
+    FOREIGN KEY (cid) REFERENCES credits(cid),
+    FOREIGN KEY (uid) REFERENCES accounts(uid)
+) STRICT;
+
+CREATE INDEX IF NOT EXISTS ck_status_idx ON checks (status);
+CREATE INDEX IF NOT EXISTS ck_uid_idx ON checks (uid);
+CREATE UNIQUE INDEX IF NOT EXISTS ck_number_idx ON checks (COALESCE(bid, 0), uid, check_number) WHERE check_number IS NOT NULL;
 
 -- CREATE TABLE IF NOT EXISTS cookies (
 --   sid TEXT PRIMARY KEY, -- CHAR(32),
@@ -87,8 +157,93 @@ BEGIN
     SELECT RAISE(FAIL, 'SID limit reached');
 END;
 
--- CREATE TABLE credits
--- CREATE TABLE exchange_rate
--- CREATE TABLE netbanx
+CREATE TABLE IF NOT EXISTS credits (
+    cid INTEGER PRIMARY KEY AUTOINCREMENT, -- SERIAL NOT NULL
+    uid INTEGER NOT NULL,
+    credited TEXT DEFAULT CURRENT_TIMESTAMP, -- DATETIME YEAR TO MINUTE DEFAULT CURRENT YEAR TO MINUTE
+    minutes INTEGER NOT NULL,
+    price INTEGER NOT NULL, -- MONEY(8,2) held in minor units
+    currency TEXT NOT NULL, -- CHAR(3)
+    method TEXT NOT NULL, -- CHAR(1)
+    reference TEXT, -- CHAR(32)
+    admin_uid INT,
+    base_price INTEGER, -- MONEY(8,2) held in minor units of the base currency
+    reversed TEXT, -- DATETIME YEAR TO SECOND
+
+    CHECK (cid <= 2147483647), -- int32 max value
+    CHECK (method IN ('A' ,'C' ,'K' )),
+    CHECK (minutes > 0),
+    CHECK (price >= 0),
+
+    FOREIGN KEY (admin_uid) REFERENCES accounts(uid),
+    FOREIGN KEY (uid) REFERENCES accounts(uid)
+) STRICT;
+
+CREATE INDEX IF NOT EXISTS cr_uid_idx ON credits (uid);
+
+CREATE TRIGGER IF NOT EXISTS prevent_cid_overflow
+BEFORE INSERT ON credits
+WHEN (SELECT seq FROM sqlite_sequence WHERE name = 'credits') >= 2147483647
+BEGIN
+    SELECT RAISE(FAIL, 'CID limit reached');
+END;
+
+CREATE TABLE IF NOT EXISTS exchange_rate (
+    currency TEXT NOT NULL, -- CHAR(3)
+    effective TEXT NOT NULL, -- DATE
+    rate TEXT NOT NULL, -- DECIMAL(20,12), base currency per unit of currency
+
+    PRIMARY KEY (currency, effective)
+) STRICT;
+
+CREATE TABLE IF NOT EXISTS price_list (
+    product INTEGER NOT NULL, -- SMALLINT
+    currency TEXT NOT NULL, -- CHAR(3)
+    minutes INTEGER NOT NULL,
+    effective TEXT NOT NULL, -- DATE
+    price INTEGER NOT NULL, -- MONEY(8,2) held in minor units
+
+    CHECK (minutes > 0),
+    CHECK (price >= 0),
+    CHECK (product >= 0),
+
+    PRIMARY KEY (product, currency, minutes, effective)
+) STRICT;
+
+CREATE TABLE IF NOT EXISTS netbanx (
+    nid INTEGER PRIMARY KEY AUTOINCREMENT, -- SERIAL NOT NULL
+    idempotency_key TEXT NOT NULL, -- CHAR(32)
+    uid INTEGER NOT NULL,
+    operation TEXT NOT NULL, -- CHAR(1)
+    amount INTEGER NOT NULL, -- MONEY(8,2) held in minor units
+    currency TEXT NOT NULL, -- CHAR(3)
+    minutes INTEGER, -- Credited when a capture is approved
+    card_last4 TEXT, -- CHAR(4)
+    parent_id TEXT, -- CHAR(36)
+    txn_id TEXT, -- CHAR(36)
+    status TEXT DEFAULT "P", -- CHAR(1)
+    code TEXT, -- CHAR(8)
+    message TEXT, -- CHAR(80)
+    created TEXT DEFAULT CURRENT_TIMESTAMP, -- DATETIME YEAR TO SECOND DEFAULT CURRENT YEAR TO SECOND
+    updated TEXT DEFAULT CURRENT_TIMESTAMP, -- DATETIME YEAR TO SECOND DEFAULT CURRENT YEAR TO SECOND
+    cid INT,
+
+    UNIQUE (idempotency_key),
+
+    CHECK (amount > 0),
+    CHECK (minutes > 0),
+    CHECK (nid <= 2147483647), -- int32 max value
+    CHECK (operation IN ('A' ,'C' ,'R' )),
+    CHECK (status IN ('A' ,'D' ,'P' )),
+
+    FOREIGN KEY (cid) REFERENCES credits(cid),
+    FOREIGN KEY (uid) REFERENCES accounts(uid)
+) STRICT;
+
+CREATE INDEX IF NOT EXISTS nb_txn_id_idx ON netbanx (txn_id);
+CREATE INDEX IF NOT EXISTS nb_uid_idx ON netbanx (uid);
+
+-- Keep in step with the latest migration in db/migrations.
+PRAGMA user_version = 8;
 
 COMMIT TRANSACTION;
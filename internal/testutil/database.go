@@ -2,9 +2,9 @@
 package testutil
 
 import (
+	"context"
 	"database/sql"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -13,6 +13,8 @@ import (
 	_ "modernc.org/sqlite"
 
 	"github.com/nosborn/ibgames-1999"
+	"github.com/nosborn/ibgames-1999/config"
+	"github.com/nosborn/ibgames-1999/db"
 )
 
 // DatabaseSetup holds references to test database resources.
@@ -28,6 +30,7 @@ func SetupTestDatabase(t *testing.T) *DatabaseSetup {
 	// Create temporary directory for test database
 	tmpDir := t.TempDir()
 	os.Setenv("DBPATH", tmpDir)
+	config.Set(nil) // Load DBPATH again
 
 	// Create the expected database file name
 	dbPath := filepath.Join(tmpDir, "ibgames.sqlite")
@@ -55,40 +58,23 @@ func SetupTestDatabaseWithSchema(t *testing.T) *DatabaseSetup {
 	return setup
 }
 
-// CreateSchema creates the accounts and sessions tables using the production schema file.
+// CreateSchema creates the accounts and sessions tables using the production schema.
 func (d *DatabaseSetup) CreateSchema(t *testing.T) {
-	// Close the Go connection temporarily to avoid conflicts
-	d.TestDB.Close()
-
-	// Find the schema file - try different possible locations
-	schemaPath := "ibgames.sql"
-	if _, err := os.Stat(schemaPath); os.IsNotExist(err) {
-		schemaPath = "../ibgames.sql"
-		if _, err := os.Stat(schemaPath); os.IsNotExist(err) {
-			schemaPath = "../../ibgames.sql"
-			if _, err := os.Stat(schemaPath); os.IsNotExist(err) {
-				require.NoError(t, err, "Could not find ibgames.sql schema file")
-			}
-		}
-	}
+	h, err := db.Open(filepath.Dir(d.FilePath), false)
+	require.NoError(t, err)
 
-	// Use sqlite3 CLI to load the production schema
-	cmd := exec.Command("sqlite3", d.FilePath, ".read "+schemaPath)
-	output, err := cmd.CombinedOutput()
+	err = h.CreateSchema(context.Background())
 	if err != nil {
-		t.Logf("sqlite3 output: %s", string(output))
-		require.NoError(t, err, "Failed to load schema using sqlite3")
+		h.Abandon()
+		require.NoError(t, err, "Failed to create schema")
 	}
-
-	// Reopen the Go connection
-	d.TestDB, err = sql.Open("sqlite", d.FilePath)
-	require.NoError(t, err)
+	require.NoError(t, h.Close())
 }
 
 // CreateTestAccount inserts a test account into the database.
 func (d *DatabaseSetup) CreateTestAccount(t *testing.T, uid ibgames.AccountID, name, complimentary string, minutes int) {
 	// For test accounts, name_key should be lowercase version of name
-	// since UniqueName converts to lowercase and removes non-graphic chars
+	// since accounts.NameKey converts to lowercase and removes non-graphic chars
 	nameKey := strings.ToLower(name)
 	_, err := d.TestDB.Exec(`
 		INSERT INTO accounts (uid, name, name_key, encrypt, complimentary, minutes)
@@ -0,0 +1,258 @@
+package testutil
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// Test card numbers understood by NetbanxServer. Any other number is
+// approved.
+const (
+	ApprovedCard = "4111111111111111"
+	DeclinedCard = "4000000000000002"
+)
+
+// NetbanxServer is an in-process fake of the Netbanx card payments API. Like
+// the real thing, it acts on a merchant reference number only once and
+// refuses any repeat with error 5031, leaving the client to look up the
+// first answer by merchant reference number.
+type NetbanxServer struct {
+	*httptest.Server
+	Account string // Merchant account number
+	APIKey  string // user:password
+	Secret  string // Key that callbacks are signed with
+
+	mu       sync.Mutex
+	replies  map[string]netbanxReply // By merchant reference number
+	amounts  map[string]int64        // Approved amount by transaction ID
+	refunded map[string]int64        // Amount refunded by settlement ID
+	actions  int
+	hang     bool
+	release  chan struct{}
+}
+
+type netbanxReply struct {
+	kind   string // Collection the transaction belongs to, such as "auths"
+	status int
+	body   map[string]any
+}
+
+// NewNetbanxServer starts a fake gateway that is shut down when the test
+// ends.
+func NewNetbanxServer(t *testing.T) *NetbanxServer {
+	s := &NetbanxServer{
+		Account:  "1001",
+		APIKey:   "test:secret",
+		Secret:   "callback-secret",
+		replies:  make(map[string]netbanxReply),
+		amounts:  make(map[string]int64),
+		refunded: make(map[string]int64),
+		release:  make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /cardpayments/v1/accounts/{account}/auths", s.authorise)
+	mux.HandleFunc("POST /cardpayments/v1/accounts/{account}/auths/{id}/settlements", s.settle)
+	mux.HandleFunc("POST /cardpayments/v1/accounts/{account}/settlements/{id}/refunds", s.refund)
+	mux.HandleFunc("GET /cardpayments/v1/accounts/{account}/{kind}", s.lookup)
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(func() {
+		close(s.release) // Let hanging requests go
+		s.Close()
+	})
+	return s
+}
+
+// SetHang makes the server act on requests but never answer them, as if the
+// answer were lost, until SetHang(false).
+func (s *NetbanxServer) SetHang(on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hang = on
+}
+
+// Actions returns how many requests have been acted on. Repeats aren't
+// counted.
+func (s *NetbanxServer) Actions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.actions
+}
+
+// Callback returns the signed callback the gateway would send about the
+// request with merchant reference number ref.
+func (s *NetbanxServer) Callback(ref string) (body []byte, signature string) {
+	s.mu.Lock()
+	reply, ok := s.replies[ref]
+	s.mu.Unlock()
+	if !ok {
+		panic("no request " + ref)
+	}
+	body, err := json.Marshal(reply.body)
+	if err != nil {
+		panic(err)
+	}
+	return body, s.Sign(body)
+}
+
+// Sign returns the signature of a callback body.
+func (s *NetbanxServer) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(s.Secret))
+	mac.Write(body)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+type netbanxRequest struct {
+	MerchantRefNum string `json:"merchantRefNum"`
+	Amount         int64  `json:"amount"`
+	CurrencyCode   string `json:"currencyCode"`
+	Card           *struct {
+		CardNum string `json:"cardNum"`
+	} `json:"card"`
+}
+
+func (s *NetbanxServer) authorise(w http.ResponseWriter, r *http.Request) {
+	s.handle(w, r, "auths", func(req *netbanxRequest) netbanxReply {
+		switch {
+		case req.Card == nil || req.CurrencyCode == "":
+			return s.failed(req, http.StatusBadRequest, "5068", "Field error(s)")
+		case req.Card.CardNum == DeclinedCard:
+			return s.failed(req, http.StatusPaymentRequired, "3009",
+				"Your request has been declined by the issuing bank.")
+		default:
+			return s.completed(req)
+		}
+	})
+}
+
+func (s *NetbanxServer) settle(w http.ResponseWriter, r *http.Request) {
+	s.handle(w, r, "settlements", func(req *netbanxRequest) netbanxReply {
+		authorised, ok := s.amounts[r.PathValue("id")]
+		switch {
+		case !ok:
+			return s.failed(req, http.StatusNotFound, "5269", "The ID(s) specified in the URL do not correspond to the values in the system.")
+		case req.Amount > authorised:
+			return s.failed(req, http.StatusBadRequest, "3406", "The settlement amount exceeds the authorised amount.")
+		default:
+			return s.completed(req)
+		}
+	})
+}
+
+func (s *NetbanxServer) refund(w http.ResponseWriter, r *http.Request) {
+	s.handle(w, r, "refunds", func(req *netbanxRequest) netbanxReply {
+		id := r.PathValue("id")
+		settled, ok := s.amounts[id]
+		switch {
+		case !ok:
+			return s.failed(req, http.StatusNotFound, "5269", "The ID(s) specified in the URL do not correspond to the values in the system.")
+		case s.refunded[id]+req.Amount > settled:
+			return s.failed(req, http.StatusBadRequest, "3407", "The refund amount exceeds the settlement amount.")
+		default:
+			s.refunded[id] += req.Amount
+			return s.completed(req)
+		}
+	})
+}
+
+// authorised checks the credentials, answering the request itself if they are
+// wrong.
+func (s *NetbanxServer) authorised(w http.ResponseWriter, r *http.Request) bool {
+	user, password, _ := r.BasicAuth()
+	if user+":"+password == s.APIKey && r.PathValue("account") == s.Account {
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{"code": "5279", "message": "The authentication credentials are invalid."},
+	})
+	return false
+}
+
+// handle checks the credentials, acts on the request with act unless its
+// merchant reference number has been seen before, and answers it. The
+// transaction made belongs to the collection kind.
+func (s *NetbanxServer) handle(w http.ResponseWriter, r *http.Request, kind string, act func(*netbanxRequest) netbanxReply) {
+	if !s.authorised(w, r) {
+		return
+	}
+	var req netbanxRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MerchantRefNum == "" || req.Amount <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	reply, ok := s.replies[req.MerchantRefNum]
+	if ok {
+		reply = netbanxReply{kind, http.StatusConflict, map[string]any{
+			"error": map[string]any{
+				"code":    "5031",
+				"message": "The transaction you have submitted has already been processed.",
+			},
+		}}
+	} else {
+		s.actions++
+		reply = act(&req)
+		reply.kind = kind
+		s.replies[req.MerchantRefNum] = reply
+	}
+	hang := s.hang
+	s.mu.Unlock()
+
+	if hang {
+		select {
+		case <-r.Context().Done():
+		case <-s.release:
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(reply.status)
+	_ = json.NewEncoder(w).Encode(reply.body)
+}
+
+// lookup answers a search of a collection of transactions by merchant
+// reference number.
+func (s *NetbanxServer) lookup(w http.ResponseWriter, r *http.Request) {
+	if !s.authorised(w, r) {
+		return
+	}
+	kind := r.PathValue("kind")
+	found := []map[string]any{}
+	s.mu.Lock()
+	if reply, ok := s.replies[r.URL.Query().Get("merchantRefNum")]; ok && reply.kind == kind {
+		found = append(found, reply.body)
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{kind: found})
+}
+
+func (s *NetbanxServer) completed(req *netbanxRequest) netbanxReply {
+	id := fmt.Sprintf("nbx-%06d", s.actions)
+	s.amounts[id] = req.Amount
+	return netbanxReply{"", http.StatusOK, map[string]any{
+		"id":             id,
+		"merchantRefNum": req.MerchantRefNum,
+		"amount":         req.Amount,
+		"status":         "COMPLETED",
+	}}
+}
+
+func (s *NetbanxServer) failed(req *netbanxRequest, status int, code, message string) netbanxReply {
+	return netbanxReply{"", status, map[string]any{
+		"id":             fmt.Sprintf("nbx-%06d", s.actions),
+		"merchantRefNum": req.MerchantRefNum,
+		"status":         "FAILED",
+		"error":          map[string]any{"code": code, "message": message},
+	}}
+}
@@ -0,0 +1,81 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrBadSignature is returned for a callback that wasn't signed with the
+// shared secret.
+var ErrBadSignature = errors.New("bad callback signature")
+
+// SignatureHeader holds the base64 HMAC-SHA256 of a callback's body, keyed
+// with the shared secret.
+const SignatureHeader = "Signature"
+
+// Callback is the gateway's notice of how a request turned out. It settles
+// requests whose answer was lost, such as those that timed out.
+type Callback struct {
+	Key string // Idempotency key of the request
+	Result
+}
+
+// VerifySignature checks that signature is the base64 HMAC-SHA256 of body
+// keyed with secret.
+func VerifySignature(secret, body []byte, signature string) error {
+	got, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrBadSignature
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// ParseCallback reads a callback from r and checks its signature. Callbacks
+// with no secret to check them against are refused.
+func ParseCallback(r *http.Request, secret []byte) (*Callback, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("no callback secret")
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifySignature(secret, body, r.Header.Get(SignatureHeader)); err != nil {
+		return nil, err
+	}
+
+	var msg struct {
+		response
+		MerchantRefNum string `json:"merchantRefNum"`
+	}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("callback: %w", err)
+	}
+	if msg.MerchantRefNum == "" {
+		return nil, errors.New("callback: no merchantRefNum")
+	}
+
+	cb := &Callback{Key: msg.MerchantRefNum, Result: Result{ID: msg.ID}}
+	if msg.Error != nil {
+		cb.Code, cb.Message = msg.Error.Code, msg.Error.Message
+	}
+	switch msg.Status {
+	case "COMPLETED":
+		cb.Approved = true
+	case "FAILED":
+	default:
+		return nil, fmt.Errorf("callback: unexpected status %q", msg.Status)
+	}
+	return cb, nil
+}
@@ -0,0 +1,77 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nosborn/ibgames-1999/internal/testutil"
+)
+
+func callbackRequest(body []byte, signature string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/netbanx/callback", bytes.NewReader(body))
+	r.Header.Set(SignatureHeader, signature)
+	return r
+}
+
+func TestParseCallback(t *testing.T) {
+	ctx := context.Background()
+	c, srv := newTestClient(t)
+	secret := []byte(srv.Secret)
+
+	approved := testAuthorisation(testutil.ApprovedCard, 1995)
+	result, err := c.Authorise(ctx, approved)
+	require.NoError(t, err)
+	declined := testAuthorisation(testutil.DeclinedCard, 1995)
+	_, err = c.Authorise(ctx, declined)
+	require.NoError(t, err)
+
+	t.Run("approved", func(t *testing.T) {
+		cb, err := ParseCallback(callbackRequest(srv.Callback(approved.Key)), secret)
+		require.NoError(t, err)
+		assert.Equal(t, &Callback{Key: approved.Key, Result: *result}, cb)
+	})
+
+	t.Run("declined", func(t *testing.T) {
+		cb, err := ParseCallback(callbackRequest(srv.Callback(declined.Key)), secret)
+		require.NoError(t, err)
+		assert.Equal(t, declined.Key, cb.Key)
+		assert.False(t, cb.Approved)
+		assert.Equal(t, "3009", cb.Code)
+	})
+
+	t.Run("bad signatures", func(t *testing.T) {
+		body, signature := srv.Callback(approved.Key)
+
+		_, err := ParseCallback(callbackRequest(body, signature), []byte("wrong secret"))
+		require.ErrorIs(t, err, ErrBadSignature)
+
+		tampered := bytes.Replace(body, []byte("COMPLETED"), []byte("FAILED"), 1)
+		_, err = ParseCallback(callbackRequest(tampered, signature), secret)
+		require.ErrorIs(t, err, ErrBadSignature)
+
+		_, err = ParseCallback(callbackRequest(body, ""), secret)
+		require.ErrorIs(t, err, ErrBadSignature)
+		_, err = ParseCallback(callbackRequest(body, "not base64!"), secret)
+		require.ErrorIs(t, err, ErrBadSignature)
+
+		_, err = ParseCallback(callbackRequest(body, signature), nil)
+		require.Error(t, err)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		for _, body := range []string{
+			`not json`,
+			`{"id": "nbx-1", "status": "COMPLETED"}`,
+			`{"id": "nbx-1", "merchantRefNum": "k", "status": "RECEIVED"}`,
+		} {
+			_, err := ParseCallback(callbackRequest([]byte(body), srv.Sign([]byte(body))), secret)
+			require.Error(t, err, body)
+		}
+	})
+}
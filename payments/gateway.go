@@ -0,0 +1,77 @@
+// Package payments takes card payments through a payment gateway and keeps a
+// record of every request in the netbanx table.
+//
+// A payment is authorised, which reserves the money on the card, and then
+// captured, which takes it. Captured payments can be refunded. Every request
+// carries an idempotency key, and the gateway acts on a key only once, so a
+// request whose outcome wasn't heard can safely be sent again with the same
+// key.
+package payments
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+)
+
+// ErrTimeout is returned when the gateway doesn't answer in time. The
+// request may or may not have been acted on.
+var ErrTimeout = errors.New("payment gateway timed out")
+
+// Card is the card an authorisation is charged to. Only the last four digits
+// of the number are ever stored.
+type Card struct {
+	Number string
+	Month  int // Expiry month, 1 to 12
+	Year   int // Expiry year, such as 2001
+	CVV    string
+	Holder string
+}
+
+// Last4 returns the last four digits of the card number.
+func (c *Card) Last4() string {
+	if len(c.Number) < 4 {
+		return c.Number
+	}
+	return c.Number[len(c.Number)-4:]
+}
+
+// Authorisation asks the gateway to reserve an amount on a card.
+type Authorisation struct {
+	Key      string // Idempotency key
+	Amount   int64  // In minor units of Currency
+	Currency string // ISO 4217 code, such as USD
+	Card     Card
+}
+
+// Result is the gateway's answer to a request. A declined request is a
+// Result, not an error.
+type Result struct {
+	ID       string // Gateway's transaction ID
+	Approved bool
+	Code     string // Gateway's reason for a decline
+	Message  string
+}
+
+// Gateway is a card payment gateway. Its methods return an error only when
+// there is no definite answer, in which case the request may be sent again
+// with the same key.
+type Gateway interface {
+	// Authorise reserves a.Amount on a.Card.
+	Authorise(ctx context.Context, a *Authorisation) (*Result, error)
+
+	// Capture takes amount, which mustn't be more than was authorised, from
+	// the authorisation authID.
+	Capture(ctx context.Context, key, authID string, amount int64) (*Result, error)
+
+	// Refund returns amount of the capture captureID to the card.
+	Refund(ctx context.Context, key, captureID string, amount int64) (*Result, error)
+}
+
+// NewKey returns a new random idempotency key.
+func NewKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b) // Never fails
+	return hex.EncodeToString(b)
+}
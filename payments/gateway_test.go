@@ -0,0 +1,18 @@
+package payments
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewKey(t *testing.T) {
+	a, b := NewKey(), NewKey()
+	assert.Len(t, a, 32)
+	assert.NotEqual(t, a, b)
+}
+
+func TestCardLast4(t *testing.T) {
+	assert.Equal(t, "1111", (&Card{Number: "4111111111111111"}).Last4())
+	assert.Equal(t, "12", (&Card{Number: "12"}).Last4())
+}
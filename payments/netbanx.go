@@ -0,0 +1,214 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nosborn/ibgames-1999/config"
+)
+
+// Client is a Gateway that talks to the Netbanx card payments API. The
+// idempotency key is sent as the merchant reference number, which Netbanx
+// refuses to act on twice. When it refuses a repeat, the client looks up the
+// transaction the reference number was first used for and returns its
+// outcome instead.
+type Client struct {
+	URL     string       // Base URL, such as https://api.netbanx.com
+	Account string       // Merchant account number
+	APIKey  string       // user:password
+	HTTP    *http.Client // Used for every request
+}
+
+// NewClient returns a client for the gateway at baseURL that gives up on a
+// request after 30 seconds.
+func NewClient(baseURL, account, apiKey string) *Client {
+	return &Client{
+		URL:     strings.TrimSuffix(baseURL, "/"),
+		Account: account,
+		APIKey:  apiKey,
+		HTTP:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// NewClientFromConfig is like NewClient but takes the gateway's details from
+// c.
+func NewClientFromConfig(c *config.Config) (*Client, error) {
+	if c.NetbanxURL == "" || c.NetbanxAccount == "" || c.NetbanxAPIKey == "" {
+		return nil, errors.New("netbanx_url, netbanx_account and netbanx_api_key must be set")
+	}
+	return NewClient(c.NetbanxURL, c.NetbanxAccount, c.NetbanxAPIKey), nil
+}
+
+type cardExpiry struct {
+	Month int `json:"month"`
+	Year  int `json:"year"`
+}
+
+type card struct {
+	CardNum    string     `json:"cardNum"`
+	CardExpiry cardExpiry `json:"cardExpiry"`
+	CVV        string     `json:"cvv,omitempty"`
+	HolderName string     `json:"holderName,omitempty"`
+}
+
+type request struct {
+	MerchantRefNum string `json:"merchantRefNum"`
+	Amount         int64  `json:"amount"`
+	CurrencyCode   string `json:"currencyCode,omitempty"`
+	Card           *card  `json:"card,omitempty"`
+}
+
+// duplicateRefCode is the error Netbanx gives for a merchant reference number
+// that has already been used.
+const duplicateRefCode = "5031"
+
+type response struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// Authorise implements Gateway.
+func (c *Client) Authorise(ctx context.Context, a *Authorisation) (*Result, error) {
+	return c.post(ctx, "auths", "auths", &request{
+		MerchantRefNum: a.Key,
+		Amount:         a.Amount,
+		CurrencyCode:   a.Currency,
+		Card: &card{
+			CardNum:    a.Card.Number,
+			CardExpiry: cardExpiry{Month: a.Card.Month, Year: a.Card.Year},
+			CVV:        a.Card.CVV,
+			HolderName: a.Card.Holder,
+		},
+	})
+}
+
+// Capture implements Gateway.
+func (c *Client) Capture(ctx context.Context, key, authID string, amount int64) (*Result, error) {
+	return c.post(ctx, "auths/"+url.PathEscape(authID)+"/settlements", "settlements", &request{
+		MerchantRefNum: key,
+		Amount:         amount,
+	})
+}
+
+// Refund implements Gateway.
+func (c *Client) Refund(ctx context.Context, key, captureID string, amount int64) (*Result, error) {
+	return c.post(ctx, "settlements/"+url.PathEscape(captureID)+"/refunds", "refunds", &request{
+		MerchantRefNum: key,
+		Amount:         amount,
+	})
+}
+
+// post sends body to path. If the gateway says the merchant reference number
+// has been used before, the outcome of the first request is looked up in
+// lookup, the collection of transactions that path adds to.
+func (c *Client) post(ctx context.Context, path, lookup string, body *request) (*Result, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	status, data, err := c.do(ctx, http.MethodPost, path, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	var r response
+	if err := json.Unmarshal(data, &r); err != nil && status < 400 {
+		return nil, fmt.Errorf("payment gateway: %s: %w", http.StatusText(status), err)
+	}
+	if r.Error != nil && r.Error.Code == duplicateRefCode {
+		return c.lookup(ctx, lookup, body.MerchantRefNum)
+	}
+	return result(status, &r)
+}
+
+// lookup returns the outcome of the transaction in collection with merchant
+// reference number ref.
+func (c *Client) lookup(ctx context.Context, collection, ref string) (*Result, error) {
+	status, data, err := c.do(ctx, http.MethodGet, collection+"?merchantRefNum="+url.QueryEscape(ref), nil)
+	if err != nil {
+		return nil, err
+	}
+	if status >= 400 {
+		return nil, fmt.Errorf("payment gateway: looking up %s: %s", ref, http.StatusText(status))
+	}
+	var found map[string][]response
+	if err := json.Unmarshal(data, &found); err != nil {
+		return nil, fmt.Errorf("payment gateway: looking up %s: %w", ref, err)
+	}
+	if len(found[collection]) == 0 {
+		return nil, fmt.Errorf("payment gateway: no %s with merchantRefNum %s", collection, ref)
+	}
+	return result(http.StatusOK, &found[collection][0])
+}
+
+// do sends a request to path under the merchant account and returns the
+// response's status code and body. A server error is returned as an error,
+// since the request may or may not have been acted on.
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader) (int, []byte, error) {
+	u := c.URL + "/cardpayments/v1/accounts/" + url.PathEscape(c.Account) + "/" + path
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(c.APIKey)))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		var ne net.Error
+		if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &ne) && ne.Timeout() {
+			return 0, nil, fmt.Errorf("%w: %w", ErrTimeout, err)
+		}
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, nil, err
+	}
+	if resp.StatusCode >= 500 {
+		return 0, nil, fmt.Errorf("payment gateway: %s", resp.Status)
+	}
+	return resp.StatusCode, data, nil
+}
+
+// result turns the gateway's answer r, which came with HTTP status code
+// status, into a Result.
+func result(status int, r *response) (*Result, error) {
+	// Anything else the gateway refuses, such as a malformed card number,
+	// counts as a decline: sending it again won't help.
+	result := &Result{ID: r.ID}
+	if r.Error != nil {
+		result.Code, result.Message = r.Error.Code, r.Error.Message
+	}
+	switch {
+	case status >= 400:
+		if result.Code == "" {
+			result.Code = fmt.Sprint(status)
+		}
+		return result, nil
+	case r.Status == "COMPLETED":
+		result.Approved = true
+		return result, nil
+	case r.Status == "FAILED":
+		return result, nil
+	default:
+		return nil, fmt.Errorf("payment gateway: unexpected status %q", r.Status)
+	}
+}
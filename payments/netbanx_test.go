@@ -0,0 +1,159 @@
+package payments
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nosborn/ibgames-1999/config"
+	"github.com/nosborn/ibgames-1999/internal/testutil"
+)
+
+func newTestClient(t *testing.T) (*Client, *testutil.NetbanxServer) {
+	srv := testutil.NewNetbanxServer(t)
+	c := NewClient(srv.URL+"/", srv.Account, srv.APIKey)
+	c.HTTP.Timeout = 200 * time.Millisecond
+	return c, srv
+}
+
+func testAuthorisation(number string, amount int64) *Authorisation {
+	return &Authorisation{
+		Key:      NewKey(),
+		Amount:   amount,
+		Currency: "USD",
+		Card:     Card{Number: number, Month: 12, Year: 2001, CVV: "123", Holder: "A Player"},
+	}
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	c, srv := newTestClient(t)
+
+	t.Run("approval, capture and refund", func(t *testing.T) {
+		auth, err := c.Authorise(ctx, testAuthorisation(testutil.ApprovedCard, 1995))
+		require.NoError(t, err)
+		assert.True(t, auth.Approved)
+		assert.NotEmpty(t, auth.ID)
+
+		capture, err := c.Capture(ctx, NewKey(), auth.ID, 1995)
+		require.NoError(t, err)
+		assert.True(t, capture.Approved)
+
+		refund, err := c.Refund(ctx, NewKey(), capture.ID, 995)
+		require.NoError(t, err)
+		assert.True(t, refund.Approved)
+
+		refund, err = c.Refund(ctx, NewKey(), capture.ID, 1001)
+		require.NoError(t, err)
+		assert.False(t, refund.Approved)
+		assert.Equal(t, "3407", refund.Code)
+	})
+
+	t.Run("decline", func(t *testing.T) {
+		result, err := c.Authorise(ctx, testAuthorisation(testutil.DeclinedCard, 1995))
+		require.NoError(t, err)
+		assert.False(t, result.Approved)
+		assert.Equal(t, "3009", result.Code)
+		assert.Contains(t, result.Message, "declined")
+	})
+
+	t.Run("repeated key", func(t *testing.T) {
+		a := testAuthorisation(testutil.ApprovedCard, 500)
+		first, err := c.Authorise(ctx, a)
+		require.NoError(t, err)
+		before := srv.Actions()
+
+		// The gateway refuses the repeat, so the client looks up the
+		// first answer.
+		again, err := c.Authorise(ctx, a)
+		require.NoError(t, err)
+		assert.Equal(t, first, again)
+		assert.Equal(t, before, srv.Actions())
+
+		declined := testAuthorisation(testutil.DeclinedCard, 500)
+		first, err = c.Authorise(ctx, declined)
+		require.NoError(t, err)
+		again, err = c.Authorise(ctx, declined)
+		require.NoError(t, err)
+		assert.Equal(t, first, again)
+		assert.Equal(t, "3009", again.Code)
+
+		key := NewKey()
+		first, err = c.Refund(ctx, key, again.ID, 1)
+		require.NoError(t, err)
+		again, err = c.Refund(ctx, key, again.ID, 1)
+		require.NoError(t, err)
+		assert.Equal(t, first, again)
+	})
+
+	t.Run("repeated key that can't be found", func(t *testing.T) {
+		forgetful := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet {
+				_, _ = w.Write([]byte(`{"auths": []}`))
+				return
+			}
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write([]byte(`{"error": {"code": "5031", "message": "Already processed."}}`))
+		}))
+		defer forgetful.Close()
+
+		_, err := NewClient(forgetful.URL, "1001", "x:y").Authorise(ctx, testAuthorisation(testutil.ApprovedCard, 500))
+		require.ErrorContains(t, err, "no auths")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		srv.SetHang(true)
+		defer srv.SetHang(false)
+
+		_, err := c.Authorise(ctx, testAuthorisation(testutil.ApprovedCard, 500))
+		require.ErrorIs(t, err, ErrTimeout)
+	})
+
+	t.Run("bad credentials", func(t *testing.T) {
+		bad := NewClient(srv.URL, srv.Account, "test:wrong")
+		result, err := bad.Authorise(ctx, testAuthorisation(testutil.ApprovedCard, 500))
+		require.NoError(t, err)
+		assert.False(t, result.Approved)
+		assert.Equal(t, "5279", result.Code)
+	})
+
+	t.Run("refusal without a body", func(t *testing.T) {
+		refuse := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer refuse.Close()
+
+		result, err := NewClient(refuse.URL, "1001", "x:y").Authorise(ctx, testAuthorisation(testutil.ApprovedCard, 500))
+		require.NoError(t, err)
+		assert.False(t, result.Approved)
+		assert.Equal(t, "403", result.Code)
+	})
+
+	t.Run("server error", func(t *testing.T) {
+		broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer broken.Close()
+
+		_, err := NewClient(broken.URL, "1001", "x:y").Authorise(ctx, testAuthorisation(testutil.ApprovedCard, 500))
+		require.ErrorContains(t, err, "502")
+	})
+}
+
+func TestNewClientFromConfig(t *testing.T) {
+	cfg := config.Default()
+	_, err := NewClientFromConfig(cfg)
+	require.Error(t, err)
+
+	cfg.NetbanxURL = "https://api.test.netbanx.com/"
+	cfg.NetbanxAccount = "1001"
+	cfg.NetbanxAPIKey = "user:secret"
+	c, err := NewClientFromConfig(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "https://api.test.netbanx.com", c.URL)
+}
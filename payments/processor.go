@@ -0,0 +1,383 @@
+package payments
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nosborn/ibgames-1999"
+	"github.com/nosborn/ibgames-1999/billing"
+	"github.com/nosborn/ibgames-1999/db"
+)
+
+// ErrNotFound is returned when there is no transaction with a key.
+var ErrNotFound = errors.New("transaction not found")
+
+// ErrUncommitted is returned by the Processor methods when their handle has
+// uncommitted work, which they would otherwise commit or roll back.
+var ErrUncommitted = errors.New("payments handle has uncommitted work")
+
+// ErrKeyReused is returned when an idempotency key that has already been used
+// comes with a different request.
+var ErrKeyReused = errors.New("idempotency key already used for a different request")
+
+// Operation is the kind of request a transaction records. The values are the
+// characters stored in netbanx.operation.
+type Operation byte
+
+const (
+	OpAuthorise Operation = 'A'
+	OpCapture   Operation = 'C'
+	OpRefund    Operation = 'R'
+)
+
+func (o Operation) String() string {
+	switch o {
+	case OpAuthorise:
+		return "authorise"
+	case OpCapture:
+		return "capture"
+	case OpRefund:
+		return "refund"
+	default:
+		return "Operation(" + strconv.Quote(string(rune(o))) + ")"
+	}
+}
+
+// Status is how a transaction turned out. The values are the characters
+// stored in netbanx.status.
+type Status byte
+
+const (
+	Pending  Status = 'P' // No answer from the gateway yet
+	Approved Status = 'A'
+	Declined Status = 'D'
+)
+
+func (s Status) String() string {
+	switch s {
+	case Pending:
+		return "pending"
+	case Approved:
+		return "approved"
+	case Declined:
+		return "declined"
+	default:
+		return "Status(" + strconv.Quote(string(rune(s))) + ")"
+	}
+}
+
+// Transaction is one request to the gateway, a row of the netbanx table.
+type Transaction struct {
+	ID        int64
+	Key       string // Idempotency key
+	UID       ibgames.AccountID
+	Operation Operation
+	Amount    int64  // In minor units of Currency
+	Currency  string // ISO 4217 code, such as USD
+	Minutes   int    // Credited to the account when a capture is approved
+	CardLast4 string
+	ParentID  string // Gateway ID of the authorisation captured or the capture refunded
+	GatewayID string // Gateway's transaction ID
+	Status    Status
+	Code      string // Gateway's reason for a decline
+	Message   string // Gateway's message, or why a transaction is still pending
+	CreditID  int64  // Credit made for an approved capture
+	Created   time.Time
+	Updated   time.Time
+}
+
+const columns = `
+	nid, idempotency_key, uid, operation, amount, currency, COALESCE(minutes, 0),
+	COALESCE(card_last4, ''), COALESCE(parent_id, ''), COALESCE(txn_id, ''),
+	status, COALESCE(code, ''), COALESCE(message, ''), created, updated,
+	COALESCE(cid, 0)`
+
+// Get returns the transaction with idempotency key key, or ErrNotFound.
+func Get(ctx context.Context, h *db.Handle, key string) (*Transaction, error) {
+	var (
+		t                 Transaction
+		operation, status string
+		created, updated  string
+	)
+	err := h.QueryRowContext(ctx, "SELECT "+columns+" FROM netbanx WHERE idempotency_key = ?", key).Scan(
+		&t.ID, &t.Key, &t.UID, &operation, &t.Amount, &t.Currency, &t.Minutes,
+		&t.CardLast4, &t.ParentID, &t.GatewayID,
+		&status, &t.Code, &t.Message, &created, &updated,
+		&t.CreditID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(operation) == 1 {
+		t.Operation = Operation(operation[0])
+	}
+	if len(status) == 1 {
+		t.Status = Status(status[0])
+	}
+	if t.Created, err = time.Parse(time.DateTime, created); err != nil {
+		return nil, fmt.Errorf("transaction %d: %w", t.ID, err)
+	}
+	if t.Updated, err = time.Parse(time.DateTime, updated); err != nil {
+		return nil, fmt.Errorf("transaction %d: %w", t.ID, err)
+	}
+	return &t, nil
+}
+
+// Processor sends requests to a gateway and records them in the netbanx
+// table of a database.
+//
+// Each request is recorded and committed before it is sent, and its outcome
+// is committed as soon as it is known, so the methods commit and roll back h's
+// auto-transaction. h must therefore be a handle of the processor's own, not
+// one shared with other work such as db.Default(); a method called while h
+// has uncommitted work fails with ErrUncommitted and leaves it alone. A
+// request that gets no answer is left pending. Making
+// the same request again with the same key sends it again, and the gateway
+// gives the answer to the first attempt without acting twice. A request that
+// has already been answered isn't sent again; the recorded transaction is
+// returned instead.
+type Processor struct {
+	gateway Gateway
+	h       *db.Handle
+}
+
+// NewProcessor returns a processor that sends requests to gateway and
+// records them in h, which it must have to itself.
+func NewProcessor(gateway Gateway, h *db.Handle) *Processor {
+	return &Processor{gateway: gateway, h: h}
+}
+
+// Authorise reserves an amount on a card for account uid.
+func (p *Processor) Authorise(ctx context.Context, uid ibgames.AccountID, a *Authorisation) (*Transaction, error) {
+	t, done, err := p.begin(ctx, &Transaction{
+		Key:       a.Key,
+		UID:       uid,
+		Operation: OpAuthorise,
+		Amount:    a.Amount,
+		Currency:  a.Currency,
+		CardLast4: a.Card.Last4(),
+	})
+	if err != nil || done {
+		return t, err
+	}
+	result, err := p.gateway.Authorise(ctx, a)
+	return p.finish(ctx, t, result, err)
+}
+
+// Capture takes the whole of the approved authorisation auth and, once the
+// gateway approves, credits minutes to the account in the same transaction
+// as the capture is recorded. If the credit can't be made, the capture is
+// left pending so that it can be tried again.
+func (p *Processor) Capture(ctx context.Context, key string, auth *Transaction, minutes int) (*Transaction, error) {
+	if auth.Operation != OpAuthorise || auth.Status != Approved {
+		return nil, fmt.Errorf("transaction %d isn't an approved authorisation", auth.ID)
+	}
+	t, done, err := p.begin(ctx, &Transaction{
+		Key:       key,
+		UID:       auth.UID,
+		Operation: OpCapture,
+		Amount:    auth.Amount,
+		Currency:  auth.Currency,
+		Minutes:   minutes,
+		CardLast4: auth.CardLast4,
+		ParentID:  auth.GatewayID,
+	})
+	if err != nil || done {
+		return t, err
+	}
+	result, err := p.gateway.Capture(ctx, key, auth.GatewayID, auth.Amount)
+	return p.finish(ctx, t, result, err)
+}
+
+// Refund returns amount of the approved capture capture to the card. The
+// minutes credited for the capture are left alone.
+func (p *Processor) Refund(ctx context.Context, key string, capture *Transaction, amount int64) (*Transaction, error) {
+	if capture.Operation != OpCapture || capture.Status != Approved {
+		return nil, fmt.Errorf("transaction %d isn't an approved capture", capture.ID)
+	}
+	if amount <= 0 || amount > capture.Amount {
+		return nil, fmt.Errorf("can't refund %d of %d", amount, capture.Amount)
+	}
+	t, done, err := p.begin(ctx, &Transaction{
+		Key:       key,
+		UID:       capture.UID,
+		Operation: OpRefund,
+		Amount:    amount,
+		Currency:  capture.Currency,
+		CardLast4: capture.CardLast4,
+		ParentID:  capture.GatewayID,
+	})
+	if err != nil || done {
+		return t, err
+	}
+	result, err := p.gateway.Refund(ctx, key, capture.GatewayID, amount)
+	return p.finish(ctx, t, result, err)
+}
+
+// HandleCallback settles the pending transaction that cb is about. A
+// callback about a transaction that is already settled is ignored if it
+// agrees with the recorded outcome.
+func (p *Processor) HandleCallback(ctx context.Context, cb *Callback) (*Transaction, error) {
+	if p.h.Uncommitted() {
+		return nil, ErrUncommitted
+	}
+	t, err := Get(ctx, p.h, cb.Key)
+	if err != nil {
+		return nil, err
+	}
+	switch t.Status {
+	case Pending:
+		return p.finish(ctx, t, &cb.Result, nil)
+	case Approved, Declined:
+		if (t.Status == Approved) != cb.Approved || t.GatewayID != cb.ID {
+			return t, fmt.Errorf("transaction %d: callback disagrees with recorded outcome %v", t.ID, t.Status)
+		}
+		return t, nil
+	default:
+		return nil, fmt.Errorf("transaction %d: bad status %v", t.ID, t.Status)
+	}
+}
+
+// begin records t as pending and commits it, unless its key has been used
+// before. It returns the recorded transaction and whether it has already been
+// answered.
+func (p *Processor) begin(ctx context.Context, t *Transaction) (*Transaction, bool, error) {
+	if p.h.Uncommitted() {
+		return nil, false, ErrUncommitted
+	}
+
+	// Another process making the same request at the same time may record
+	// it first. Its row either makes the insert fail, or, if it was
+	// committed after this transaction's snapshot, makes it busy and
+	// RunInTx looks again.
+	var old *Transaction
+	_, err := p.h.RunInTxContext(ctx, func() error {
+		var err error
+		old, err = Get(ctx, p.h, t.Key)
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		_, err = p.h.ExecContext(ctx, `
+			INSERT INTO netbanx (idempotency_key, uid, operation, amount, currency, minutes,
+				card_last4, parent_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			t.Key, t.UID, string(rune(t.Operation)), t.Amount, t.Currency, nullInt(t.Minutes),
+			nullString(t.CardLast4), nullString(t.ParentID))
+		return err
+	})
+	if err != nil {
+		_ = p.h.RollbackContext(ctx)
+		if !db.IsUniqueViolation(err) {
+			return nil, false, err
+		}
+		if old, err = Get(ctx, p.h, t.Key); err != nil {
+			return nil, false, err
+		}
+	}
+	if old != nil {
+		return existing(t, old)
+	}
+	t, err = Get(ctx, p.h, t.Key)
+	return t, false, err
+}
+
+// existing returns old, the transaction already recorded with t's key, and
+// whether it has been answered. It is an error if t isn't the same request.
+func existing(t, old *Transaction) (*Transaction, bool, error) {
+	if old.UID != t.UID || old.Operation != t.Operation || old.Amount != t.Amount ||
+		old.Currency != t.Currency || old.ParentID != t.ParentID {
+		return nil, false, fmt.Errorf("%s: %w", t.Key, ErrKeyReused)
+	}
+	return old, old.Status != Pending, nil
+}
+
+// finish records the gateway's answer to t and commits it. If there was no
+// answer, t is left pending with callErr as its message. Another process
+// retrying the same request may record its answer first; then nothing is
+// changed and the transaction as that process recorded it is returned.
+func (p *Processor) finish(ctx context.Context, t *Transaction, result *Result, callErr error) (*Transaction, error) {
+	if callErr != nil {
+		_, err := p.h.ExecContext(ctx, `
+			UPDATE netbanx
+			SET message = ?, updated = CURRENT_TIMESTAMP
+			WHERE nid = ? AND status = 'P'`, callErr.Error(), t.ID)
+		if err == nil {
+			err = p.h.CommitContext(ctx)
+		}
+		if err != nil {
+			_ = p.h.RollbackContext(ctx)
+			return t, errors.Join(callErr, err)
+		}
+		return t, callErr
+	}
+
+	status := Declined
+	if result.Approved {
+		status = Approved
+	}
+	// The status is changed first, so that only the process that settles
+	// the transaction credits the minutes.
+	_, err := p.h.RunInTxContext(ctx, func() error {
+		return p.h.WithSavepointContext(ctx, "netbanx_finish", func() error {
+			settled, err := p.h.ExecContext(ctx, `
+				UPDATE netbanx
+				SET txn_id = ?, status = ?, code = ?, message = ?,
+					updated = CURRENT_TIMESTAMP
+				WHERE nid = ? AND status = 'P'`,
+				nullString(result.ID), string(rune(status)), nullString(result.Code),
+				nullString(result.Message), t.ID)
+			if err != nil {
+				return err
+			}
+			rows, err := settled.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if rows != 1 {
+				return nil // Another process settled it first.
+			}
+
+			if status != Approved || t.Operation != OpCapture || t.Minutes <= 0 {
+				return nil
+			}
+			c := &billing.Credit{
+				UID:       t.UID,
+				Minutes:   t.Minutes,
+				Price:     t.Amount,
+				Currency:  t.Currency,
+				Method:    billing.PaidByCard,
+				Reference: result.ID,
+			}
+			if err := billing.Purchase(ctx, p.h, c); err != nil {
+				return err
+			}
+			_, err = p.h.ExecContext(ctx, "UPDATE netbanx SET cid = ? WHERE nid = ?", c.ID, t.ID)
+			return err
+		})
+	})
+	if err != nil {
+		_ = p.h.RollbackContext(ctx)
+		return t, err
+	}
+	return Get(ctx, p.h, t.Key)
+}
+
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func nullInt(n int) any {
+	if n == 0 {
+		return nil
+	}
+	return n
+}
@@ -0,0 +1,243 @@
+package payments
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nosborn/ibgames-1999/billing"
+	"github.com/nosborn/ibgames-1999/db"
+	"github.com/nosborn/ibgames-1999/internal/testutil"
+)
+
+func setupProcessorTest(t *testing.T) (*testutil.DatabaseSetup, *testutil.NetbanxServer, *Processor) {
+	setup := testutil.SetupTestDatabaseWithSchema(t)
+	h, err := db.Open(filepath.Dir(setup.FilePath), false)
+	require.NoError(t, err)
+	t.Cleanup(h.Abandon)
+
+	c, srv := newTestClient(t)
+	setup.CreateTestAccount(t, 666490, "Player", "N", 10)
+	return setup, srv, NewProcessor(c, h)
+}
+
+func accountMinutes(t *testing.T, setup *testutil.DatabaseSetup) int {
+	var minutes int
+	require.NoError(t, setup.TestDB.QueryRow("SELECT minutes FROM accounts WHERE uid = 666490").Scan(&minutes))
+	return minutes
+}
+
+func TestProcessor(t *testing.T) {
+	ctx := context.Background()
+	setup, srv, p := setupProcessorTest(t)
+
+	t.Run("authorise, capture and refund", func(t *testing.T) {
+		auth, err := p.Authorise(ctx, 666490, testAuthorisation(testutil.ApprovedCard, 1995))
+		require.NoError(t, err)
+		assert.Equal(t, Approved, auth.Status)
+		assert.Equal(t, "1111", auth.CardLast4)
+		assert.NotEmpty(t, auth.GatewayID)
+
+		capture, err := p.Capture(ctx, NewKey(), auth, 600)
+		require.NoError(t, err)
+		assert.Equal(t, Approved, capture.Status)
+		assert.Equal(t, auth.GatewayID, capture.ParentID)
+		assert.Equal(t, 610, accountMinutes(t, setup))
+
+		credits, err := billing.CreditHistory(ctx, p.h, 666490)
+		require.NoError(t, err)
+		require.Len(t, credits, 1)
+		assert.Equal(t, capture.CreditID, credits[0].ID)
+		assert.Equal(t, int64(1995), credits[0].Price)
+		assert.Equal(t, billing.PaidByCard, credits[0].Method)
+		assert.Equal(t, capture.GatewayID, credits[0].Reference)
+
+		refund, err := p.Refund(ctx, NewKey(), capture, 995)
+		require.NoError(t, err)
+		assert.Equal(t, Approved, refund.Status)
+		assert.Equal(t, 610, accountMinutes(t, setup)) // Minutes aren't taken back
+
+		_, err = p.Refund(ctx, NewKey(), capture, 1996)
+		require.Error(t, err)
+		_, err = p.Refund(ctx, NewKey(), auth, 1)
+		require.Error(t, err)
+	})
+
+	t.Run("decline", func(t *testing.T) {
+		auth, err := p.Authorise(ctx, 666490, testAuthorisation(testutil.DeclinedCard, 1995))
+		require.NoError(t, err)
+		assert.Equal(t, Declined, auth.Status)
+		assert.Equal(t, "3009", auth.Code)
+
+		_, err = p.Capture(ctx, NewKey(), auth, 600)
+		require.Error(t, err)
+	})
+
+	t.Run("answered requests aren't sent again", func(t *testing.T) {
+		a := testAuthorisation(testutil.ApprovedCard, 500)
+		first, err := p.Authorise(ctx, 666490, a)
+		require.NoError(t, err)
+		before := srv.Actions()
+
+		again, err := p.Authorise(ctx, 666490, a)
+		require.NoError(t, err)
+		assert.Equal(t, first, again)
+		assert.Equal(t, before, srv.Actions())
+
+		a.Amount = 600
+		_, err = p.Authorise(ctx, 666490, a)
+		require.ErrorIs(t, err, ErrKeyReused)
+	})
+
+	t.Run("timeout leaves transaction pending until retried", func(t *testing.T) {
+		auth, err := p.Authorise(ctx, 666490, testAuthorisation(testutil.ApprovedCard, 995))
+		require.NoError(t, err)
+		minutes := accountMinutes(t, setup)
+
+		key := NewKey()
+		srv.SetHang(true)
+		capture, err := p.Capture(ctx, key, auth, 300)
+		srv.SetHang(false)
+		require.ErrorIs(t, err, ErrTimeout)
+		assert.Equal(t, Pending, capture.Status)
+
+		saved, err := Get(ctx, p.h, key)
+		require.NoError(t, err)
+		assert.Equal(t, Pending, saved.Status)
+		assert.Contains(t, saved.Message, "timed out")
+		assert.Equal(t, minutes, accountMinutes(t, setup))
+		actions := srv.Actions()
+
+		// The gateway took the money the first time, so the retry gets the
+		// same answer without charging the card again.
+		capture, err = p.Capture(ctx, key, auth, 300)
+		require.NoError(t, err)
+		assert.Equal(t, Approved, capture.Status)
+		assert.Equal(t, actions, srv.Actions())
+		assert.Equal(t, minutes+300, accountMinutes(t, setup))
+	})
+
+	t.Run("callback settles pending transaction", func(t *testing.T) {
+		a := testAuthorisation(testutil.ApprovedCard, 995)
+		srv.SetHang(true)
+		_, err := p.Authorise(ctx, 666490, a)
+		srv.SetHang(false)
+		require.ErrorIs(t, err, ErrTimeout)
+
+		cb, err := ParseCallback(callbackRequest(srv.Callback(a.Key)), []byte(srv.Secret))
+		require.NoError(t, err)
+		auth, err := p.HandleCallback(ctx, cb)
+		require.NoError(t, err)
+		assert.Equal(t, Approved, auth.Status)
+		assert.Equal(t, cb.ID, auth.GatewayID)
+
+		// Repeats are harmless, but contradictions aren't.
+		_, err = p.HandleCallback(ctx, cb)
+		require.NoError(t, err)
+		cb.Approved = false
+		_, err = p.HandleCallback(ctx, cb)
+		require.Error(t, err)
+
+		_, err = p.HandleCallback(ctx, &Callback{Key: "unknown"})
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("capture is left pending if the credit fails", func(t *testing.T) {
+		a := testAuthorisation(testutil.ApprovedCard, 995)
+		a.Currency = "CAD" // No exchange rate
+		auth, err := p.Authorise(ctx, 666490, a)
+		require.NoError(t, err)
+
+		key := NewKey()
+		_, err = p.Capture(ctx, key, auth, 300)
+		require.ErrorIs(t, err, billing.ErrNoRate)
+		capture, err := Get(ctx, p.h, key)
+		require.NoError(t, err)
+		assert.Equal(t, Pending, capture.Status)
+	})
+}
+
+func TestProcessorHandle(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("refuses a handle with uncommitted work", func(t *testing.T) {
+		setup, _, p := setupProcessorTest(t)
+		_, err := p.h.Exec("UPDATE accounts SET minutes = 20 WHERE uid = 666490")
+		require.NoError(t, err)
+
+		_, err = p.Authorise(ctx, 666490, testAuthorisation(testutil.ApprovedCard, 995))
+		require.ErrorIs(t, err, ErrUncommitted)
+		_, err = p.HandleCallback(ctx, &Callback{Key: "unknown"})
+		require.ErrorIs(t, err, ErrUncommitted)
+
+		// The work is neither committed nor lost.
+		assert.Equal(t, 10, accountMinutes(t, setup))
+		require.NoError(t, p.h.Commit())
+		assert.Equal(t, 20, accountMinutes(t, setup))
+	})
+
+	t.Run("same request from two processes at once", func(t *testing.T) {
+		setup, srv, p1 := setupProcessorTest(t)
+		h2, err := db.Open(filepath.Dir(setup.FilePath), false)
+		require.NoError(t, err)
+		t.Cleanup(h2.Abandon)
+		p2 := NewProcessor(p1.gateway, h2)
+
+		// p2 looks for the key before p1 records it.
+		a := testAuthorisation(testutil.ApprovedCard, 995)
+		_, err = Get(ctx, h2, a.Key)
+		require.ErrorIs(t, err, ErrNotFound)
+
+		first, err := p1.Authorise(ctx, 666490, a)
+		require.NoError(t, err)
+		actions := srv.Actions()
+
+		again, err := p2.Authorise(ctx, 666490, a)
+		require.NoError(t, err)
+		assert.Equal(t, first, again)
+		assert.Equal(t, actions, srv.Actions())
+	})
+
+	t.Run("pending request retried by two processes is credited once", func(t *testing.T) {
+		setup, srv, p1 := setupProcessorTest(t)
+		h2, err := db.Open(filepath.Dir(setup.FilePath), false)
+		require.NoError(t, err)
+		t.Cleanup(h2.Abandon)
+		p2 := NewProcessor(p1.gateway, h2)
+
+		auth, err := p1.Authorise(ctx, 666490, testAuthorisation(testutil.ApprovedCard, 995))
+		require.NoError(t, err)
+		key := NewKey()
+		srv.SetHang(true)
+		_, err = p1.Capture(ctx, key, auth, 300)
+		srv.SetHang(false)
+		require.ErrorIs(t, err, ErrTimeout)
+
+		// Both processes find the capture pending and ask the gateway, which
+		// approves it for both.
+		stale, err := Get(ctx, h2, key)
+		require.NoError(t, err)
+		require.Equal(t, Pending, stale.Status)
+		capture, err := p1.Capture(ctx, key, auth, 300)
+		require.NoError(t, err)
+		require.Equal(t, Approved, capture.Status)
+		assert.Equal(t, 310, accountMinutes(t, setup))
+
+		again, err := p2.finish(ctx, stale, &Result{ID: capture.GatewayID, Approved: true}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, capture, again)
+		assert.Equal(t, 310, accountMinutes(t, setup))
+		credits, err := billing.CreditHistory(ctx, h2, 666490)
+		require.NoError(t, err)
+		assert.Len(t, credits, 1)
+	})
+}
+
+func TestStrings(t *testing.T) {
+	assert.Equal(t, "capture", OpCapture.String())
+	assert.Equal(t, "pending", Pending.String())
+	assert.Equal(t, `Status("Z")`, Status('Z').String())
+}
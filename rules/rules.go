@@ -2,14 +2,22 @@ package rules
 
 import (
 	"fmt"
+	"path/filepath"
 
 	"golang.org/x/sys/unix"
 
 	"github.com/nosborn/ibgames-1999"
+	"github.com/nosborn/ibgames-1999/config"
 	"github.com/nosborn/ibgames-1999/goodies"
 )
 
-var homeDir = goodies.HomeDir
+// lockDir returns the directory holding the rules lock files.
+var lockDir = func() string {
+	if dir := config.Get().LockDir; dir != "" {
+		return dir
+	}
+	return filepath.Join(goodies.HomeDir(), "lock")
+}
 
 func IsLockedOut(uid ibgames.AccountID) bool {
 	if uid < ibgames.MinAccountID || uid > ibgames.MaxAccountID {
@@ -25,5 +33,5 @@ func RulesLockFile(uid ibgames.AccountID) string {
 		panic(fmt.Sprintf("uid %d out of range [%d, %d]", uid, ibgames.MinAccountID, ibgames.MaxAccountID))
 	}
 
-	return fmt.Sprintf("%s/lock/%d", homeDir(), uid)
+	return fmt.Sprintf("%s/%d", lockDir(), uid)
 }
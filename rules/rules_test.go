@@ -10,6 +10,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/nosborn/ibgames-1999"
+	"github.com/nosborn/ibgames-1999/config"
 )
 
 func TestRulesLockFile(t *testing.T) {
@@ -18,9 +19,9 @@ func TestRulesLockFile(t *testing.T) {
 		err := os.MkdirAll(filepath.Join(tempDir, "lock"), 0o755)
 		require.NoError(t, err)
 
-		originalHomeDir := homeDir
-		homeDir = func() string { return tempDir }
-		defer func() { homeDir = originalHomeDir }()
+		originalLockDir := lockDir
+		lockDir = func() string { return filepath.Join(tempDir, "lock") }
+		defer func() { lockDir = originalLockDir }()
 
 		uid := ibgames.AccountID(666000)
 		result := RulesLockFile(uid)
@@ -29,6 +30,15 @@ func TestRulesLockFile(t *testing.T) {
 		assert.Equal(t, expected, result)
 	})
 
+	t.Run("uses configured lock directory", func(t *testing.T) {
+		c := config.Default()
+		c.LockDir = "/var/ibgames/lock"
+		config.Set(c)
+		defer config.Set(nil)
+
+		assert.Equal(t, "/var/ibgames/lock/666000", RulesLockFile(666000))
+	})
+
 	t.Run("panics on uid below minimum", func(t *testing.T) {
 		uid := ibgames.AccountID(ibgames.MinAccountID - 1)
 		assert.Panics(t, func() { RulesLockFile(uid) })
@@ -46,9 +56,9 @@ func TestIsLockedOut(t *testing.T) {
 		err := os.MkdirAll(filepath.Join(tempDir, "lock"), 0o755)
 		require.NoError(t, err)
 
-		originalHomeDir := homeDir
-		homeDir = func() string { return tempDir }
-		defer func() { homeDir = originalHomeDir }()
+		originalLockDir := lockDir
+		lockDir = func() string { return filepath.Join(tempDir, "lock") }
+		defer func() { lockDir = originalLockDir }()
 
 		uid := ibgames.AccountID(666000)
 		result := IsLockedOut(uid)
@@ -60,9 +70,9 @@ func TestIsLockedOut(t *testing.T) {
 		err := os.MkdirAll(filepath.Join(tempDir, "lock"), 0o755)
 		require.NoError(t, err)
 
-		originalHomeDir := homeDir
-		homeDir = func() string { return tempDir }
-		defer func() { homeDir = originalHomeDir }()
+		originalLockDir := lockDir
+		lockDir = func() string { return filepath.Join(tempDir, "lock") }
+		defer func() { lockDir = originalLockDir }()
 
 		uid := ibgames.AccountID(666000)
 		lockFile := RulesLockFile(uid)
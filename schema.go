@@ -0,0 +1,9 @@
+package ibgames
+
+import _ "embed"
+
+// Schema is the SQL script that creates the accounts database. It is written
+// for the sqlite3 shell, so it may contain dot-commands as well as SQL.
+//
+//go:embed ibgames.sql
+var Schema string
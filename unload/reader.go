@@ -0,0 +1,114 @@
+// Package unload reads and writes the pipe-delimited files produced by the
+// Informix UNLOAD statement, and converts their fields to and from the values
+// stored in the accounts database.
+//
+// Each record is a line of fields, each followed by the delimiter. A
+// backslash escapes the next character, which is how delimiters, backslashes
+// and newlines inside a field are written. An empty field is NULL; an empty
+// string is written as a backslash followed by a blank.
+package unload
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultDelimiter is the Informix default, DBDELIMITER=|.
+const DefaultDelimiter = '|'
+
+// Reader reads records from an UNLOAD file.
+type Reader struct {
+	Delimiter byte // Field delimiter, DefaultDelimiter unless changed
+
+	r    *bufio.Reader
+	line int // Line the last record started on
+	next int // Line the next record starts on
+}
+
+// NewReader returns a Reader reading from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{Delimiter: DefaultDelimiter, r: bufio.NewReader(r), next: 1}
+}
+
+// Line returns the line number on which the record last returned by Read
+// started. A record can span lines if its fields contain escaped newlines.
+func (r *Reader) Line() int {
+	return r.line
+}
+
+// Read returns the next record, or io.EOF at the end of the input. NULL
+// fields are returned as invalid NullStrings. Blank lines are skipped.
+func (r *Reader) Read() ([]sql.NullString, error) {
+	var (
+		record []sql.NullString
+		raw    []byte // Field as it appears in the file
+		value  []byte // Field with escapes removed
+	)
+	r.line = r.next
+	for {
+		b, err := r.r.ReadByte()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			if record == nil && raw == nil {
+				return nil, io.EOF
+			}
+			if raw == nil {
+				return record, nil // Last line had no newline.
+			}
+			return nil, fmt.Errorf("line %d: record isn't terminated", r.line)
+		}
+
+		switch b {
+		case '\\':
+			c, err := r.r.ReadByte()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					return nil, fmt.Errorf("line %d: backslash at end of file", r.line)
+				}
+				return nil, err
+			}
+			if c == '\n' {
+				r.next++
+			}
+			raw = append(raw, b, c)
+			value = append(value, c)
+
+		case r.Delimiter:
+			record = append(record, field(raw, value))
+			raw, value = nil, nil
+
+		case '\n':
+			r.next++
+			if raw != nil {
+				// Some tools leave off the final delimiter.
+				record = append(record, field(raw, value))
+			}
+			if record == nil {
+				r.line = r.next
+				continue // Blank line
+			}
+			return record, nil
+
+		default:
+			raw = append(raw, b)
+			value = append(value, b)
+		}
+	}
+}
+
+func field(raw, value []byte) sql.NullString {
+	switch {
+	case len(raw) == 0:
+		return sql.NullString{}
+	case bytes.Equal(raw, []byte(`\ `)):
+		return sql.NullString{String: "", Valid: true}
+	default:
+		return sql.NullString{String: string(value), Valid: true}
+	}
+}
@@ -0,0 +1,76 @@
+package unload
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAll(t *testing.T, r *Reader) ([][]sql.NullString, []int) {
+	var records [][]sql.NullString
+	var lines []int
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return records, lines
+		}
+		require.NoError(t, err)
+		records = append(records, record)
+		lines = append(lines, r.Line())
+	}
+}
+
+func v(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: true}
+}
+
+func TestReader(t *testing.T) {
+	t.Run("fields and NULLs", func(t *testing.T) {
+		r := NewReader(strings.NewReader("one|2||\\ |\nthree|4|x| |\n"))
+		records, lines := readAll(t, r)
+		assert.Equal(t, [][]sql.NullString{
+			{v("one"), v("2"), {}, v("")},
+			{v("three"), v("4"), v("x"), v(" ")},
+		}, records)
+		assert.Equal(t, []int{1, 2}, lines)
+	})
+
+	t.Run("escapes", func(t *testing.T) {
+		r := NewReader(strings.NewReader("a\\|b|back\\\\slash|two\\\nlines|\nnext|\n"))
+		records, lines := readAll(t, r)
+		assert.Equal(t, [][]sql.NullString{
+			{v("a|b"), v("back\\slash"), v("two\nlines")},
+			{v("next")},
+		}, records)
+		assert.Equal(t, []int{1, 3}, lines)
+	})
+
+	t.Run("other delimiter", func(t *testing.T) {
+		r := NewReader(strings.NewReader("a,b|c,\n"))
+		r.Delimiter = ','
+		records, _ := readAll(t, r)
+		assert.Equal(t, [][]sql.NullString{{v("a"), v("b|c")}}, records)
+	})
+
+	t.Run("blank lines and missing final delimiter", func(t *testing.T) {
+		r := NewReader(strings.NewReader("\na|b\n\nc|\nd|"))
+		records, lines := readAll(t, r)
+		assert.Equal(t, [][]sql.NullString{{v("a"), v("b")}, {v("c")}, {v("d")}}, records)
+		assert.Equal(t, []int{2, 4, 5}, lines)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		r := NewReader(strings.NewReader("a|b"))
+		_, err := r.Read()
+		assert.ErrorContains(t, err, "line 1")
+
+		r = NewReader(strings.NewReader("a|b\\"))
+		_, err = r.Read()
+		assert.ErrorContains(t, err, "backslash")
+	})
+}
@@ -0,0 +1,172 @@
+package unload
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Type is the Informix type of a column.
+type Type int
+
+const (
+	Char     Type = iota // CHAR(n), stored as TEXT
+	Integer              // INTEGER or SMALLINT
+	Serial               // SERIAL, kept as is so keys survive the round trip
+	Date                 // DATE, stored as YYYY-MM-DD
+	Datetime             // DATETIME YEAR TO MINUTE, stored as YYYY-MM-DD HH:MM:SS
+	Interval             // INTERVAL DAY(3) TO MINUTE, stored as minutes
+)
+
+// Column describes one column of an unloaded table.
+type Column struct {
+	Name string
+	Type Type
+}
+
+// Accounts and Sessions list the columns of those tables in the order Informix
+// unloaded them.
+var (
+	Accounts = []Column{
+		{"name", Char},
+		{"name_key", Char},
+		{"uid", Serial},
+		{"encrypt", Char},
+		{"schange", Datetime},
+		{"acct_expire", Interval},
+		{"slogin", Datetime},
+		{"ulogin", Datetime},
+		{"sucip", Char},
+		{"nunsuclog", Integer},
+		{"unsucip", Char},
+		{"email", Char},
+		{"email_key", Char},
+		{"signup", Date},
+		{"status", Char},
+		{"complimentary", Char},
+		{"minutes", Integer},
+		{"admin_uid", Integer},
+		{"admin_date", Date},
+		{"bulk_mail", Char},
+		{"bad_check", Char},
+		{"buddy_uid", Integer},
+		{"buddy_payment", Char},
+	}
+	Sessions = []Column{
+		{"sid", Serial},
+		{"product", Integer},
+		{"uid", Integer},
+		{"ip_address", Char},
+		{"begin", Datetime},
+		{"end", Datetime},
+		{"minutes", Integer},
+	}
+)
+
+// Tables maps table names to their columns.
+var Tables = map[string][]Column{
+	"accounts": Accounts,
+	"sessions": Sessions,
+}
+
+// Value converts an UNLOAD field to the value stored in the column: nil for
+// NULL, otherwise a string or an int64.
+func (c Column) Value(f sql.NullString) (any, error) {
+	if !f.Valid {
+		return nil, nil
+	}
+	switch c.Type {
+	case Char:
+		return strings.TrimRight(f.String, " "), nil // CHAR columns are blank padded.
+	case Integer, Serial:
+		n, err := strconv.ParseInt(strings.TrimSpace(f.String), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: bad integer %q", c.Name, f.String)
+		}
+		return n, nil
+	case Date:
+		t, err := ParseDate(f.String)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.Name, err)
+		}
+		return t.Format(time.DateOnly), nil
+	case Datetime:
+		t, err := ParseDatetime(f.String)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.Name, err)
+		}
+		return t.Format(time.DateTime), nil
+	case Interval:
+		d, err := ParseInterval(f.String)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.Name, err)
+		}
+		return int64(d / time.Minute), nil
+	default:
+		panic("unknown column type")
+	}
+}
+
+// Field converts a value stored in the column, as returned by the database
+// driver, back to its UNLOAD form. Dates and times are parsed from the text
+// the database holds and formatted the way Informix would.
+func (c Column) Field(value any) (sql.NullString, error) {
+	if value == nil {
+		return sql.NullString{}, nil
+	}
+	var s string
+	switch c.Type {
+	case Char:
+		switch v := value.(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		default:
+			s = fmt.Sprint(v)
+		}
+	case Integer, Serial:
+		n, ok := value.(int64)
+		if !ok {
+			return sql.NullString{}, fmt.Errorf("%s: bad integer %v", c.Name, value)
+		}
+		s = strconv.FormatInt(n, 10)
+	case Date:
+		t, err := storedTime(value)
+		if err != nil {
+			return sql.NullString{}, fmt.Errorf("%s: %w", c.Name, err)
+		}
+		s = FormatDate(t)
+	case Datetime:
+		t, err := storedTime(value)
+		if err != nil {
+			return sql.NullString{}, fmt.Errorf("%s: %w", c.Name, err)
+		}
+		s = FormatDatetime(t)
+	case Interval:
+		n, ok := value.(int64)
+		if !ok {
+			return sql.NullString{}, fmt.Errorf("%s: bad interval %v", c.Name, value)
+		}
+		s = FormatInterval(time.Duration(n) * time.Minute)
+	default:
+		panic("unknown column type")
+	}
+	return sql.NullString{String: s, Valid: true}, nil
+}
+
+// storedTime parses a date or time as held in the database.
+func storedTime(value any) (time.Time, error) {
+	s, ok := value.(string)
+	if !ok {
+		return time.Time{}, fmt.Errorf("bad date %v", value)
+	}
+	for _, layout := range []string{time.DateTime, "2006-01-02 15:04", time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad date %q", s)
+}
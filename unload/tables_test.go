@@ -0,0 +1,85 @@
+package unload
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestColumnValue(t *testing.T) {
+	for _, tc := range []struct {
+		c    Column
+		f    sql.NullString
+		want any
+	}{
+		{Column{"name", Char}, v("Fred      "), "Fred"},
+		{Column{"name", Char}, sql.NullString{}, nil},
+		{Column{"uid", Serial}, v("100042"), int64(100042)},
+		{Column{"minutes", Integer}, v(" -5"), int64(-5)},
+		{Column{"signup", Date}, v("12/25/1998"), "1998-12-25"},
+		{Column{"slogin", Datetime}, v("1999-03-15 14:30"), "1999-03-15 14:30:00"},
+		{Column{"acct_expire", Interval}, v("  1 01:01"), int64(24*60 + 61)},
+	} {
+		got, err := tc.c.Value(tc.f)
+		require.NoError(t, err, tc.c.Name)
+		assert.Equal(t, tc.want, got, tc.c.Name)
+	}
+
+	_, err := Column{"minutes", Integer}.Value(v("lots"))
+	assert.ErrorContains(t, err, "minutes")
+	_, err = Column{"signup", Date}.Value(v("Christmas"))
+	assert.ErrorContains(t, err, "signup")
+}
+
+func TestTables(t *testing.T) {
+	assert.Len(t, Tables["accounts"], 23)
+	assert.Len(t, Tables["sessions"], 7)
+}
+
+func TestColumnField(t *testing.T) {
+	for _, tc := range []struct {
+		c     Column
+		value any
+		want  sql.NullString
+	}{
+		{Column{"name", Char}, "Fred", v("Fred")},
+		{Column{"name", Char}, nil, sql.NullString{}},
+		{Column{"uid", Serial}, int64(100042), v("100042")},
+		{Column{"signup", Date}, "1998-12-25", v("12/25/1998")},
+		{Column{"slogin", Datetime}, "1999-03-15 14:30:59", v("1999-03-15 14:30")},
+		{Column{"acct_expire", Interval}, int64(24*60 + 61), v("  1 01:01")},
+	} {
+		got, err := tc.c.Field(tc.value)
+		require.NoError(t, err, tc.c.Name)
+		assert.Equal(t, tc.want, got, tc.c.Name)
+	}
+
+	_, err := Column{"minutes", Integer}.Field("lots")
+	assert.ErrorContains(t, err, "minutes")
+	_, err = Column{"signup", Date}.Field("Christmas")
+	assert.ErrorContains(t, err, "signup")
+}
+
+func TestColumnRoundTrip(t *testing.T) {
+	for _, c := range Accounts {
+		for _, f := range []sql.NullString{{}, v("1")} {
+			switch {
+			case !f.Valid:
+			case c.Type == Date:
+				f.String = "03/15/1999"
+			case c.Type == Datetime:
+				f.String = "1999-03-15 14:30"
+			case c.Type == Interval:
+				f.String = "  3 04:05"
+			default:
+			}
+			value, err := c.Value(f)
+			require.NoError(t, err, c.Name)
+			got, err := c.Field(value)
+			require.NoError(t, err, c.Name)
+			assert.Equal(t, f, got, c.Name)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package unload
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layouts of the Informix types as UNLOAD writes them. DATE follows the
+// default DBDATE=MDY4/.
+const (
+	DateLayout     = "01/02/2006"
+	DatetimeLayout = "2006-01-02 15:04" // DATETIME YEAR TO MINUTE
+)
+
+// ParseDate parses an Informix DATE. ISO dates are also accepted.
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{DateLayout, time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad DATE %q", s)
+}
+
+// ParseDatetime parses an Informix DATETIME YEAR TO MINUTE. Values with
+// seconds or fractions of a second are also accepted.
+func ParseDatetime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{DatetimeLayout, time.DateTime, "2006-01-02 15:04:05.999999999"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad DATETIME %q", s)
+}
+
+// ParseInterval parses an Informix INTERVAL DAY TO MINUTE, such as "  3 04:05".
+func ParseInterval(s string) (time.Duration, error) {
+	bad := fmt.Errorf("bad INTERVAL %q", s)
+
+	t := strings.TrimSpace(s)
+	negative := strings.HasPrefix(t, "-")
+	t = strings.TrimSpace(strings.TrimPrefix(t, "-"))
+
+	dayPart, timePart, ok := strings.Cut(t, " ")
+	if !ok {
+		return 0, bad
+	}
+	hourPart, minutePart, ok := strings.Cut(strings.TrimSpace(timePart), ":")
+	if !ok {
+		return 0, bad
+	}
+	days, err := strconv.Atoi(dayPart)
+	if err != nil || days < 0 {
+		return 0, bad
+	}
+	hours, err := strconv.Atoi(hourPart)
+	if err != nil || hours < 0 || hours > 23 {
+		return 0, bad
+	}
+	minutes, err := strconv.Atoi(minutePart)
+	if err != nil || minutes < 0 || minutes > 59 {
+		return 0, bad
+	}
+
+	d := time.Duration(days)*24*time.Hour + time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute
+	if negative {
+		d = -d
+	}
+	return d, nil
+}
+
+// FormatDate formats t as an Informix DATE.
+func FormatDate(t time.Time) string {
+	return t.Format(DateLayout)
+}
+
+// FormatDatetime formats t as an Informix DATETIME YEAR TO MINUTE.
+func FormatDatetime(t time.Time) string {
+	return t.Format(DatetimeLayout)
+}
+
+// FormatInterval formats d, truncated to the minute, as an Informix INTERVAL
+// DAY(3) TO MINUTE.
+func FormatInterval(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign, d = "-", -d
+	}
+	minutes := int64(d / time.Minute)
+	days := minutes / (24 * 60)
+	return fmt.Sprintf("%s%3d %02d:%02d", sign, days, minutes/60%24, minutes%60)
+}
@@ -0,0 +1,60 @@
+package unload
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDate(t *testing.T) {
+	d, err := ParseDate("03/15/1999")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(1999, 3, 15, 0, 0, 0, 0, time.UTC), d)
+	assert.Equal(t, "03/15/1999", FormatDate(d))
+
+	d, err = ParseDate("1999-03-15")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(1999, 3, 15, 0, 0, 0, 0, time.UTC), d)
+
+	_, err = ParseDate("15/03/1999")
+	assert.Error(t, err)
+}
+
+func TestDatetime(t *testing.T) {
+	d, err := ParseDatetime("1999-03-15 14:30")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(1999, 3, 15, 14, 30, 0, 0, time.UTC), d)
+	assert.Equal(t, "1999-03-15 14:30", FormatDatetime(d))
+
+	d, err = ParseDatetime("1999-03-15 14:30:05.25")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(1999, 3, 15, 14, 30, 5, 250000000, time.UTC), d)
+
+	_, err = ParseDatetime("1999-03-15")
+	assert.Error(t, err)
+}
+
+func TestInterval(t *testing.T) {
+	for _, tc := range []struct {
+		s string
+		d time.Duration
+	}{
+		{"  3 04:05", 3*24*time.Hour + 4*time.Hour + 5*time.Minute},
+		{"  0 00:00", 0},
+		{"365 23:59", 365*24*time.Hour + 23*time.Hour + 59*time.Minute},
+		{"- 1 12:00", -36 * time.Hour},
+	} {
+		d, err := ParseInterval(tc.s)
+		require.NoError(t, err, tc.s)
+		assert.Equal(t, tc.d, d, tc.s)
+	}
+	assert.Equal(t, "  3 04:05", FormatInterval(3*24*time.Hour+4*time.Hour+5*time.Minute))
+	assert.Equal(t, "-  1 12:00", FormatInterval(-36*time.Hour))
+
+	for _, s := range []string{"", "3", "3 04", "3 24:00", "3 04:60", "x 04:05"} {
+		_, err := ParseInterval(s)
+		assert.Error(t, err, s)
+	}
+}
@@ -0,0 +1,49 @@
+package unload
+
+import (
+	"bufio"
+	"database/sql"
+	"io"
+)
+
+// Writer writes records to an UNLOAD file. The output is buffered, so Flush
+// must be called at the end.
+type Writer struct {
+	Delimiter byte // Field delimiter, DefaultDelimiter unless changed
+
+	w *bufio.Writer
+}
+
+// NewWriter returns a Writer writing to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{Delimiter: DefaultDelimiter, w: bufio.NewWriter(w)}
+}
+
+// Write writes one record. NULL fields are written empty and empty strings as
+// a backslash and a blank, so the two can be told apart when reading back.
+func (w *Writer) Write(record []sql.NullString) error {
+	for _, f := range record {
+		switch {
+		case !f.Valid:
+		case f.String == "":
+			_, _ = w.w.WriteString(`\ `)
+		default:
+			for i := range len(f.String) {
+				b := f.String[i]
+				if b == '\\' || b == '\n' || b == w.Delimiter {
+					_ = w.w.WriteByte('\\')
+				}
+				_ = w.w.WriteByte(b)
+			}
+		}
+		if err := w.w.WriteByte(w.Delimiter); err != nil {
+			return err
+		}
+	}
+	return w.w.WriteByte('\n')
+}
+
+// Flush writes any buffered data to the underlying writer.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
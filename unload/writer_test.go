@@ -0,0 +1,38 @@
+package unload
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter(t *testing.T) {
+	records := [][]sql.NullString{
+		{v("one"), v("2"), {}, v("")},
+		{v("a|b"), v("back\\slash"), v("two\nlines"), v(" ")},
+	}
+
+	var buf strings.Builder
+	w := NewWriter(&buf)
+	for _, record := range records {
+		require.NoError(t, w.Write(record))
+	}
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "one|2||\\ |\na\\|b|back\\\\slash|two\\\nlines| |\n", buf.String())
+
+	// What is written reads back the same.
+	got, _ := readAll(t, NewReader(strings.NewReader(buf.String())))
+	assert.Equal(t, records, got)
+}
+
+func TestWriterDelimiter(t *testing.T) {
+	var buf strings.Builder
+	w := NewWriter(&buf)
+	w.Delimiter = ','
+	require.NoError(t, w.Write([]sql.NullString{v("a,b"), v("c|d")}))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "a\\,b,c|d,\n", buf.String())
+}